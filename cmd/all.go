@@ -17,23 +17,32 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"log/slog"
+	"strings"
+	"time"
 
 	"github.com/docker/attest/mirror"
+	"github.com/docker/go-tuf-mirror/internal/notify"
+	"github.com/docker/go-tuf-mirror/internal/sign"
+	mirrortuf "github.com/docker/go-tuf-mirror/internal/tuf"
+	"github.com/docker/go-tuf-mirror/internal/util"
+	"github.com/docker/go-tuf-mirror/pkg/tufmirror"
 	"github.com/spf13/cobra"
 )
 
 type allOptions struct {
-	srcMeta     string
-	dstMeta     string
-	srcTargets  string
-	dstTargets  string
+	metadata    *metadataOptions
+	targets     *targetsOptions
 	rootOptions *rootOptions
 }
 
 func defaultAllOptions(opts *rootOptions) *allOptions {
 	return &allOptions{
+		metadata:    defaultMetadataOptions(opts),
+		targets:     defaultTargetsOptions(opts),
 		rootOptions: opts,
 	}
 }
@@ -47,10 +56,29 @@ func newAllCmd(opts *rootOptions) *cobra.Command {
 		SilenceUsage: false,
 		RunE:         o.run,
 	}
-	cmd.Flags().StringVar(&o.srcMeta, "source-metadata", mirror.DefaultMetadataURL, fmt.Sprintf("Source metadata location %s<web>, %s<OCI layout>, %s<filesystem> or %s<remote registry>", WebPrefix, OCIPrefix, LocalPrefix, RegistryPrefix))
-	cmd.Flags().StringVar(&o.dstMeta, "dest-metadata", "", fmt.Sprintf("Destination metadata location %s<OCI layout>, %s<filesystem> or %s<remote registry>", OCIPrefix, LocalPrefix, RegistryPrefix))
-	cmd.Flags().StringVar(&o.srcTargets, "source-targets", mirror.DefaultTargetsURL, fmt.Sprintf("Source targets location %s<web>, %s<OCI layout>, %s<filesystem> or %s<remote registry>", WebPrefix, OCIPrefix, LocalPrefix, RegistryPrefix))
-	cmd.Flags().StringVar(&o.dstTargets, "dest-targets", "", fmt.Sprintf("Destination targets location %s<OCI layout>, %s<filesystem> or %s<remote registry>", OCIPrefix, LocalPrefix, RegistryPrefix))
+	cmd.Flags().StringVar(&o.metadata.source, "source-metadata", mirror.DefaultMetadataURL, fmt.Sprintf("Source metadata location %s<web>, %s<OCI layout>, %s<filesystem> or %s<remote registry>", WebPrefix, OCIPrefix, LocalPrefix, RegistryPrefix))
+	cmd.Flags().StringArrayVar(&o.metadata.destinations, "dest-metadata", nil, fmt.Sprintf("Destination metadata location %s<OCI layout>, %s<filesystem> or %s<remote registry>, may be repeated", OCIPrefix, LocalPrefix, RegistryPrefix))
+	cmd.Flags().StringVar(&o.targets.source, "source-targets", mirror.DefaultTargetsURL, fmt.Sprintf("Source targets location %s<web>, %s<OCI layout>, %s<filesystem> or %s<remote registry>", WebPrefix, OCIPrefix, LocalPrefix, RegistryPrefix))
+	cmd.Flags().StringArrayVar(&o.targets.destinations, "dest-targets", nil, fmt.Sprintf("Destination targets location %s<OCI layout>, %s<filesystem> or %s<remote registry>, may be repeated", OCIPrefix, LocalPrefix, RegistryPrefix))
+	cmd.Flags().BoolVar(&o.metadata.versionTags, "version-tags", false, "Also tag the metadata manifest with the timestamp and root versions (ts-<version>, root-<version>)")
+	cmd.Flags().BoolVar(&o.metadata.dateTag, "date-tag", false, "Also tag the metadata manifest with the current UTC date (date-<yyyymmdd>)")
+	cmd.Flags().StringVar(&o.metadata.delegatedTag, "delegated-tag-template", "", "Go template for delegated metadata and target index tags with .Name, the role name (default <role>)")
+	cmd.Flags().StringArrayVar(&o.metadata.roles, "role", nil, "Only mirror delegated roles matching this glob pattern, may be repeated")
+	cmd.Flags().StringArrayVar(&o.targets.targetFilters, "target", nil, "Only mirror top-level targets whose name matches this glob pattern, may be repeated")
+	cmd.Flags().StringVar(&o.targets.targetTag, "target-tag-template", "", "Go template for target tags with .Hash and .Name, e.g. '{{.Hash | trunc 12}}-{{.Name}}' (default <hash>.<name>)")
+	cmd.Flags().BoolVar(&o.targets.validatePolicy, "validate-policy", false, "Validate policy mappings and compile Rego policies before mirroring targets")
+	cmd.Flags().BoolVar(&o.targets.referrers, "referrers", false, "Attach the signed targets metadata to each target manifest as an OCI referrer")
+	cmd.Flags().BoolVar(&o.targets.prune, "prune", false, "Prune target tags no longer referenced by the targets metadata after mirroring")
+	cmd.Flags().IntVar(&o.targets.pruneKeep, "prune-keep", 0, "Number of previous generations of each target to keep when pruning")
+	cmd.Flags().BoolVar(&o.targets.pruneDryRun, "prune-dry-run", true, "Only report the target tags that would be pruned")
+	cmd.Flags().StringVar(&o.metadata.signKey, "sign-key", "", "PEM encoded ECDSA or ED25519 private key to sign every mirrored manifest with, encrypted keys use COSIGN_PASSWORD")
+	cmd.Flags().StringVar(&o.metadata.signMode, "sign-mode", sign.TagMode, fmt.Sprintf("Where registries store signatures [%s, %s]", sign.TagMode, sign.ReferrerMode))
+	cmd.Flags().BoolVar(&o.metadata.provenance, "provenance", false, "Attach an in-toto provenance attestation of the run to the metadata manifest as an OCI referrer")
+	cmd.Flags().StringVar(&o.metadata.provFile, "provenance-file", "", "Write an in-toto provenance statement of the metadata run to this file")
+	cmd.Flags().StringArrayVar(&o.metadata.annotations, "annotation", nil, "Annotation key=value to add to every mirrored manifest and index, may be repeated")
+	cmd.Flags().BoolVar(&o.metadata.requireRoot, "require-approval-on-root-change", false, "Fail when root keys or thresholds changed since the previously mirrored root, until the new root is approved with --approve-root")
+	cmd.Flags().StringVar(&o.metadata.approveRoot, "approve-root", "", "Digest of a new root whose key and threshold changes are approved, as printed in the root change summary")
+	cmd.Flags().BoolVar(&o.targets.resume, "resume", false, "Only save target manifests and delegated target indexes that are missing from the destination or differ there, to repair a partial mirror")
 
 	err := cmd.MarkFlagRequired("source-metadata")
 	if err != nil {
@@ -72,26 +100,234 @@ func newAllCmd(opts *rootOptions) *cobra.Command {
 }
 
 func (o *allOptions) run(cmd *cobra.Command, args []string) error {
-	metadata := newMetadataCmd(o.rootOptions)
-	metadata.SetOut(cmd.OutOrStdout())
-	targets := newTargetsCmd(o.rootOptions)
-	targets.SetOut(cmd.OutOrStdout())
+	// both runs share the sources and the options that apply to metadata and targets alike
+	o.metadata.targets = o.targets.source
+	o.targets.metadata = o.metadata.source
+	o.targets.roles = o.metadata.roles
+	o.targets.delegatedTag = o.metadata.delegatedTag
+	o.targets.signKey = o.metadata.signKey
+	o.targets.signMode = o.metadata.signMode
+	o.targets.annotations = o.metadata.annotations
+	o.targets.verify = true
+	return o.rootOptions.mirrorRun(cmd, o.metadata, o.targets)
+}
+
+// mirrorRun mirrors targets and then metadata, either may be nil. Both are validated before anything is
+// mirrored and share one verified TUF mirror. Targets are verified at their destinations before metadata is
+// published, so that clients never see metadata referencing targets that are not mirrored yet, and pruned
+// after, so that they never see metadata referencing targets that were deleted.
+func (o *rootOptions) mirrorRun(cmd *cobra.Command, metadata *metadataOptions, targets *targetsOptions) error {
+	var metadataURL, targetsURL string
+	var mr *metadataRun
+	var tr *targetsRun
+	var err error
+	if metadata != nil {
+		mr, err = metadata.validate()
+		if err != nil {
+			return err
+		}
+		metadataURL, targetsURL = metadata.source, metadata.targets
+	}
+	if targets != nil {
+		tr, err = targets.validate()
+		if err != nil {
+			return err
+		}
+		metadataURL, targetsURL = targets.metadata, targets.source
+	}
+	notifier, err := o.notifier()
+	if err != nil {
+		return err
+	}
+	defer o.releaseCaches()
+	log := o.logger(cmd)
+	defer o.writeMetrics(log)
+
+	// the mirror is opened by the first run, after it announced itself
+	var m *tufmirror.Mirror
+	var roles []*mirrortuf.Role
+	var rootChecked bool
+	open := func() (*tufmirror.Mirror, error) {
+		if m == nil {
+			var err error
+			m, err = o.webMirror(cmd, metadataURL, targetsURL)
+			if err != nil {
+				return nil, err
+			}
+			repo, err := mirrortuf.Inspect(m.Client())
+			if err != nil {
+				return nil, err
+			}
+			roles = repo.Roles
+			o.metrics.SetRoles(metadataURL, roles)
+		}
+		// the root is checked as soon as the mirror is opened, before any destination is written,
+		// so that a rejected root publishes no targets either
+		if mr != nil && !rootChecked {
+			err := mr.checkRoot(cmd, log, m)
+			if err != nil {
+				return nil, err
+			}
+			rootChecked = true
+		}
+		return m, nil
+	}
+	defer func() {
+		if m != nil {
+			_ = m.Close()
+		}
+	}()
 
-	_ = metadata.PersistentFlags().Set("source", o.srcMeta)
-	_ = metadata.PersistentFlags().Set("destination", o.dstMeta)
-	_ = metadata.PersistentFlags().Set("targets", o.srcTargets)
+	// the published metadata references the targets mirrored before, so stale targets are only pruned once the
+	// new metadata is published
+	prune := tr != nil && mr != nil && tr.options.Prune
+	if prune {
+		tr.options.Prune = false
+	}
 
-	_ = targets.PersistentFlags().Set("source", o.srcTargets)
-	_ = targets.PersistentFlags().Set("destination", o.dstTargets)
-	_ = targets.PersistentFlags().Set("metadata", o.srcMeta)
+	event := &notify.Event{Type: notify.RunEvent, Metadata: metadataURL, Targets: targetsURL}
+	run := func() error {
+		if tr != nil {
+			res, err := tr.mirror(cmd, log, open)
+			event.Destinations = append(event.Destinations, destinationEvents("targets", tr.locations, res, err)...)
+			if err != nil && mr != nil {
+				return fmt.Errorf("error mirroring targets, metadata not published: %w", err)
+			}
+			if err != nil {
+				return fmt.Errorf("error mirroring targets: %w", err)
+			}
+		}
+		if mr != nil {
+			res, err := mr.mirror(cmd, log, open)
+			event.Destinations = append(event.Destinations, destinationEvents("metadata", mr.locations, res, err)...)
+			if err != nil {
+				return fmt.Errorf("error mirroring metadata: %w", err)
+			}
+		}
+		if prune {
+			err := tr.prune(cmd, open)
+			if err != nil {
+				return fmt.Errorf("error pruning targets: %w", err)
+			}
+		}
+		return nil
+	}
+	err = run()
+	if err == nil {
+		o.metrics.SetLastSuccess(metadataURL, time.Now())
+	}
+	if notifier != nil {
+		event.Time = time.Now().UTC()
+		event.Success = err == nil
+		if err != nil {
+			event.Error = err.Error()
+		}
+		for _, r := range roles {
+			event.Roles = append(event.Roles, &notify.Role{Name: r.Name, Version: r.Version})
+		}
+		o.notify(cmd, log, notifier, event)
+	}
+	return err
+}
 
-	err := metadata.ExecuteContext(cmd.Context())
+// notifier returns the notifier of the notify urls, nil if there are none.
+func (o *rootOptions) notifier() (*notify.Notifier, error) {
+	if len(o.notifyURLs) == 0 {
+		return nil, nil
+	}
+	for _, u := range o.notifyURLs {
+		if !util.IsValidUrl(u) {
+			return nil, fmt.Errorf("invalid notify url: %s", u)
+		}
+	}
+	secret, err := notify.LoadSecret(o.notifySecret)
 	if err != nil {
-		return fmt.Errorf("error mirroring metadata: %w", err)
+		return nil, err
+	}
+	return notify.New(o.notifyURLs, secret), nil
+}
+
+// notifyTimeout bounds the notifications of a run, which are not cancelled along with it.
+const notifyTimeout = time.Minute
+
+// notify posts the event of a run. In watch mode only changes are posted: a webhook is skipped if the role
+// versions and the outcome are those of the last event delivered to it for the same sources and destinations.
+// A failed notification is logged rather than failing the run. Notifications are still sent when the run is
+// interrupted, so that the outcome of the last run is not lost, but give up after notifyTimeout.
+func (o *rootOptions) notify(cmd *cobra.Command, log *slog.Logger, notifier *notify.Notifier, event *notify.Event) {
+	var key, state string
+	if o.notified != nil {
+		locations := make([]string, 0, len(event.Destinations))
+		for _, d := range event.Destinations {
+			locations = append(locations, d.Location)
+		}
+		key = strings.Join(append([]string{event.Metadata, event.Targets}, locations...), " ")
+		state = fmt.Sprintf("%t", event.Success)
+		for _, r := range event.Roles {
+			state += fmt.Sprintf(" %s=%d", r.Name, r.Version)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(cmd.Context()), notifyTimeout)
+	defer cancel()
+	sent := 0
+	for _, url := range notifier.URLs() {
+		if o.notified != nil && o.notified[url+" "+key] == state {
+			log.Debug("Skipped notification, nothing changed", "source", event.Metadata, "webhook", url)
+			continue
+		}
+		err := notifier.NotifyURL(ctx, url, event)
+		if err != nil {
+			log.Error("Failed to send notification", "error", err)
+			continue
+		}
+		// only record delivered events, so that a failed notification is sent again by the next run
+		if o.notified != nil {
+			o.notified[url+" "+key] = state
+		}
+		sent++
+	}
+	if sent > 0 {
+		log.Info("Sent notification", "source", event.Metadata, "webhooks", sent)
+	}
+}
+
+// destinationEvents returns the outcome at every destination of a run for notifications. Without a result,
+// nothing was mirrored and every destination failed with err.
+func destinationEvents(kind string, locations []string, res *tufmirror.Result, err error) []*notify.Destination {
+	var events []*notify.Destination
+	if res == nil {
+		for _, l := range locations {
+			events = append(events, &notify.Destination{Kind: kind, Location: l, Error: err.Error(), Manifests: []*notify.Manifest{}, Changed: []*notify.Manifest{}})
+		}
+		return events
+	}
+	for _, d := range res.Destinations {
+		event := &notify.Destination{Kind: kind, Location: d.Destination.Location(), Success: d.Err == nil, Manifests: []*notify.Manifest{}, Changed: []*notify.Manifest{}}
+		if d.Err != nil {
+			event.Error = d.Err.Error()
+		}
+		for _, m := range d.Manifests {
+			manifest := &notify.Manifest{Name: m.Name, Digest: m.Digest.String()}
+			event.Manifests = append(event.Manifests, manifest)
+			if m.Changed {
+				event.Changed = append(event.Changed, manifest)
+			}
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// writeMetrics writes the metrics to the textfile, if any. A failed write is logged rather than failing the
+// run, the metrics are not the result of the run.
+func (o *rootOptions) writeMetrics(log *slog.Logger) {
+	if o.textfile == "" {
+		return
 	}
-	err = targets.ExecuteContext(cmd.Context())
+	err := o.metrics.WriteTextfile(o.textfile)
 	if err != nil {
-		return fmt.Errorf("error mirroring targets: %w", err)
+		log.Error("Failed to write metrics", "path", o.textfile, "error", err)
+		return
 	}
-	return nil
+	log.Debug("Wrote metrics", "path", o.textfile)
 }
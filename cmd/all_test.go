@@ -20,14 +20,19 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/docker/go-tuf-mirror/internal/notify"
 	"github.com/google/go-containerregistry/pkg/registry"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -75,11 +80,12 @@ func TestAll(t *testing.T) {
 			opts.tufRoot = "dev"
 			cmd := newAllCmd(opts)
 
-			expectedMetadataOutput := fmt.Sprintf("Mirroring TUF metadata %s to %s\n", tc.srcMeta, tc.dstMeta)
-			expectedTargetsOutput := fmt.Sprintf("Mirroring TUF targets %s to %s\n", tc.srcTgt, tc.dstTgt)
+			expectedMetadataOutput := fmt.Sprintf("msg=\"Mirroring TUF metadata\" source=%s destinations=%s\n", tc.srcMeta, tc.dstMeta)
+			expectedTargetsOutput := fmt.Sprintf("msg=\"Mirroring TUF targets\" source=%s destinations=%s\n", tc.srcTgt, tc.dstTgt)
 
 			b := bytes.NewBufferString("")
 			cmd.SetOut(b)
+			cmd.SetErr(b)
 			_ = cmd.Flags().Set("source-metadata", tc.srcMeta)
 			_ = cmd.Flags().Set("source-targets", tc.srcTgt)
 			_ = cmd.Flags().Set("dest-metadata", tc.dstMeta)
@@ -91,33 +97,352 @@ func TestAll(t *testing.T) {
 			err = os.RemoveAll("./tmp")
 			require.NoError(t, err)
 
+			out := b.String()
 			reader := bufio.NewReader(b)
 
-			// Read metadata output line
-			metaOut, err := reader.ReadString('\n')
+			// targets are published first
+			targetsOut, err := reader.ReadString('\n')
 			require.NoError(t, err)
-			assert.Equal(t, expectedMetadataOutput, metaOut)
+			assert.True(t, strings.HasSuffix(targetsOut, expectedTargetsOutput), targetsOut)
 
-			// Skip "Fetching initial root from..." line
-			_, err = reader.ReadString('\n')
-			require.NoError(t, err)
+			// metadata is published once the targets are verified
+			verified := fmt.Sprintf("msg=\"Verified targets\" destination=%s manifests=%d\n", tc.dstTgt, 5+boolToInt(tc.full))
+			assert.Contains(t, out, verified)
+			assert.Contains(t, out, expectedMetadataOutput)
+			assert.Less(t, strings.Index(out, verified), strings.Index(out, expectedMetadataOutput))
+		})
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func TestAllMultipleDestinations(t *testing.T) {
+	layoutDir := t.TempDir()
+
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "internal", "test", "testdata", "test-repo"))))
+	defer server.Close()
+
+	reg := httptest.NewServer(registry.New(registry.WithReferrersSupport(false)))
+	defer reg.Close()
+	url, err := url.Parse(reg.URL)
+	require.NoError(t, err)
+	registryMetadata := RegistryPrefix + "localhost:" + url.Port() + "/test/metadata:latest"
+	registryTargets := RegistryPrefix + "localhost:" + url.Port() + "/test/targets"
+	layoutMetadata := OCIPrefix + filepath.Join(layoutDir, "metadata")
+	layoutTargets := OCIPrefix + filepath.Join(layoutDir, "targets")
+
+	// a layout below a regular file cannot be written
+	file := filepath.Join(layoutDir, "file")
+	err = os.WriteFile(file, []byte{}, 0o600)
+	require.NoError(t, err)
+	invalid := OCIPrefix + filepath.Join(file, "layout")
+
+	testCases := []struct {
+		name       string
+		dstMeta    []string
+		dstTargets []string
+		failed     string
+	}{
+		{"registry and oci layout", []string{registryMetadata, layoutMetadata}, []string{registryTargets, layoutTargets}, ""},
+		{"failed destination", []string{invalid, registryMetadata}, []string{registryTargets}, invalid},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := defaultRootOptions()
+			opts.tufPath = t.TempDir()
+			opts.full = true
+			cmd := newAllCmd(opts)
+			b := bytes.NewBufferString("")
+			logs := bytes.NewBufferString("")
+			cmd.SetOut(b)
+			cmd.SetErr(logs)
+			_ = cmd.Flags().Set("source-metadata", server.URL+"/metadata")
+			_ = cmd.Flags().Set("source-targets", server.URL+"/targets")
+			for _, d := range tc.dstMeta {
+				_ = cmd.Flags().Set("dest-metadata", d)
+			}
+			for _, d := range tc.dstTargets {
+				_ = cmd.Flags().Set("dest-targets", d)
+			}
 
-			// Skip "Metadata manifest layout saved to..." line
-			_, err = reader.ReadString('\n')
+			err := cmd.ExecuteContext(context.Background())
+			out := b.String()
+			if tc.failed != "" {
+				require.ErrorContains(t, err, "failed to mirror to 1 of 2 destinations")
+				assert.Contains(t, out, "  "+tc.failed+": failed: ")
+				assert.Contains(t, logs.String(), "level=ERROR msg=\"Failed to mirror metadata\" destination="+tc.failed+" ")
+				// the remaining destination is still mirrored
+				assert.Contains(t, out, "  "+registryMetadata+": ok\n")
+				return
+			}
+			require.NoError(t, err)
+			assert.Contains(t, logs.String(), fmt.Sprintf("msg=\"Mirroring TUF metadata\" source=%s destinations=%s\n", server.URL+"/metadata", logValue(strings.Join(tc.dstMeta, ", "))))
+			// stdout only holds the destination summaries
+			assert.NotContains(t, out, "msg=")
+			for _, d := range append(tc.dstMeta, tc.dstTargets...) {
+				assert.Contains(t, out, "  "+d+": ok\n")
+			}
+			_, err = os.Stat(filepath.Join(strings.TrimPrefix(layoutTargets, OCIPrefix), targetFile, "index.json"))
 			require.NoError(t, err)
+		})
+	}
+}
 
-			// Skip delegated metadata output lines if full
-			if tc.full {
-				for i := 0; i < DelegatedTargetsLength; i++ {
-					_, err = reader.ReadString('\n')
-					require.NoError(t, err)
-				}
+func TestAllTargetsFailed(t *testing.T) {
+	dir := t.TempDir()
+
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "internal", "test", "testdata", "test-repo"))))
+	defer server.Close()
+
+	// a layout below a regular file cannot be written
+	file := filepath.Join(dir, "file")
+	err := os.WriteFile(file, []byte{}, 0o600)
+	require.NoError(t, err)
+	metadataPath := filepath.Join(dir, "metadata")
+
+	opts := defaultRootOptions()
+	opts.tufPath = t.TempDir()
+	cmd := newAllCmd(opts)
+	b := bytes.NewBufferString("")
+	cmd.SetOut(b)
+	cmd.SetErr(b)
+	_ = cmd.Flags().Set("source-metadata", server.URL+"/metadata")
+	_ = cmd.Flags().Set("source-targets", server.URL+"/targets")
+	_ = cmd.Flags().Set("dest-metadata", OCIPrefix+metadataPath)
+	_ = cmd.Flags().Set("dest-targets", OCIPrefix+filepath.Join(file, "targets"))
+
+	err = cmd.ExecuteContext(context.Background())
+	require.ErrorContains(t, err, "error mirroring targets, metadata not published")
+	assert.NotContains(t, b.String(), "Mirroring TUF metadata")
+	_, err = os.Stat(metadataPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestAllRootApproval(t *testing.T) {
+	testRepo := filepath.Join("..", "internal", "test", "testdata", "test-repo")
+	server := httptest.NewServer(http.FileServer(http.Dir(testRepo)))
+	defer server.Close()
+	dir := t.TempDir()
+
+	// the metadata mirror holds only version 1 of the root, version 2 adds keys
+	metadataPath := filepath.Join(dir, "metadata")
+	require.NoError(t, os.MkdirAll(metadataPath, 0o755))
+	root1, err := os.ReadFile(filepath.Join(testRepo, "metadata", "1.root.json"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(metadataPath, "1.root.json"), root1, 0o600))
+	targetsPath := filepath.Join(dir, "targets")
+
+	opts := defaultRootOptions()
+	opts.tufPath = t.TempDir()
+	cmd := newAllCmd(opts)
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+	_ = cmd.Flags().Set("source-metadata", server.URL+"/metadata")
+	_ = cmd.Flags().Set("source-targets", server.URL+"/targets")
+	_ = cmd.Flags().Set("dest-metadata", LocalPrefix+metadataPath)
+	_ = cmd.Flags().Set("dest-targets", OCIPrefix+targetsPath)
+	_ = cmd.Flags().Set("require-approval-on-root-change", "true")
+
+	err = cmd.ExecuteContext(context.Background())
+	require.ErrorContains(t, err, "root keys or thresholds changed from version 1 to 2")
+	// a rejected root publishes no targets either
+	_, err = os.Stat(targetsPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestAllOptions(t *testing.T) {
+	dir := t.TempDir()
+
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "internal", "test", "testdata", "test-repo"))))
+	defer server.Close()
+
+	reg := httptest.NewServer(registry.New(registry.WithReferrersSupport(false)))
+	defer reg.Close()
+	url, err := url.Parse(reg.URL)
+	require.NoError(t, err)
+	repo := "localhost:" + url.Port() + "/test"
+
+	testCases := []struct {
+		name  string
+		flags map[string]string
+		err   string
+	}{
+		{"invalid annotation", map[string]string{"annotation": "invalid"}, "invalid annotation"},
+		{"invalid sign mode", map[string]string{"sign-mode": "invalid"}, "unsupported signature mode"},
+		{"invalid destination", map[string]string{"dest-targets": "s3://bucket/targets"}, "destination not implemented"},
+		{"filters and tags", map[string]string{"target": "*.txt", "role": "none", "version-tags": "true"}, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := defaultRootOptions()
+			opts.tufPath = t.TempDir()
+			opts.full = true
+			cmd := newAllCmd(opts)
+			b := bytes.NewBufferString("")
+			cmd.SetOut(b)
+			cmd.SetErr(b)
+			flags := map[string]string{
+				"source-metadata": server.URL + "/metadata",
+				"source-targets":  server.URL + "/targets",
+				"dest-metadata":   RegistryPrefix + repo + "/metadata:latest",
+				"dest-targets":    OCIPrefix + filepath.Join(dir, tc.name),
+			}
+			for k, v := range tc.flags {
+				flags[k] = v
+			}
+			for k, v := range flags {
+				require.NoError(t, cmd.Flags().Set(k, v))
 			}
 
-			// Read targets output line
-			targetsOut, err := reader.ReadString('\n')
+			err := cmd.ExecuteContext(context.Background())
+			out := b.String()
+			if tc.err != "" {
+				// options are validated before anything is mirrored
+				require.ErrorContains(t, err, tc.err)
+				assert.NotContains(t, out, "Mirroring")
+				return
+			}
+			require.NoError(t, err)
+			assert.Contains(t, out, savedLog("Target manifest", filepath.Join(dir, tc.name, targetFile)))
+			assert.NotContains(t, out, "mapping.yaml")
+			assert.NotContains(t, out, "Delegated")
+			assert.Contains(t, out, savedLog("Metadata manifest", repo+"/metadata:ts-7"))
+		})
+	}
+}
+
+func TestAllMetricsTextfile(t *testing.T) {
+	dir := t.TempDir()
+
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "internal", "test", "testdata", "test-repo"))))
+	defer server.Close()
+
+	opts := defaultRootOptions()
+	opts.tufPath = t.TempDir()
+	opts.textfile = filepath.Join(dir, "go_tuf_mirror.prom")
+	cmd := newAllCmd(opts)
+	b := bytes.NewBufferString("")
+	cmd.SetOut(b)
+	cmd.SetErr(b)
+	_ = cmd.Flags().Set("source-metadata", server.URL+"/metadata")
+	_ = cmd.Flags().Set("source-targets", server.URL+"/targets")
+	_ = cmd.Flags().Set("dest-metadata", OCIPrefix+filepath.Join(dir, "metadata"))
+	_ = cmd.Flags().Set("dest-targets", OCIPrefix+filepath.Join(dir, "targets"))
+
+	err := cmd.ExecuteContext(context.Background())
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(opts.textfile)
+	require.NoError(t, err)
+	out := string(data)
+	source := server.URL + "/metadata"
+	assert.Contains(t, out, fmt.Sprintf("go_tuf_mirror_targets_total{destination=%q,result=\"pushed\"} 5\n", OCIPrefix+filepath.Join(dir, "targets")))
+	assert.Contains(t, out, fmt.Sprintf("go_tuf_mirror_role_version{role=\"timestamp\",source=%q} 7\n", source))
+	assert.Contains(t, out, fmt.Sprintf("go_tuf_mirror_role_expiry_seconds{role=\"targets\",source=%q} ", source))
+	assert.Contains(t, out, fmt.Sprintf("go_tuf_mirror_last_success_timestamp_seconds{source=%q} ", source))
+	assert.Contains(t, out, "go_tuf_mirror_fetch_duration_seconds_count{operation=\"metadata_update\"} 1\n")
+	assert.Contains(t, out, "go_tuf_mirror_push_duration_seconds_count{kind=\"metadata_manifest\"} 1\n")
+	assert.Regexp(t, `go_tuf_mirror_bytes_total\{direction="pushed"\} [1-9]`, out)
+}
+
+func TestAllNotify(t *testing.T) {
+	dir := t.TempDir()
+
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "internal", "test", "testdata", "test-repo"))))
+	defer server.Close()
+
+	secret := filepath.Join(dir, "secret")
+	require.NoError(t, os.WriteFile(secret, []byte("secret\n"), 0o600))
+	var events []*notify.Event
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.True(t, notify.Verify([]byte("secret"), body, r.Header.Get(notify.TimestampHeader), r.Header.Get(notify.SignatureHeader), time.Minute))
+		event := &notify.Event{}
+		assert.NoError(t, json.Unmarshal(body, event))
+		events = append(events, event)
+	}))
+	defer hook.Close()
+
+	file := filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(file, []byte{}, 0o600))
+
+	testCases := []struct {
+		name    string
+		targets string
+		url     string
+		err     string
+		changed int
+	}{
+		{"success", OCIPrefix + filepath.Join(dir, "targets"), hook.URL, "", 5},
+		// the manifests saved again by a second run are not changed
+		{"unchanged", OCIPrefix + filepath.Join(dir, "targets"), hook.URL, "", 0},
+		// a layout below a regular file cannot be written
+		{"failed targets", OCIPrefix + filepath.Join(file, "targets"), hook.URL, "error mirroring targets, metadata not published", 0},
+		{"invalid url", OCIPrefix + filepath.Join(dir, "targets"), "invalid", "invalid notify url: invalid", 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			events = nil
+			opts := defaultRootOptions()
+			opts.tufPath = t.TempDir()
+			opts.notifyURLs = []string{tc.url}
+			opts.notifySecret = secret
+			cmd := newAllCmd(opts)
+			b := bytes.NewBufferString("")
+			cmd.SetOut(b)
+			cmd.SetErr(b)
+			_ = cmd.Flags().Set("source-metadata", server.URL+"/metadata")
+			_ = cmd.Flags().Set("source-targets", server.URL+"/targets")
+			_ = cmd.Flags().Set("dest-metadata", OCIPrefix+filepath.Join(dir, "metadata"))
+			_ = cmd.Flags().Set("dest-targets", tc.targets)
+
+			err := cmd.ExecuteContext(context.Background())
+			if tc.url == "invalid" {
+				require.ErrorContains(t, err, tc.err)
+				assert.Empty(t, events)
+				return
+			}
+			require.Len(t, events, 1)
+			event := events[0]
+			assert.Equal(t, notify.RunEvent, event.Type)
+			assert.Equal(t, server.URL+"/metadata", event.Metadata)
+			assert.Equal(t, server.URL+"/targets", event.Targets)
+			assert.Contains(t, event.Roles, &notify.Role{Name: "timestamp", Version: 7})
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				assert.False(t, event.Success)
+				assert.Contains(t, event.Error, tc.err)
+				// metadata is not published, so it is not reported
+				require.Len(t, event.Destinations, 1)
+				assert.Equal(t, "targets", event.Destinations[0].Kind)
+				assert.False(t, event.Destinations[0].Success)
+				assert.NotEmpty(t, event.Destinations[0].Error)
+				return
+			}
 			require.NoError(t, err)
-			assert.Equal(t, expectedTargetsOutput, targetsOut)
+			assert.True(t, event.Success)
+			assert.Empty(t, event.Error)
+			require.Len(t, event.Destinations, 2)
+			assert.Equal(t, "targets", event.Destinations[0].Kind)
+			assert.Equal(t, tc.targets, event.Destinations[0].Location)
+			assert.True(t, event.Destinations[0].Success)
+			assert.Len(t, event.Destinations[0].Manifests, 5)
+			assert.Equal(t, filepath.Join(dir, "targets", targetFile), event.Destinations[0].Manifests[0].Name)
+			assert.True(t, strings.HasPrefix(event.Destinations[0].Manifests[0].Digest, "sha256:"))
+			assert.Len(t, event.Destinations[0].Changed, tc.changed)
+			assert.Equal(t, "metadata", event.Destinations[1].Kind)
+			assert.Len(t, event.Destinations[1].Manifests, 1)
+			assert.Len(t, event.Destinations[1].Changed, min(tc.changed, 1))
+			assert.Contains(t, b.String(), `msg="Sent notification" source=`+server.URL+"/metadata webhooks=1\n")
 		})
 	}
 }
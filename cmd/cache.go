@@ -0,0 +1,179 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/docker/go-tuf-mirror/internal/cache"
+	"github.com/spf13/cobra"
+)
+
+func newCacheCmd(opts *rootOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the local TUF cache, which holds the trusted metadata of every source in its own entry",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+	cmd.AddCommand(newCacheListCmd(opts))  // ls subcommand
+	cmd.AddCommand(newCacheCleanCmd(opts)) // clean subcommand
+	return cmd
+}
+
+type cacheListOptions struct {
+	format      string
+	rootOptions *rootOptions
+}
+
+func defaultCacheListOptions(opts *rootOptions) *cacheListOptions {
+	return &cacheListOptions{
+		format:      TableFormat,
+		rootOptions: opts,
+	}
+}
+
+func newCacheListCmd(opts *rootOptions) *cobra.Command {
+	o := defaultCacheListOptions(opts)
+
+	cmd := &cobra.Command{
+		Use:          "ls",
+		Aliases:      []string{"list"},
+		Short:        "List the entries of the local TUF cache",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         o.run,
+	}
+	cmd.PersistentFlags().StringVarP(&o.format, "format", "o", TableFormat, fmt.Sprintf("Output format [%s, %s]", TableFormat, JSONFormat))
+	return cmd
+}
+
+func (o *cacheListOptions) run(cmd *cobra.Command, args []string) error {
+	if o.format != TableFormat && o.format != JSONFormat {
+		return fmt.Errorf("unsupported output format: %s", o.format)
+	}
+	tufPath, err := o.rootOptions.getTUFPath()
+	if err != nil {
+		return err
+	}
+	entries, err := cache.List(tufPath)
+	if err != nil {
+		return err
+	}
+
+	if o.format == JSONFormat {
+		if entries == nil {
+			entries = []*cache.Entry{}
+		}
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	}
+	return writeCacheTable(cmd.OutOrStdout(), entries)
+}
+
+// writeCacheTable writes the entries of the TUF cache. Entries written before the cache was namespaced by
+// source have no known metadata location.
+func writeCacheTable(out io.Writer, entries []*cache.Entry) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tMETADATA\tROOT\tSIZE\tMODIFIED")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", shortDigest(e.Key), orUnknown(e.Metadata), shortDigest(orUnknown(e.Root)), e.Size, formatTime(e.Modified))
+	}
+	return w.Flush()
+}
+
+type cacheCleanOptions struct {
+	metadata    []string
+	rootOptions *rootOptions
+}
+
+func defaultCacheCleanOptions(opts *rootOptions) *cacheCleanOptions {
+	return &cacheCleanOptions{
+		rootOptions: opts,
+	}
+}
+
+func newCacheCleanCmd(opts *rootOptions) *cobra.Command {
+	o := defaultCacheCleanOptions(opts)
+
+	cmd := &cobra.Command{
+		Use:          "clean",
+		Short:        "Remove entries from the local TUF cache, entries in use by another run are skipped",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         o.run,
+	}
+	cmd.PersistentFlags().StringArrayVarP(&o.metadata, "metadata", "m", nil, "Only remove the entries of this metadata location, may be repeated (default all entries)")
+	return cmd
+}
+
+func (o *cacheCleanOptions) run(cmd *cobra.Command, args []string) error {
+	tufPath, err := o.rootOptions.getTUFPath()
+	if err != nil {
+		return err
+	}
+	entries, err := cache.List(tufPath)
+	if err != nil {
+		return err
+	}
+	sources := map[string]bool{}
+	for _, m := range o.metadata {
+		sources[strings.TrimSuffix(m, "/")] = true
+	}
+
+	removed := 0
+	for _, e := range entries {
+		if len(sources) > 0 && !sources[e.Metadata] {
+			continue
+		}
+		err = e.Remove()
+		if errors.Is(err, cache.ErrLocked) {
+			fmt.Fprintf(cmd.OutOrStdout(), "Skipped TUF cache %s of %s, in use by another run\n", shortDigest(e.Key), orUnknown(e.Metadata))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		removed++
+		fmt.Fprintf(cmd.OutOrStdout(), "Removed TUF cache %s of %s\n", shortDigest(e.Key), orUnknown(e.Metadata))
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Removed %d TUF cache entry(ies)\n", removed)
+	return nil
+}
+
+// shortDigest abbreviates a hex digest for display.
+func shortDigest(digest string) string {
+	if len(digest) > 12 {
+		return digest[:12]
+	}
+	return digest
+}
+
+// orUnknown returns s, or a placeholder if it is empty.
+func orUnknown(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
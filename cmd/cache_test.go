@@ -0,0 +1,101 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/go-tuf-mirror/internal/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheCmd(t *testing.T) {
+	handler := http.FileServer(http.Dir(filepath.Join("..", "internal", "test", "testdata", "test-repo")))
+	staging := httptest.NewServer(handler)
+	defer staging.Close()
+	prod := httptest.NewServer(handler)
+	defer prod.Close()
+
+	opts := defaultRootOptions()
+	opts.tufPath = t.TempDir()
+
+	// every source is cached in its own entry
+	for _, server := range []*httptest.Server{staging, prod} {
+		cmd := newMetadataCmd(opts)
+		cmd.SetOut(bytes.NewBufferString(""))
+		_ = cmd.PersistentFlags().Set("source", server.URL+"/metadata")
+		_ = cmd.PersistentFlags().Set("destination", OCIPrefix+filepath.Join(t.TempDir(), "metadata"))
+		require.NoError(t, cmd.Execute())
+	}
+
+	list := func() []*cache.Entry {
+		b := bytes.NewBufferString("")
+		cmd := newCacheListCmd(opts)
+		cmd.SetOut(b)
+		_ = cmd.PersistentFlags().Set("format", JSONFormat)
+		require.NoError(t, cmd.Execute())
+		var entries []*cache.Entry
+		require.NoError(t, json.Unmarshal(b.Bytes(), &entries))
+		return entries
+	}
+	entries := list()
+	require.Len(t, entries, 2)
+	sources := []string{entries[0].Metadata, entries[1].Metadata}
+	assert.ElementsMatch(t, []string{staging.URL + "/metadata", prod.URL + "/metadata"}, sources)
+	assert.Equal(t, entries[0].Root, entries[1].Root)
+	assert.NotEqual(t, entries[0].Key, entries[1].Key)
+
+	b := bytes.NewBufferString("")
+	cmd := newCacheListCmd(opts)
+	cmd.SetOut(b)
+	require.NoError(t, cmd.Execute())
+	assert.Contains(t, b.String(), "KEY  ")
+	assert.Contains(t, b.String(), staging.URL+"/metadata")
+
+	// clean a single source
+	b = bytes.NewBufferString("")
+	cmd = newCacheCleanCmd(opts)
+	cmd.SetOut(b)
+	_ = cmd.PersistentFlags().Set("metadata", staging.URL+"/metadata/")
+	require.NoError(t, cmd.Execute())
+	assert.Contains(t, b.String(), "Removed 1 TUF cache entry(ies)\n")
+	entries = list()
+	require.Len(t, entries, 1)
+	assert.Equal(t, prod.URL+"/metadata", entries[0].Metadata)
+
+	// entries in use by another run are skipped
+	lock, err := entries[0].Lock()
+	require.NoError(t, err)
+	b = bytes.NewBufferString("")
+	cmd = newCacheCleanCmd(opts)
+	cmd.SetOut(b)
+	require.NoError(t, cmd.Execute())
+	assert.Contains(t, b.String(), "in use by another run\n")
+	assert.Len(t, list(), 1)
+	require.NoError(t, lock.Unlock())
+
+	cmd = newCacheCleanCmd(opts)
+	cmd.SetOut(bytes.NewBufferString(""))
+	require.NoError(t, cmd.Execute())
+	assert.Empty(t, list())
+}
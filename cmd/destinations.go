@@ -0,0 +1,55 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/docker/go-tuf-mirror/pkg/tufmirror"
+)
+
+// parseDestinations returns the destinations of prefixed destination locations.
+func parseDestinations(locations []string) ([]tufmirror.Destination, error) {
+	destinations := make([]tufmirror.Destination, 0, len(locations))
+	for _, location := range locations {
+		dst, err := tufmirror.ParseDestination(location)
+		if err != nil {
+			return nil, err
+		}
+		destinations = append(destinations, dst)
+	}
+	return destinations, nil
+}
+
+// writeDestinationSummary reports the outcome of saving to each destination.
+// A single destination returns its error as is, multiple destinations are summarized and
+// an error is returned if any of them failed, after all of them were attempted.
+func writeDestinationSummary(out io.Writer, res *tufmirror.Result) error {
+	if len(res.Destinations) == 1 {
+		return res.Err()
+	}
+	fmt.Fprintln(out, "Destination summary:")
+	for _, r := range res.Destinations {
+		if r.Err != nil {
+			fmt.Fprintf(out, "  %s: failed: %s\n", r.Destination.Location(), r.Err)
+			continue
+		}
+		fmt.Fprintf(out, "  %s: ok\n", r.Destination.Location())
+	}
+	return res.Err()
+}
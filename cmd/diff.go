@@ -0,0 +1,202 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	mirrortuf "github.com/docker/go-tuf-mirror/internal/tuf"
+	"github.com/docker/go-tuf-mirror/pkg/tufmirror"
+	"github.com/spf13/cobra"
+)
+
+// ErrDifferences is returned by diff with --exit-code when the repositories differ.
+var ErrDifferences = errors.New("repositories differ")
+
+type diffOptions struct {
+	from        string
+	to          string
+	format      string
+	exitCode    bool
+	rootOptions *rootOptions
+}
+
+func defaultDiffOptions(opts *rootOptions) *diffOptions {
+	return &diffOptions{
+		format:      TableFormat,
+		rootOptions: opts,
+	}
+}
+
+func newDiffCmd(opts *rootOptions) *cobra.Command {
+	o := defaultDiffOptions(opts)
+
+	cmd := &cobra.Command{
+		Use:          "diff",
+		Short:        "Compare the roles and targets of two TUF repositories or mirrors",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         o.run,
+	}
+	cmd.PersistentFlags().StringVar(&o.from, "from", "", fmt.Sprintf("Metadata location to compare from %s<web>, %s<OCI layout>, %s<filesystem> or %s<remote registry>", WebPrefix, OCIPrefix, LocalPrefix, RegistryPrefix))
+	cmd.PersistentFlags().StringVar(&o.to, "to", "", fmt.Sprintf("Metadata location to compare to %s<web>, %s<OCI layout>, %s<filesystem> or %s<remote registry>", WebPrefix, OCIPrefix, LocalPrefix, RegistryPrefix))
+	cmd.PersistentFlags().StringVarP(&o.format, "format", "o", TableFormat, fmt.Sprintf("Output format [%s, %s]", TableFormat, JSONFormat))
+	cmd.PersistentFlags().BoolVar(&o.exitCode, "exit-code", false, "Exit with an error if the repositories differ")
+
+	err := cmd.MarkPersistentFlagRequired("from")
+	if err != nil {
+		log.Fatalf("failed to mark flag required: %s", err)
+	}
+	err = cmd.MarkPersistentFlagRequired("to")
+	if err != nil {
+		log.Fatalf("failed to mark flag required: %s", err)
+	}
+	return cmd
+}
+
+func (o *diffOptions) run(cmd *cobra.Command, args []string) error {
+	if o.format != TableFormat && o.format != JSONFormat {
+		return fmt.Errorf("unsupported output format: %s", o.format)
+	}
+	from, err := o.inspect(cmd, o.from)
+	if err != nil {
+		return err
+	}
+	to, err := o.inspect(cmd, o.to)
+	if err != nil {
+		return err
+	}
+	diff := mirrortuf.Compare(from, to)
+
+	if o.format == JSONFormat {
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		err = enc.Encode(diff)
+		if err != nil {
+			return err
+		}
+	} else {
+		writeDiff(cmd.OutOrStdout(), diff)
+	}
+	if o.exitCode && !diff.Empty() {
+		return ErrDifferences
+	}
+	return nil
+}
+
+// inspect performs a verified update against a metadata location.
+// Each side uses its own scratch TUF cache, so comparing an older mirror to a newer source is not
+// rejected as a rollback and the shared cache is left untouched.
+func (o *diffOptions) inspect(cmd *cobra.Command, location string) (*mirrortuf.Repository, error) {
+	src, err := tufmirror.ParseSource(location, "")
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	m, err := o.rootOptions.openMirror(cmd, src, true)
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+	repo, err := mirrortuf.Inspect(m.Client())
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect TUF repository %s: %w", location, err)
+	}
+	return repo, nil
+}
+
+// writeDiff writes a human readable summary of a diff.
+func writeDiff(out io.Writer, diff *mirrortuf.Diff) {
+	if diff.Empty() {
+		fmt.Fprintln(out, "No differences")
+		return
+	}
+	if len(diff.Roles) > 0 {
+		fmt.Fprintln(out, "Roles:")
+		for _, c := range diff.Roles {
+			switch c.Change {
+			case mirrortuf.Added:
+				fmt.Fprintf(out, "  + %s (version %d, expires %s)\n", c.Name, c.To.Version, formatTime(c.To.Expires))
+			case mirrortuf.Removed:
+				fmt.Fprintf(out, "  - %s (version %d)\n", c.Name, c.From.Version)
+			case mirrortuf.Modified:
+				fmt.Fprintf(out, "  ~ %s: %s\n", c.Name, strings.Join(roleChanges(c), ", "))
+			}
+		}
+	}
+	if len(diff.Targets) > 0 {
+		fmt.Fprintln(out, "Targets:")
+		for _, c := range diff.Targets {
+			switch c.Change {
+			case mirrortuf.Added:
+				fmt.Fprintf(out, "  + %s (%s, %d bytes, %s)\n", c.Path, c.To.Role, c.To.Length, formatHashes(c.To.Hashes))
+			case mirrortuf.Removed:
+				fmt.Fprintf(out, "  - %s (%s)\n", c.Path, c.From.Role)
+			case mirrortuf.Modified:
+				fmt.Fprintf(out, "  ~ %s: %s\n", c.Path, strings.Join(targetChanges(c), ", "))
+			}
+		}
+	}
+}
+
+func roleChanges(c *mirrortuf.RoleChange) []string {
+	var changes []string
+	if c.From.Version != c.To.Version {
+		changes = append(changes, fmt.Sprintf("version %d -> %d", c.From.Version, c.To.Version))
+	}
+	if c.ExpiryChanged() {
+		changes = append(changes, fmt.Sprintf("expires %s -> %s", formatTime(c.From.Expires), formatTime(c.To.Expires)))
+	}
+	if c.From.Threshold != c.To.Threshold {
+		changes = append(changes, fmt.Sprintf("threshold %d -> %d", c.From.Threshold, c.To.Threshold))
+	}
+	if c.From.Parent != c.To.Parent {
+		changes = append(changes, fmt.Sprintf("delegated by %s -> %s", c.From.Parent, c.To.Parent))
+	}
+	for _, k := range c.AddedKeys {
+		changes = append(changes, "key added "+k)
+	}
+	for _, k := range c.RemovedKeys {
+		changes = append(changes, "key removed "+k)
+	}
+	return changes
+}
+
+func targetChanges(c *mirrortuf.TargetChange) []string {
+	var changes []string
+	if c.From.Role != c.To.Role {
+		changes = append(changes, fmt.Sprintf("role %s -> %s", c.From.Role, c.To.Role))
+	}
+	if c.From.Length != c.To.Length {
+		changes = append(changes, fmt.Sprintf("length %d -> %d", c.From.Length, c.To.Length))
+	}
+	if from, to := formatHashes(c.From.Hashes), formatHashes(c.To.Hashes); from != to {
+		changes = append(changes, fmt.Sprintf("%s -> %s", from, to))
+	}
+	return changes
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,122 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	mirrortuf "github.com/docker/go-tuf-mirror/internal/tuf"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffCmd(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "internal", "test", "testdata", "test-repo"))))
+	defer server.Close()
+	serverMetadata := server.URL + "/metadata"
+	serverTargets := server.URL + "/targets"
+
+	reg := httptest.NewServer(registry.New(registry.WithReferrersSupport(false)))
+	defer reg.Close()
+	url, err := url.Parse(reg.URL)
+	require.NoError(t, err)
+	registryMetadata := RegistryPrefix + "localhost:" + url.Port() + "/test/metadata:latest"
+	registryTargets := RegistryPrefix + "localhost:" + url.Port() + "/test/targets"
+
+	populateMirror(t, serverMetadata, serverTargets, registryMetadata, registryTargets)
+
+	t.Run("web to registry mirror", func(t *testing.T) {
+		opts := defaultRootOptions()
+		opts.tufPath = t.TempDir()
+		cmd := newDiffCmd(opts)
+		b := bytes.NewBufferString("")
+		cmd.SetOut(b)
+		cmd.SetErr(io.Discard)
+		_ = cmd.PersistentFlags().Set("from", serverMetadata)
+		_ = cmd.PersistentFlags().Set("to", registryMetadata)
+		_ = cmd.PersistentFlags().Set("exit-code", "true")
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Equal(t, "No differences\n", b.String())
+		// scratch caches leave the TUF cache untouched
+		entries, err := os.ReadDir(opts.tufPath)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+		assert.Empty(t, opts.cacheLocks)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		cmd := newDiffCmd(defaultRootOptions())
+		b := bytes.NewBufferString("")
+		cmd.SetOut(b)
+		cmd.SetErr(io.Discard)
+		_ = cmd.PersistentFlags().Set("from", registryMetadata)
+		_ = cmd.PersistentFlags().Set("to", serverMetadata)
+		_ = cmd.PersistentFlags().Set("format", JSONFormat)
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		diff := &mirrortuf.Diff{}
+		require.NoError(t, json.Unmarshal(b.Bytes(), diff))
+		assert.True(t, diff.Empty())
+	})
+}
+
+func TestWriteDiff(t *testing.T) {
+	expires := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	from := &mirrortuf.Repository{
+		Roles: []*mirrortuf.Role{
+			{Name: "root", Version: 1, Expires: expires, Threshold: 1, KeyIDs: []string{"a"}},
+			{Name: "old-role", Parent: "targets", Version: 3, Expires: expires, Threshold: 1},
+		},
+		Targets: []*mirrortuf.Target{
+			{Path: "changed.txt", Role: "targets", Length: 1, Hashes: map[string]string{"sha256": "01"}},
+			{Path: "removed.txt", Role: "targets", Length: 1, Hashes: map[string]string{"sha256": "02"}},
+		},
+	}
+	to := &mirrortuf.Repository{
+		Roles: []*mirrortuf.Role{
+			{Name: "root", Version: 2, Expires: expires.AddDate(1, 0, 0), Threshold: 2, KeyIDs: []string{"b"}},
+		},
+		Targets: []*mirrortuf.Target{
+			{Path: "changed.txt", Role: "targets", Length: 2, Hashes: map[string]string{"sha256": "03"}},
+			{Path: "added.txt", Role: "targets", Length: 1, Hashes: map[string]string{"sha256": "04"}},
+		},
+	}
+
+	b := bytes.NewBufferString("")
+	writeDiff(b, mirrortuf.Compare(from, to))
+	assert.Equal(t, `Roles:
+  ~ root: version 1 -> 2, expires 2030-01-01T00:00:00Z -> 2031-01-01T00:00:00Z, threshold 1 -> 2, key added b, key removed a
+  - old-role (version 3)
+Targets:
+  ~ changed.txt: length 1 -> 2, sha256:01 -> sha256:03
+  + added.txt (targets, 1 bytes, sha256:04)
+  - removed.txt (targets)
+`, b.String())
+}
@@ -0,0 +1,105 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/attest/mirror"
+	"github.com/docker/go-tuf-mirror/pkg/tufmirror"
+	"github.com/spf13/cobra"
+)
+
+type getOptions struct {
+	metadata    string
+	targets     string
+	output      string
+	rootOptions *rootOptions
+}
+
+func defaultGetOptions(opts *rootOptions) *getOptions {
+	return &getOptions{
+		rootOptions: opts,
+	}
+}
+
+func newGetCmd(opts *rootOptions) *cobra.Command {
+	o := defaultGetOptions(opts)
+
+	cmd := &cobra.Command{
+		Use:          "get <target-path>",
+		Short:        "Fetch and verify a single TUF target from a TUF repository or mirror",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE:         o.run,
+	}
+	cmd.PersistentFlags().StringVarP(&o.metadata, "metadata", "m", mirror.DefaultMetadataURL, fmt.Sprintf("Metadata location %s<web>, %s<OCI layout>, %s<filesystem> or %s<remote registry>", WebPrefix, OCIPrefix, LocalPrefix, RegistryPrefix))
+	cmd.PersistentFlags().StringVar(&o.targets, "targets", mirror.DefaultTargetsURL, fmt.Sprintf("Targets location %s<web>, %s<OCI layout>, %s<filesystem> or %s<remote registry>", WebPrefix, OCIPrefix, LocalPrefix, RegistryPrefix))
+	cmd.PersistentFlags().StringVarP(&o.output, "output", "o", "-", "Output file, - for stdout")
+
+	err := cmd.MarkPersistentFlagRequired("metadata")
+	if err != nil {
+		log.Fatalf("failed to mark flag required: %s", err)
+	}
+	err = cmd.MarkPersistentFlagRequired("targets")
+	if err != nil {
+		log.Fatalf("failed to mark flag required: %s", err)
+	}
+	return cmd
+}
+
+func (o *getOptions) run(cmd *cobra.Command, args []string) error {
+	target := args[0]
+	src, err := tufmirror.ParseSource(o.metadata, o.targets)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	defer o.rootOptions.releaseCaches()
+	m, err := o.rootOptions.newMirror(cmd, src)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	// download into a scratch directory so a stale output file is never mistaken for a cached target
+	dir, err := os.MkdirTemp("", "go-tuf-mirror-get")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	file, err := m.Client().DownloadTarget(target, filepath.Join(dir, filepath.Base(target)))
+	if err != nil {
+		return fmt.Errorf("failed to get target %s: %w", target, err)
+	}
+	o.rootOptions.logger(cmd).Info("Verified target", "target", target, "length", len(file.Data), "digest", "sha256:"+file.Digest)
+
+	if o.output == "-" {
+		_, err = cmd.OutOrStdout().Write(file.Data)
+		return err
+	}
+	err = os.WriteFile(o.output, file.Data, 0o644) // #nosec G306
+	if err != nil {
+		return fmt.Errorf("failed to write target to %s: %w", o.output, err)
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Target %s saved to %s\n", target, o.output)
+	return nil
+}
@@ -0,0 +1,125 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetCmd(t *testing.T) {
+	testRepo := filepath.Join("..", "internal", "test", "testdata", "test-repo")
+	layoutDir := t.TempDir()
+	layoutMetadata := OCIPrefix + filepath.Join(layoutDir, "metadata")
+	layoutTargets := OCIPrefix + filepath.Join(layoutDir, "targets")
+
+	server := httptest.NewServer(http.FileServer(http.Dir(testRepo)))
+	defer server.Close()
+	serverMetadata := server.URL + "/metadata"
+	serverTargets := server.URL + "/targets"
+
+	reg := httptest.NewServer(registry.New(registry.WithReferrersSupport(false)))
+	defer reg.Close()
+	url, err := url.Parse(reg.URL)
+	require.NoError(t, err)
+	registryMetadata := RegistryPrefix + "localhost:" + url.Port() + "/test/metadata:latest"
+	registryTargets := RegistryPrefix + "localhost:" + url.Port() + "/test/targets"
+
+	populateMirror(t, serverMetadata, serverTargets, registryMetadata, registryTargets)
+	populateMirror(t, serverMetadata, serverTargets, layoutMetadata, layoutTargets)
+
+	topLevel, err := os.ReadFile(filepath.Join(testRepo, "targets", targetFile))
+	require.NoError(t, err)
+	delegated, err := os.ReadFile(filepath.Join(testRepo, "targets", "test-role", "dir1", "dir2", "dir3", "bb8fcf06f6c067dcbcb394d7d9ced788316fc02b715fe679097281108a4bd465.test.txt"))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		metadata string
+		targets  string
+		target   string
+		expected []byte
+	}{
+		{"web top-level target", serverMetadata, serverTargets, "test.txt", topLevel},
+		{"web delegated target", serverMetadata, serverTargets, "test-role/dir1/dir2/dir3/test.txt", delegated},
+		{"registry top-level target", registryMetadata, registryTargets, "test.txt", topLevel},
+		{"registry delegated target", registryMetadata, registryTargets, "test-role/dir1/dir2/dir3/test.txt", delegated},
+		{"oci layout top-level target", layoutMetadata, layoutTargets, "test.txt", topLevel},
+		{"oci layout delegated target", layoutMetadata, layoutTargets, "test-role/dir1/dir2/dir3/test.txt", delegated},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := defaultRootOptions()
+			opts.tufPath = t.TempDir()
+			cmd := newGetCmd(opts)
+			b := bytes.NewBufferString("")
+			cmd.SetOut(b)
+			cmd.SetErr(io.Discard)
+			cmd.SetArgs([]string{tc.target})
+			_ = cmd.PersistentFlags().Set("metadata", tc.metadata)
+			_ = cmd.PersistentFlags().Set("targets", tc.targets)
+
+			err := cmd.Execute()
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, b.Bytes())
+		})
+	}
+
+	t.Run("output file", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "test.txt")
+		opts := defaultRootOptions()
+		opts.tufPath = t.TempDir()
+		cmd := newGetCmd(opts)
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+		cmd.SetArgs([]string{"test.txt"})
+		_ = cmd.PersistentFlags().Set("metadata", serverMetadata)
+		_ = cmd.PersistentFlags().Set("targets", serverTargets)
+		_ = cmd.PersistentFlags().Set("output", output)
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		data, err := os.ReadFile(output)
+		require.NoError(t, err)
+		assert.Equal(t, topLevel, data)
+	})
+
+	t.Run("unknown target", func(t *testing.T) {
+		opts := defaultRootOptions()
+		opts.tufPath = t.TempDir()
+		cmd := newGetCmd(opts)
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+		cmd.SetArgs([]string{"does-not-exist.txt"})
+		_ = cmd.PersistentFlags().Set("metadata", serverMetadata)
+		_ = cmd.PersistentFlags().Set("targets", serverTargets)
+
+		err := cmd.Execute()
+		require.Error(t, err)
+	})
+}
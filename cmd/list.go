@@ -0,0 +1,143 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/docker/attest/mirror"
+	mirrortuf "github.com/docker/go-tuf-mirror/internal/tuf"
+	"github.com/docker/go-tuf-mirror/pkg/tufmirror"
+	"github.com/spf13/cobra"
+)
+
+const (
+	TableFormat = "table"
+	JSONFormat  = "json"
+)
+
+type listOptions struct {
+	metadata    string
+	targets     string
+	format      string
+	rootOptions *rootOptions
+}
+
+func defaultListOptions(opts *rootOptions) *listOptions {
+	return &listOptions{
+		format:      TableFormat,
+		rootOptions: opts,
+	}
+}
+
+func newListCmd(opts *rootOptions) *cobra.Command {
+	o := defaultListOptions(opts)
+
+	cmd := &cobra.Command{
+		Use:          "list",
+		Short:        "List the roles and targets of a TUF repository or mirror",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         o.run,
+	}
+	cmd.PersistentFlags().StringVarP(&o.metadata, "metadata", "m", mirror.DefaultMetadataURL, fmt.Sprintf("Metadata location %s<web>, %s<OCI layout>, %s<filesystem> or %s<remote registry>", WebPrefix, OCIPrefix, LocalPrefix, RegistryPrefix))
+	cmd.PersistentFlags().StringVar(&o.targets, "targets", "", "Targets location, only needed to fetch targets")
+	cmd.PersistentFlags().StringVarP(&o.format, "format", "o", TableFormat, fmt.Sprintf("Output format [%s, %s]", TableFormat, JSONFormat))
+
+	err := cmd.MarkPersistentFlagRequired("metadata")
+	if err != nil {
+		log.Fatalf("failed to mark flag required: %s", err)
+	}
+	return cmd
+}
+
+func (o *listOptions) run(cmd *cobra.Command, args []string) error {
+	if o.format != TableFormat && o.format != JSONFormat {
+		return fmt.Errorf("unsupported output format: %s", o.format)
+	}
+	src, err := tufmirror.ParseSource(o.metadata, o.targets)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	defer o.rootOptions.releaseCaches()
+	m, err := o.rootOptions.newMirror(cmd, src)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	repo, err := mirrortuf.Inspect(m.Client())
+	if err != nil {
+		return fmt.Errorf("failed to inspect TUF repository: %w", err)
+	}
+
+	if o.format == JSONFormat {
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		return enc.Encode(repo)
+	}
+	return writeRepositoryTable(cmd.OutOrStdout(), repo)
+}
+
+// writeRepositoryTable writes the role tree followed by the targets of a repository.
+func writeRepositoryTable(out io.Writer, repo *mirrortuf.Repository) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ROLE\tVERSION\tEXPIRES\tTHRESHOLD\tKEYS")
+	for _, role := range repo.Roles {
+		indent := strings.Repeat("  ", roleDepth(repo, role))
+		fmt.Fprintf(w, "%s%s\t%d\t%s\t%d\t%d\n", indent, role.Name, role.Version, formatTime(role.Expires), role.Threshold, len(role.KeyIDs))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "TARGET\tROLE\tLENGTH\tHASHES")
+	for _, t := range repo.Targets {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", t.Path, t.Role, t.Length, formatHashes(t.Hashes))
+	}
+	return w.Flush()
+}
+
+// roleDepth returns the delegation depth of a role, top-level roles have depth 0.
+func roleDepth(repo *mirrortuf.Repository, role *mirrortuf.Role) int {
+	depth := 0
+	for role.Parent != "" {
+		role = repo.Role(role.Parent)
+		if role == nil {
+			break
+		}
+		depth++
+	}
+	return depth
+}
+
+func formatHashes(hashes map[string]string) string {
+	algs := make([]string, 0, len(hashes))
+	for alg := range hashes {
+		algs = append(algs, alg)
+	}
+	sort.Strings(algs)
+	out := make([]string, 0, len(algs))
+	for _, alg := range algs {
+		out = append(out, alg+":"+hashes[alg])
+	}
+	return strings.Join(out, ",")
+}
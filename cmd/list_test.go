@@ -0,0 +1,130 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	mirrortuf "github.com/docker/go-tuf-mirror/internal/tuf"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListCmd(t *testing.T) {
+	layoutDir := t.TempDir()
+	layoutMetadata := OCIPrefix + filepath.Join(layoutDir, "metadata")
+	layoutTargets := OCIPrefix + filepath.Join(layoutDir, "targets")
+
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "internal", "test", "testdata", "test-repo"))))
+	defer server.Close()
+	serverMetadata := server.URL + "/metadata"
+	serverTargets := server.URL + "/targets"
+
+	reg := httptest.NewServer(registry.New(registry.WithReferrersSupport(false)))
+	defer reg.Close()
+	url, err := url.Parse(reg.URL)
+	require.NoError(t, err)
+	registryMetadata := RegistryPrefix + "localhost:" + url.Port() + "/test/metadata:latest"
+	registryTargets := RegistryPrefix + "localhost:" + url.Port() + "/test/targets"
+
+	// populate registry and layout mirrors
+	populateMirror(t, serverMetadata, serverTargets, registryMetadata, registryTargets)
+	populateMirror(t, serverMetadata, serverTargets, layoutMetadata, layoutTargets)
+
+	testCases := []struct {
+		name     string
+		metadata string
+		targets  string
+	}{
+		{"web", serverMetadata, serverTargets},
+		{"registry", registryMetadata, registryTargets},
+		{"oci layout", layoutMetadata, layoutTargets},
+		{"filesystem", LocalPrefix + filepath.Join("..", "internal", "test", "testdata", "test-repo", "metadata"), ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := defaultRootOptions()
+			opts.tufPath = t.TempDir()
+			cmd := newListCmd(opts)
+			b := bytes.NewBufferString("")
+			cmd.SetOut(b)
+			cmd.SetErr(io.Discard)
+			_ = cmd.PersistentFlags().Set("metadata", tc.metadata)
+			_ = cmd.PersistentFlags().Set("targets", tc.targets)
+			_ = cmd.PersistentFlags().Set("format", JSONFormat)
+
+			err := cmd.Execute()
+			require.NoError(t, err)
+
+			repo := &mirrortuf.Repository{}
+			require.NoError(t, json.Unmarshal(b.Bytes(), repo))
+			var roles []string
+			for _, r := range repo.Roles {
+				roles = append(roles, r.Name)
+			}
+			assert.Equal(t, []string{"root", "timestamp", "snapshot", "targets", "test-role"}, roles)
+			assert.Equal(t, int64(2), repo.Role("root").Version)
+			assert.Equal(t, "targets", repo.Role("test-role").Parent)
+			assert.Len(t, repo.Targets, 7)
+			for _, target := range repo.Targets {
+				if target.Path == "test-role/test.txt" {
+					assert.Equal(t, "test-role", target.Role)
+					assert.Equal(t, "d1bb6181284970ae43fbbc88b5e72f9a5942ebac20588aa0c4bf78ba621e1ee2", target.Hashes["sha256"])
+				}
+			}
+		})
+	}
+
+	t.Run("table", func(t *testing.T) {
+		opts := defaultRootOptions()
+		opts.tufPath = t.TempDir()
+		cmd := newListCmd(opts)
+		b := bytes.NewBufferString("")
+		cmd.SetOut(b)
+		cmd.SetErr(io.Discard)
+		_ = cmd.PersistentFlags().Set("metadata", serverMetadata)
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Contains(t, b.String(), "  test-role")
+		assert.Contains(t, b.String(), "sha256:02119a076ec3878c736c3a95e20794f5a8d5bce3d7ecc264681bb7334ca2e24b")
+	})
+}
+
+// populateMirror mirrors metadata and targets, including delegations, to the given destinations.
+func populateMirror(t *testing.T, srcMeta, srcTargets, dstMeta, dstTargets string) {
+	t.Helper()
+	opts := defaultRootOptions()
+	opts.tufPath = t.TempDir()
+	opts.full = true
+	cmd := newAllCmd(opts)
+	cmd.SetOut(io.Discard)
+	_ = cmd.Flags().Set("source-metadata", srcMeta)
+	_ = cmd.Flags().Set("source-targets", srcTargets)
+	_ = cmd.Flags().Set("dest-metadata", dstMeta)
+	_ = cmd.Flags().Set("dest-targets", dstTargets)
+	require.NoError(t, cmd.Execute())
+}
@@ -18,28 +18,42 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"log"
-	"os"
-	"path/filepath"
+	"log/slog"
 	"strings"
 
 	"github.com/docker/attest/mirror"
-	"github.com/docker/attest/oci"
+	"github.com/docker/go-tuf-mirror/internal/annotations"
+	"github.com/docker/go-tuf-mirror/internal/reproducible"
+	"github.com/docker/go-tuf-mirror/internal/sign"
 	mirrortuf "github.com/docker/go-tuf-mirror/internal/tuf"
 	"github.com/docker/go-tuf-mirror/internal/util"
-	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/docker/go-tuf-mirror/pkg/tufmirror"
 	"github.com/spf13/cobra"
 )
 
 type metadataOptions struct {
-	targets     string
-	source      string
-	destination string
-	rootOptions *rootOptions
+	targets      string
+	source       string
+	destinations []string
+	versionTags  bool
+	dateTag      bool
+	delegatedTag string
+	roles        []string
+	signKey      string
+	signMode     string
+	provenance   bool
+	provFile     string
+	annotations  []string
+	requireRoot  bool
+	approveRoot  string
+	rootOptions  *rootOptions
 }
 
 func defaultMetadataOptions(opts *rootOptions) *metadataOptions {
 	return &metadataOptions{
+		signMode:    sign.TagMode,
 		rootOptions: opts,
 	}
 }
@@ -55,7 +69,18 @@ func newMetadataCmd(opts *rootOptions) *cobra.Command {
 	}
 	cmd.PersistentFlags().StringVarP((&o.targets), "targets", "m", mirror.DefaultTargetsURL, fmt.Sprintf("Source targets location %s<web>, %s<OCI layout>, %s<filesystem> or %s<remote registry>", WebPrefix, OCIPrefix, LocalPrefix, RegistryPrefix))
 	cmd.PersistentFlags().StringVarP(&o.source, "source", "s", mirror.DefaultMetadataURL, fmt.Sprintf("Source metadata location %s<web>, %s<OCI layout>, %s<filesystem> or %s<remote registry>", WebPrefix, OCIPrefix, LocalPrefix, RegistryPrefix))
-	cmd.PersistentFlags().StringVarP(&o.destination, "destination", "d", "", fmt.Sprintf("Destination metadata location %s<OCI layout>, %s<filesystem> or %s<remote registry>", OCIPrefix, LocalPrefix, RegistryPrefix))
+	cmd.PersistentFlags().StringArrayVarP(&o.destinations, "destination", "d", nil, fmt.Sprintf("Destination metadata location %s<OCI layout>, %s<filesystem> or %s<remote registry>, may be repeated", OCIPrefix, LocalPrefix, RegistryPrefix))
+	cmd.PersistentFlags().BoolVar(&o.versionTags, "version-tags", false, "Also tag the metadata manifest with the timestamp and root versions (ts-<version>, root-<version>)")
+	cmd.PersistentFlags().BoolVar(&o.dateTag, "date-tag", false, "Also tag the metadata manifest with the current UTC date (date-<yyyymmdd>)")
+	cmd.PersistentFlags().StringVar(&o.delegatedTag, "delegated-tag-template", "", "Go template for delegated metadata tags with .Name, the role name (default <role>)")
+	cmd.PersistentFlags().StringArrayVar(&o.roles, "role", nil, "Only mirror delegated roles matching this glob pattern, may be repeated")
+	cmd.PersistentFlags().StringVar(&o.signKey, "sign-key", "", "PEM encoded ECDSA or ED25519 private key to sign every mirrored manifest with, encrypted keys use COSIGN_PASSWORD")
+	cmd.PersistentFlags().StringVar(&o.signMode, "sign-mode", sign.TagMode, fmt.Sprintf("Where registries store signatures [%s, %s]", sign.TagMode, sign.ReferrerMode))
+	cmd.PersistentFlags().BoolVar(&o.provenance, "provenance", false, "Attach an in-toto provenance attestation of the run to the metadata manifest as an OCI referrer")
+	cmd.PersistentFlags().StringVar(&o.provFile, "provenance-file", "", "Write an in-toto provenance statement of the run to this file")
+	cmd.PersistentFlags().StringArrayVar(&o.annotations, "annotation", nil, "Annotation key=value to add to every mirrored manifest, may be repeated")
+	cmd.PersistentFlags().BoolVar(&o.requireRoot, "require-approval-on-root-change", false, "Fail when root keys or thresholds changed since the previously mirrored root, until the new root is approved with --approve-root")
+	cmd.PersistentFlags().StringVar(&o.approveRoot, "approve-root", "", "Digest of a new root whose key and threshold changes are approved, as printed in the root change summary")
 
 	err := cmd.MarkPersistentFlagRequired("source")
 	if err != nil {
@@ -69,98 +94,152 @@ func newMetadataCmd(opts *rootOptions) *cobra.Command {
 }
 
 func (o *metadataOptions) run(cmd *cobra.Command, args []string) error {
-	// only support web to registry or oci layout for now
+	return o.rootOptions.mirrorRun(cmd, o, nil)
+}
+
+// metadataRun is a validated metadata mirroring run.
+type metadataRun struct {
+	source       string
+	locations    []string
+	destinations []tufmirror.Destination
+	options      *tufmirror.MetadataOptions
+	provFile     string
+	requireRoot  bool
+	approveRoot  string
+}
+
+// validate checks the options and returns the run they describe, before anything is mirrored.
+func (o *metadataOptions) validate() (*metadataRun, error) {
+	// only support web sources for now
 	if !strings.HasPrefix(o.source, WebPrefix) && !strings.HasPrefix(o.source, InsecureWebPrefix) {
-		return fmt.Errorf("source not implemented: %s", o.source)
+		return nil, fmt.Errorf("source not implemented: %s", o.source)
 	}
-	if !(strings.HasPrefix(o.destination, RegistryPrefix) || strings.HasPrefix(o.destination, OCIPrefix)) {
-		return fmt.Errorf("destination not implemented: %s", o.destination)
+	if !util.IsValidUrl(o.source) {
+		return nil, fmt.Errorf("invalid source url: %s", o.source)
 	}
-	if strings.HasPrefix(o.destination, RegistryPrefix) && strings.Contains(o.destination, "@") {
-		return fmt.Errorf("destination registry reference should not have a digest: %s", o.destination)
+	destinations, err := parseDestinations(o.destinations)
+	if err != nil {
+		return nil, err
 	}
-	if !util.IsValidUrl(o.source) {
-		return fmt.Errorf("invalid source url: %s", o.source)
+	signer, err := tufmirror.LoadSigner(o.signKey, o.signMode)
+	if err != nil {
+		return nil, err
 	}
-	var tufPath string
-	if o.rootOptions.tufPath == "" {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return fmt.Errorf("failed to get user home directory: %w", err)
-		}
-		tufPath = filepath.Join(home, ".docker", "tuf")
-	} else {
-		tufPath = strings.TrimSpace(o.rootOptions.tufPath)
+	custom, err := annotations.Parse(o.annotations)
+	if err != nil {
+		return nil, err
 	}
-
-	fmt.Fprintf(cmd.OutOrStdout(), "Mirroring TUF metadata %s to %s\n", o.source, o.destination)
-
-	// Fetch root.json from source instead of using embedded root
-	rootURL := strings.TrimSuffix(o.source, "/") + "/1.root.json"
-	fmt.Fprintf(cmd.OutOrStdout(), "Fetching initial root from %s\n", rootURL)
-	rootData, err := util.HTTPGet(rootURL)
+	created, err := reproducible.SourceDateEpoch()
 	if err != nil {
-		return fmt.Errorf("failed to fetch root from source: %w", err)
+		return nil, err
 	}
+	return &metadataRun{
+		source:       o.source,
+		locations:    o.destinations,
+		destinations: destinations,
+		options: &tufmirror.MetadataOptions{
+			Full:                 o.rootOptions.full,
+			Roles:                o.roles,
+			VersionTags:          o.versionTags,
+			DateTag:              o.dateTag,
+			DelegatedTagTemplate: o.delegatedTag,
+			Signer:               signer,
+			Provenance:           o.provenance,
+			Annotations:          custom,
+			Created:              created,
+		},
+		provFile:    o.provFile,
+		requireRoot: o.requireRoot,
+		approveRoot: o.approveRoot,
+	}, nil
+}
+
+// mirror saves the metadata of the mirror opened by open to every destination. The result is nil if nothing
+// was mirrored.
+func (r *metadataRun) mirror(cmd *cobra.Command, log *slog.Logger, open func() (*tufmirror.Mirror, error)) (*tufmirror.Result, error) {
+	log.Info("Mirroring TUF metadata", "source", r.source, "destinations", strings.Join(r.locations, ", "))
 
-	m, err := mirror.NewTUFMirror(cmd.Context(), rootData, tufPath, o.source, o.targets, &mirrortuf.NullVersionChecker{})
+	m, err := open()
 	if err != nil {
-		return fmt.Errorf("failed to create TUF mirror: %w", err)
+		return nil, err
 	}
-	// set mirror in root options for reuse in targets
-	o.rootOptions.mirror = m
-
-	// create metadata image
-	image, err := m.GetMetadataManifest(o.source)
+	res, err := m.MirrorMetadata(cmd.Context(), r.destinations, r.options)
 	if err != nil {
-		return fmt.Errorf("failed to create metadata manifest: %w", err)
+		return nil, err
 	}
-
-	// create delegated metadata manifests
-	var delegated []*mirror.Image
-	if o.rootOptions.full {
-		delegated, err = m.GetDelegatedMetadataMirrors()
+	if r.provFile != "" {
+		err = writeProvenance(log, r.provFile, res.Provenance)
 		if err != nil {
-			return fmt.Errorf("failed to create delegated metadata manifests: %w", err)
+			return res, err
 		}
 	}
+	return res, writeDestinationSummary(cmd.OutOrStdout(), res)
+}
 
-	// save metadata manifest
-	switch {
-	case strings.HasPrefix(o.destination, OCIPrefix):
-		path := strings.TrimPrefix(o.destination, OCIPrefix)
-		err = oci.SaveImageAsOCILayout(image, path)
-		if err != nil {
-			return fmt.Errorf("failed to save metadata as OCI layout: %w", err)
+// checkRoot compares the trusted root with the root previously mirrored to the destinations or trusted by the
+// cache and prints how keys and thresholds changed. If approval is required, a root with changed keys or
+// thresholds is only mirrored once its digest is approved. A root that passes the check is accepted by the cache,
+// so that the next run reports changes since this root. It runs when the mirror is opened, before targets
+// mirrored along with the metadata are written.
+func (r *metadataRun) checkRoot(cmd *cobra.Command, log *slog.Logger, m *tufmirror.Mirror) error {
+	previous, err := m.PreviousRoot(cmd.Context(), r.destinations)
+	if err != nil {
+		// without approval the comparison is only informative, with approval an unreadable root must not pass
+		if r.requireRoot {
+			return err
 		}
-		fmt.Fprintf(cmd.OutOrStdout(), "Metadata manifest layout saved to %s\n", path)
-		for _, d := range delegated {
-			path := filepath.Join(path, d.Tag)
-			err = oci.SaveImageAsOCILayout(d.Image, path)
-			if err != nil {
-				return fmt.Errorf("failed to save delegated metadata as OCI layout: %w", err)
-			}
-			fmt.Fprintf(cmd.OutOrStdout(), "Delegated metadata manifest layout saved to %s\n", path)
+		log.Warn("Failed to read previous root", "error", err)
+		return nil
+	}
+	if previous == nil {
+		log.Debug("No previous root to compare")
+		return m.AcceptRoot()
+	}
+	root, err := m.TrustedRoot()
+	if err != nil {
+		return err
+	}
+	rotation, err := mirrortuf.CompareRoots(previous.Data, root)
+	if err != nil {
+		return err
+	}
+	log.Info("Compared root", "previous", previous.Location, "from_version", rotation.FromVersion, "to_version", rotation.ToVersion, "rotated", rotation.Rotated())
+	if rotation.FromVersion == rotation.ToVersion && !rotation.Rotated() {
+		return m.AcceptRoot()
+	}
+	writeRootRotation(cmd.OutOrStdout(), previous.Location, rotation)
+	if !rotation.Rotated() || !r.requireRoot {
+		return m.AcceptRoot()
+	}
+	approved := r.approveRoot
+	if approved != "" && !strings.HasPrefix(approved, "sha256:") {
+		approved = "sha256:" + approved
+	}
+	if approved != rotation.Digest {
+		return fmt.Errorf("root keys or thresholds changed from version %d to %d, review the changes and approve the new root with --approve-root %s", rotation.FromVersion, rotation.ToVersion, rotation.Digest)
+	}
+	log.Info("Approved root", "version", rotation.ToVersion, "digest", rotation.Digest)
+	return m.AcceptRoot()
+}
+
+// writeRootRotation prints the key and threshold changes of each role of a new root.
+func writeRootRotation(out io.Writer, previous string, rotation *mirrortuf.RootRotation) {
+	fmt.Fprintf(out, "Root changed from version %d to %d since %s:\n", rotation.FromVersion, rotation.ToVersion, previous)
+	fmt.Fprintf(out, "  digest: %s\n", rotation.Digest)
+	if !rotation.Rotated() {
+		fmt.Fprintln(out, "  keys and thresholds unchanged")
+		return
+	}
+	for _, role := range rotation.Roles {
+		fmt.Fprintf(out, "  %s:\n", role.Name)
+		if role.ThresholdChanged() {
+			fmt.Fprintf(out, "    threshold: %d -> %d\n", role.FromThreshold, role.ToThreshold)
 		}
-	case strings.HasPrefix(o.destination, RegistryPrefix):
-		imageName := strings.TrimPrefix(o.destination, RegistryPrefix)
-		err = oci.PushImageToRegistry(cmd.Context(), image, imageName)
-		if err != nil {
-			return fmt.Errorf("failed to push metadata manifest: %w", err)
+		for _, k := range role.AddedKeys {
+			fmt.Fprintf(out, "    added key: %s\n", k)
 		}
-		fmt.Fprintf(cmd.OutOrStdout(), "Metadata manifest pushed to %s\n", imageName)
-		for _, d := range delegated {
-			ref, err := name.ParseReference(imageName)
-			if err != nil {
-				return fmt.Errorf("failed to parse image name: %w", err)
-			}
-			imageName := fmt.Sprintf("%s:%s", ref.Context().Name(), d.Tag)
-			err = oci.PushImageToRegistry(cmd.Context(), d.Image, imageName)
-			if err != nil {
-				return fmt.Errorf("failed to push delegated metadata manifest: %w", err)
-			}
-			fmt.Fprintf(cmd.OutOrStdout(), "Delegated metadata manifest pushed to %s\n", imageName)
+		for _, k := range role.RemovedKeys {
+			fmt.Fprintf(out, "    removed key: %s\n", k)
 		}
 	}
-	return nil
 }
@@ -18,6 +18,9 @@ package cmd
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -25,12 +28,21 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/docker/go-tuf-mirror/internal/annotations"
+	"github.com/docker/go-tuf-mirror/internal/cache"
+	"github.com/docker/go-tuf-mirror/internal/provenance"
+	"github.com/docker/go-tuf-mirror/internal/reproducible"
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	slsa "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -66,35 +78,33 @@ func TestMetadataCmd(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			var operation string
 			var output string
-			var delegatedOutput string
+			var delegatedOutput []string
 			if strings.HasPrefix(tc.destination, RegistryPrefix) {
-				operation = "pushed"
 				ref, err := name.ParseReference(strings.TrimPrefix(tc.destination, RegistryPrefix))
 				require.NoError(t, err)
 				output = ref.Name()
 				for _, d := range DelegatedTargetNames {
-					delegatedOutput += fmt.Sprintf("Delegated metadata manifest %s to %s\n", operation, strings.Join([]string{ref.Context().Name(), d}, ":"))
+					delegatedOutput = append(delegatedOutput, savedLog("Delegated metadata manifest", strings.Join([]string{ref.Context().Name(), d}, ":")))
 				}
 			} else {
-				operation = "layout saved"
 				output = strings.TrimPrefix(tc.destination, OCIPrefix)
 				for _, d := range DelegatedTargetNames {
-					delegatedOutput += fmt.Sprintf("Delegated metadata manifest %s to %s\n", operation, filepath.Join(output, d))
+					delegatedOutput = append(delegatedOutput, savedLog("Delegated metadata manifest", filepath.Join(output, d)))
 				}
 			}
-			expectedOutput := fmt.Sprintf("Mirroring TUF metadata %s to %s\nFetching initial root from %s/1.root.json\nMetadata manifest %s to %s\n",
-				tc.source,
-				tc.destination,
-				tc.source,
-				operation,
-				output)
+			expectedLogs := []string{
+				fmt.Sprintf("msg=\"Mirroring TUF metadata\" source=%s destinations=%s\n", tc.source, tc.destination),
+				fmt.Sprintf("msg=\"Fetching initial root\" root=%s/1.root.json\n", tc.source),
+				"msg=\"Verified TUF metadata\" ",
+				savedLog("Metadata manifest", output),
+			}
 			if tc.full {
-				expectedOutput += delegatedOutput
+				expectedLogs = append(expectedLogs, delegatedOutput...)
 			}
 
 			b := bytes.NewBufferString("")
+			logs := bytes.NewBufferString("")
 			opts := defaultRootOptions()
 			opts.full = tc.full
 			opts.tufRoot = "dev"
@@ -103,15 +113,19 @@ func TestMetadataCmd(t *testing.T) {
 				t.Fatal("newMetadataCmd returned nil")
 			}
 			cmd.SetOut(b)
+			cmd.SetErr(logs)
 			_ = cmd.PersistentFlags().Set("source", tc.source)
 			_ = cmd.PersistentFlags().Set("destination", tc.destination)
 
 			err := cmd.Execute()
 			require.NoError(t, err)
 
-			out, err := io.ReadAll(b)
-			require.NoError(t, err)
-			assert.Equal(t, expectedOutput, string(out))
+			// a single destination has no results to report
+			assert.Empty(t, b.String())
+			assertLogged(t, logs.String(), expectedLogs...)
+			if !tc.full {
+				assert.NotContains(t, logs.String(), "Delegated metadata manifest")
+			}
 
 			// check that index was saved to oci layout
 			if strings.HasPrefix(tc.destination, OCIPrefix) {
@@ -135,3 +149,484 @@ func TestMetadataCmd(t *testing.T) {
 		})
 	}
 }
+
+func TestMetadataCmdVersionTags(t *testing.T) {
+	layoutDir := t.TempDir()
+
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "internal", "test", "testdata", "test-repo"))))
+	defer server.Close()
+	serverMetadata := server.URL + "/metadata"
+
+	reg := httptest.NewServer(registry.New(registry.WithReferrersSupport(false)))
+	defer reg.Close()
+	url, err := url.Parse(reg.URL)
+	require.NoError(t, err)
+	repo := "localhost:" + url.Port() + "/test/metadata"
+
+	dateTag := "date-" + time.Now().UTC().Format("20060102")
+	expectedTags := []string{"ts-7", "root-2", dateTag}
+
+	testCases := []struct {
+		name        string
+		destination string
+		tags        func(t *testing.T) []string
+	}{
+		{"registry", RegistryPrefix + repo + ":latest", func(t *testing.T) []string {
+			ref, err := name.NewRepository(repo)
+			require.NoError(t, err)
+			tags, err := remote.List(ref)
+			require.NoError(t, err)
+			return tags
+		}},
+		{"oci layout", OCIPrefix + layoutDir, func(t *testing.T) []string {
+			var tags []string
+			for _, tag := range expectedTags {
+				_, err := os.Stat(filepath.Join(layoutDir, tag, "index.json"))
+				if err == nil {
+					tags = append(tags, tag)
+				}
+			}
+			return tags
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := bytes.NewBufferString("")
+			opts := defaultRootOptions()
+			opts.tufPath = t.TempDir()
+			cmd := newMetadataCmd(opts)
+			cmd.SetOut(b)
+			cmd.SetErr(b)
+			_ = cmd.PersistentFlags().Set("source", serverMetadata)
+			_ = cmd.PersistentFlags().Set("destination", tc.destination)
+			_ = cmd.PersistentFlags().Set("version-tags", "true")
+			_ = cmd.PersistentFlags().Set("date-tag", "true")
+
+			err := cmd.Execute()
+			require.NoError(t, err)
+			assert.Contains(t, b.String(), "ts-7 ")
+			assert.Contains(t, b.String(), "root-2 ")
+			assert.Contains(t, b.String(), dateTag+" ")
+			assert.Subset(t, tc.tags(t), expectedTags)
+		})
+	}
+}
+
+func TestMetadataCmdDelegatedTagTemplate(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "internal", "test", "testdata", "test-repo"))))
+	defer server.Close()
+	serverMetadata := server.URL + "/metadata"
+
+	reg := httptest.NewServer(registry.New(registry.WithReferrersSupport(false)))
+	defer reg.Close()
+	url, err := url.Parse(reg.URL)
+	require.NoError(t, err)
+	repo := "localhost:" + url.Port() + "/test/metadata"
+
+	testCases := []struct {
+		name     string
+		template string
+		output   string
+		err      string
+	}{
+		{"role prefix", "role-{{.Name}}", savedLog("Delegated metadata manifest", repo+":role-test-role"), ""},
+		{"collision with metadata tag", "latest", "", "collides"},
+		{"invalid tag", "-{{.Name}}", "", "does not match the OCI tag grammar"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := bytes.NewBufferString("")
+			opts := defaultRootOptions()
+			opts.full = true
+			opts.tufPath = t.TempDir()
+			cmd := newMetadataCmd(opts)
+			cmd.SetOut(b)
+			cmd.SetErr(b)
+			_ = cmd.PersistentFlags().Set("source", serverMetadata)
+			_ = cmd.PersistentFlags().Set("destination", RegistryPrefix+repo+":latest")
+			_ = cmd.PersistentFlags().Set("delegated-tag-template", tc.template)
+
+			err := cmd.Execute()
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				assert.NotContains(t, b.String(), "Saved manifest")
+				return
+			}
+			require.NoError(t, err)
+			assert.Contains(t, b.String(), tc.output)
+		})
+	}
+}
+
+func TestMetadataCmdProvenance(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "internal", "test", "testdata", "test-repo"))))
+	defer server.Close()
+	serverMetadata := server.URL + "/metadata"
+
+	reg := httptest.NewServer(registry.New(registry.WithReferrersSupport(false)))
+	defer reg.Close()
+	url, err := url.Parse(reg.URL)
+	require.NoError(t, err)
+	repo := "localhost:" + url.Port() + "/test/provenance"
+	provenanceFile := filepath.Join(t.TempDir(), "provenance.json")
+
+	b := bytes.NewBufferString("")
+	opts := defaultRootOptions()
+	opts.tufPath = t.TempDir()
+	opts.full = true
+	opts.version = "v1.2.3"
+	cmd := newMetadataCmd(opts)
+	cmd.SetOut(b)
+	cmd.SetErr(b)
+	_ = cmd.PersistentFlags().Set("source", serverMetadata)
+	_ = cmd.PersistentFlags().Set("destination", RegistryPrefix+repo+":latest")
+	_ = cmd.PersistentFlags().Set("provenance", "true")
+	_ = cmd.PersistentFlags().Set("provenance-file", provenanceFile)
+
+	err = cmd.Execute()
+	require.NoError(t, err)
+	assert.Contains(t, b.String(), `msg="Saved manifest" kind="Provenance attestation" name=`+repo+"@sha256:")
+	assert.Contains(t, b.String(), `msg="Wrote provenance statement" path=`+provenanceFile+"\n")
+
+	ref, err := name.ParseReference(repo + ":latest")
+	require.NoError(t, err)
+	desc, err := remote.Head(ref)
+	require.NoError(t, err)
+
+	// the statement written to the file names the run and its outputs
+	data, err := os.ReadFile(provenanceFile)
+	require.NoError(t, err)
+	statement := new(intoto.Statement)
+	require.NoError(t, json.Unmarshal(data, statement))
+	assert.Equal(t, slsa.PredicateSLSAProvenance, statement.PredicateType)
+	subjects := map[string]string{}
+	for _, s := range statement.Subject {
+		subjects[s.Name] = s.Digest["sha256"]
+	}
+	assert.Equal(t, desc.Digest.Hex, subjects[repo+":latest"])
+	assert.Contains(t, subjects, repo+":test-role")
+
+	var predicate struct {
+		Predicate struct {
+			BuildDefinition struct {
+				ExternalParameters   provenance.ExternalParameters `json:"externalParameters"`
+				InternalParameters   provenance.InternalParameters `json:"internalParameters"`
+				ResolvedDependencies []slsa.ResourceDescriptor     `json:"resolvedDependencies"`
+			} `json:"buildDefinition"`
+			RunDetails slsa.ProvenanceRunDetails `json:"runDetails"`
+		} `json:"predicate"`
+	}
+	require.NoError(t, json.Unmarshal(data, &predicate))
+	build := predicate.Predicate.BuildDefinition
+	assert.Equal(t, serverMetadata, build.ExternalParameters.Metadata)
+	assert.Equal(t, []string{RegistryPrefix + repo + ":latest"}, build.ExternalParameters.Destinations)
+	require.Len(t, build.ResolvedDependencies, 1)
+	assert.Equal(t, serverMetadata+"/1.root.json", build.ResolvedDependencies[0].URI)
+	assert.Equal(t, "v1.2.3", predicate.Predicate.RunDetails.Builder.Version["go-tuf-mirror"])
+	versions := map[string]int64{}
+	for _, role := range build.InternalParameters.Roles {
+		versions[role.Name] = role.Version
+	}
+	assert.Equal(t, map[string]int64{"root": 2, "timestamp": 7, "snapshot": 7, "targets": 8, "test-role": 2}, versions)
+
+	// the attestation is discoverable as a referrer of the metadata manifest
+	index, err := remote.Referrers(ref.Context().Digest(desc.Digest.String()))
+	require.NoError(t, err)
+	manifest, err := index.IndexManifest()
+	require.NoError(t, err)
+	require.Len(t, manifest.Manifests, 1)
+	assert.Equal(t, provenance.ArtifactType, manifest.Manifests[0].ArtifactType)
+}
+
+func TestMetadataCmdAnnotations(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "internal", "test", "testdata", "test-repo"))))
+	defer server.Close()
+	serverMetadata := server.URL + "/metadata"
+
+	reg := httptest.NewServer(registry.New(registry.WithReferrersSupport(false)))
+	defer reg.Close()
+	url, err := url.Parse(reg.URL)
+	require.NoError(t, err)
+	repo := "localhost:" + url.Port() + "/test/annotations"
+	t.Setenv(reproducible.SourceDateEpochEnv, "1700000000")
+
+	opts := defaultRootOptions()
+	opts.tufPath = t.TempDir()
+	opts.full = true
+	opts.version = "v1.2.3"
+	cmd := newMetadataCmd(opts)
+	cmd.SetOut(bytes.NewBufferString(""))
+	_ = cmd.PersistentFlags().Set("source", serverMetadata)
+	_ = cmd.PersistentFlags().Set("destination", RegistryPrefix+repo+":latest")
+	_ = cmd.PersistentFlags().Set("annotation", "org.example.team=tuf")
+	_ = cmd.PersistentFlags().Set("annotation", annotations.Version+"=custom")
+	_ = cmd.PersistentFlags().Set("delegated-tag-template", "role-{{.Name}}")
+
+	err = cmd.Execute()
+	require.NoError(t, err)
+
+	testCases := []struct {
+		tag     string
+		role    string
+		version string
+	}{
+		{"latest", "timestamp", "7"},
+		{"role-test-role", "test-role", "2"},
+	}
+	for _, tc := range testCases {
+		ref, err := name.ParseReference(repo + ":" + tc.tag)
+		require.NoError(t, err)
+		img, err := remote.Image(ref)
+		require.NoError(t, err)
+		manifest, err := img.Manifest()
+		require.NoError(t, err)
+		assert.Equal(t, serverMetadata, manifest.Annotations[annotations.Source])
+		assert.Equal(t, "2023-11-14T22:13:20Z", manifest.Annotations[annotations.Created])
+		assert.Equal(t, "custom", manifest.Annotations[annotations.Version])
+		assert.Equal(t, "tuf", manifest.Annotations["org.example.team"])
+		assert.Equal(t, tc.role, manifest.Annotations[annotations.Role])
+		assert.Equal(t, tc.version, manifest.Annotations[annotations.RoleVersion])
+	}
+
+	cmd = newMetadataCmd(opts)
+	cmd.SetOut(bytes.NewBufferString(""))
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+	_ = cmd.PersistentFlags().Set("source", serverMetadata)
+	_ = cmd.PersistentFlags().Set("destination", RegistryPrefix+repo+":latest")
+	_ = cmd.PersistentFlags().Set("annotation", "invalid")
+	assert.ErrorContains(t, cmd.Execute(), "invalid annotation")
+}
+
+func TestMetadataCmdReproducible(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "internal", "test", "testdata", "test-repo"))))
+	defer server.Close()
+	serverMetadata := server.URL + "/metadata"
+
+	testCases := []struct {
+		name            string
+		sourceDateEpoch string
+	}{
+		{"without SOURCE_DATE_EPOCH", ""},
+		{"with SOURCE_DATE_EPOCH", "1700000000"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(reproducible.SourceDateEpochEnv, tc.sourceDateEpoch)
+
+			// mirror twice, each time with a fresh TUF cache
+			var digests []map[string]string
+			for i := 0; i < 2; i++ {
+				layoutDir := t.TempDir()
+				opts := defaultRootOptions()
+				opts.tufPath = t.TempDir()
+				opts.full = true
+				cmd := newMetadataCmd(opts)
+				cmd.SetOut(bytes.NewBufferString(""))
+				_ = cmd.PersistentFlags().Set("source", serverMetadata)
+				_ = cmd.PersistentFlags().Set("destination", OCIPrefix+layoutDir)
+				_ = cmd.PersistentFlags().Set("annotation", "org.example.team=tuf")
+				require.NoError(t, cmd.Execute())
+				// wait for the clock to move on, so time dependent output would differ
+				time.Sleep(time.Second)
+
+				run := map[string]string{}
+				for _, role := range []string{"", DelegatedTargetNames[0]} {
+					p, err := layout.FromPath(filepath.Join(layoutDir, role))
+					require.NoError(t, err)
+					index, err := p.ImageIndex()
+					require.NoError(t, err)
+					manifest, err := index.IndexManifest()
+					require.NoError(t, err)
+					require.Len(t, manifest.Manifests, 1)
+					run[role] = manifest.Manifests[0].Digest.String()
+				}
+				digests = append(digests, run)
+			}
+			assert.Equal(t, digests[0], digests[1])
+		})
+	}
+}
+
+func TestMetadataCmdEphemeral(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "internal", "test", "testdata", "test-repo"))))
+	defer server.Close()
+
+	tmp := t.TempDir()
+	for _, env := range []string{"TMPDIR", "TMP", "TEMP"} {
+		t.Setenv(env, tmp)
+	}
+	opts := defaultRootOptions()
+	opts.tufPath = filepath.Join(t.TempDir(), "tuf")
+	opts.ephemeral = true
+
+	for i := 0; i < 2; i++ {
+		b := bytes.NewBufferString("")
+		cmd := newMetadataCmd(opts)
+		cmd.SetOut(b)
+		cmd.SetErr(b)
+		_ = cmd.PersistentFlags().Set("source", server.URL+"/metadata")
+		_ = cmd.PersistentFlags().Set("destination", OCIPrefix+filepath.Join(t.TempDir(), "metadata"))
+		require.NoError(t, cmd.Execute())
+		// trust starts from the initial root on every run
+		assert.Contains(t, b.String(), `msg="Fetching initial root" root=`+server.URL+"/metadata/1.root.json\n")
+		// the temporary cache is removed with the mirror
+		caches, err := filepath.Glob(filepath.Join(tmp, "go-tuf-mirror-cache*"))
+		require.NoError(t, err)
+		assert.Empty(t, caches)
+	}
+	// nothing is written to the TUF cache
+	_, err := os.Stat(opts.tufPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestMetadataCmdRootChange(t *testing.T) {
+	testRepo := filepath.Join("..", "internal", "test", "testdata", "test-repo")
+	server := httptest.NewServer(http.FileServer(http.Dir(testRepo)))
+	defer server.Close()
+	source := server.URL + "/metadata"
+	root1, err := os.ReadFile(filepath.Join(testRepo, "metadata", "1.root.json"))
+	require.NoError(t, err)
+
+	// version 2 of the test root adds a key to the root and targets roles
+	const addedKey = "beac5394"
+	digest := regexp.MustCompile(`digest: (sha256:[0-9a-f]{64})\n`)
+
+	// destination is a filesystem mirror holding only version 1 of the root
+	previousMirror := func(t *testing.T) string {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "1.root.json"), root1, 0o600))
+		return dir
+	}
+	run := func(t *testing.T, opts *rootOptions, destination string, flags map[string]string) (string, error) {
+		b := bytes.NewBufferString("")
+		cmd := newMetadataCmd(opts)
+		cmd.SetOut(b)
+		cmd.SetErr(io.Discard)
+		_ = cmd.PersistentFlags().Set("source", source)
+		_ = cmd.PersistentFlags().Set("destination", destination)
+		for k, v := range flags {
+			require.NoError(t, cmd.PersistentFlags().Set(k, v))
+		}
+		err := cmd.Execute()
+		return b.String(), err
+	}
+
+	t.Run("report", func(t *testing.T) {
+		opts := defaultRootOptions()
+		opts.tufPath = t.TempDir()
+		dir := previousMirror(t)
+		out, err := run(t, opts, LocalPrefix+dir, nil)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(out, "Root changed from version 1 to 2 since "+LocalPrefix+dir+":\n"), out)
+		assert.Contains(t, out, "  root:\n    added key: "+addedKey)
+		assert.Contains(t, out, "  targets:\n    added key: "+addedKey)
+		assert.NotContains(t, out, "threshold")
+		assert.NotContains(t, out, "  timestamp:")
+
+		// the mirrored root is the previous root of the next run
+		out, err = run(t, opts, LocalPrefix+dir, nil)
+		require.NoError(t, err)
+		assert.Empty(t, out)
+	})
+
+	t.Run("require approval", func(t *testing.T) {
+		opts := defaultRootOptions()
+		opts.tufPath = t.TempDir()
+		dir := previousMirror(t)
+		flags := map[string]string{"require-approval-on-root-change": "true"}
+		out, err := run(t, opts, LocalPrefix+dir, flags)
+		require.ErrorContains(t, err, "root keys or thresholds changed from version 1 to 2, review the changes and approve the new root with --approve-root sha256:")
+		match := digest.FindStringSubmatch(out)
+		require.NotNil(t, match, out)
+		assert.Contains(t, err.Error(), match[1])
+		// the digest can be checked against the published root file
+		root2, rerr := os.ReadFile(filepath.Join(testRepo, "metadata", "2.root.json"))
+		require.NoError(t, rerr)
+		sum := sha256.Sum256(root2)
+		assert.Equal(t, "sha256:"+hex.EncodeToString(sum[:]), match[1])
+		// nothing is mirrored until the root is approved
+		_, err = os.Stat(filepath.Join(dir, "2.root.json"))
+		assert.True(t, os.IsNotExist(err))
+
+		flags["approve-root"] = "sha256:" + strings.Repeat("0", 64)
+		_, err = run(t, opts, LocalPrefix+dir, flags)
+		require.ErrorContains(t, err, "approve the new root with --approve-root "+match[1])
+
+		flags["approve-root"] = strings.TrimPrefix(match[1], "sha256:")
+		_, err = run(t, opts, LocalPrefix+dir, flags)
+		require.NoError(t, err)
+		_, err = os.Stat(filepath.Join(dir, "2.root.json"))
+		require.NoError(t, err)
+	})
+
+	t.Run("cache", func(t *testing.T) {
+		opts := defaultRootOptions()
+		opts.tufPath = t.TempDir()
+		// the cache trusted version 1 of the root before this run
+		entry := cache.New(opts.tufPath, source, root1)
+		sum := sha256.Sum256(root1)
+		rootDir := filepath.Join(entry.Path, hex.EncodeToString(sum[:]))
+		require.NoError(t, os.MkdirAll(rootDir, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(rootDir, "root.json"), root1, 0o600))
+
+		out, err := run(t, opts, LocalPrefix+t.TempDir(), nil)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(out, "Root changed from version 1 to 2 since "+entry.Path+":\n"), out)
+		assert.Contains(t, out, "  root:\n    added key: "+addedKey)
+
+		// the reported root is accepted by the cache
+		out, err = run(t, opts, LocalPrefix+t.TempDir(), nil)
+		require.NoError(t, err)
+		assert.Empty(t, out)
+	})
+
+	t.Run("cache requires approval", func(t *testing.T) {
+		opts := defaultRootOptions()
+		opts.tufPath = t.TempDir()
+		entry := cache.New(opts.tufPath, source, root1)
+		sum := sha256.Sum256(root1)
+		rootDir := filepath.Join(entry.Path, hex.EncodeToString(sum[:]))
+		require.NoError(t, os.MkdirAll(rootDir, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(rootDir, "root.json"), root1, 0o600))
+
+		// the cache trusts the new root after the first run, but it stays unapproved
+		flags := map[string]string{"require-approval-on-root-change": "true"}
+		for i := 0; i < 2; i++ {
+			out, err := run(t, opts, LocalPrefix+t.TempDir(), flags)
+			require.ErrorContains(t, err, "root keys or thresholds changed from version 1 to 2")
+			assert.True(t, strings.HasPrefix(out, "Root changed from version 1 to 2 since "+entry.Path+":\n"), out)
+		}
+
+		out, err := run(t, opts, LocalPrefix+t.TempDir(), flags)
+		require.Error(t, err)
+		match := digest.FindStringSubmatch(out)
+		require.NotNil(t, match, out)
+		flags["approve-root"] = match[1]
+		_, err = run(t, opts, LocalPrefix+t.TempDir(), flags)
+		require.NoError(t, err)
+
+		// the approved root is the previous root of the next run
+		delete(flags, "approve-root")
+		out, err = run(t, opts, LocalPrefix+t.TempDir(), flags)
+		require.NoError(t, err)
+		assert.Empty(t, out)
+	})
+
+	t.Run("unreadable destination", func(t *testing.T) {
+		// a registry denying access is not the same as a registry without a previous root
+		reg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		defer reg.Close()
+		url, err := url.Parse(reg.URL)
+		require.NoError(t, err)
+		opts := defaultRootOptions()
+		opts.tufPath = t.TempDir()
+		_, err = run(t, opts, RegistryPrefix+"localhost:"+url.Port()+"/test/metadata:latest", map[string]string{"require-approval-on-root-change": "true"})
+		require.ErrorContains(t, err, "failed to read previous root from "+RegistryPrefix+"localhost:"+url.Port()+"/test/metadata:latest")
+	})
+}
@@ -0,0 +1,112 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/docker/attest/mirror"
+	"github.com/docker/go-tuf-mirror/pkg/tufmirror"
+	"github.com/spf13/cobra"
+)
+
+type pruneOptions struct {
+	targets     string
+	metadata    string
+	keep        int
+	dryRun      bool
+	rootOptions *rootOptions
+}
+
+func defaultPruneOptions(opts *rootOptions) *pruneOptions {
+	return &pruneOptions{
+		dryRun:      true,
+		rootOptions: opts,
+	}
+}
+
+func newPruneCmd(opts *rootOptions) *cobra.Command {
+	o := defaultPruneOptions(opts)
+
+	cmd := &cobra.Command{
+		Use:          "prune",
+		Short:        "Delete mirrored target tags that are no longer referenced by the TUF targets metadata",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         o.run,
+	}
+	cmd.PersistentFlags().StringVarP(&o.metadata, "metadata", "m", mirror.DefaultMetadataURL, fmt.Sprintf("Metadata location %s<web>, %s<OCI layout>, %s<filesystem> or %s<remote registry>", WebPrefix, OCIPrefix, LocalPrefix, RegistryPrefix))
+	cmd.PersistentFlags().StringVar(&o.targets, "targets", "", fmt.Sprintf("Mirrored targets location to prune %s<OCI layout>, %s<filesystem> or %s<remote registry>", OCIPrefix, LocalPrefix, RegistryPrefix))
+	cmd.PersistentFlags().IntVar(&o.keep, "keep", 0, "Number of previous generations of each target to keep")
+	cmd.PersistentFlags().BoolVar(&o.dryRun, "dry-run", true, "Only report the tags that would be deleted")
+
+	err := cmd.MarkPersistentFlagRequired("metadata")
+	if err != nil {
+		log.Fatalf("failed to mark flag required: %s", err)
+	}
+	err = cmd.MarkPersistentFlagRequired("targets")
+	if err != nil {
+		log.Fatalf("failed to mark flag required: %s", err)
+	}
+	return cmd
+}
+
+func (o *pruneOptions) run(cmd *cobra.Command, args []string) error {
+	dst, err := tufmirror.ParseDestination(o.targets)
+	if err != nil {
+		return err
+	}
+	src, err := tufmirror.ParseSource(o.metadata, "")
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	defer o.rootOptions.releaseCaches()
+	m, err := o.rootOptions.newMirror(cmd, src)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	res, err := m.Prune(cmd.Context(), dst, o.keep, o.dryRun)
+	if err != nil {
+		return err
+	}
+	writePruneResult(cmd.OutOrStdout(), res)
+	return nil
+}
+
+// writePruneResult reports the target and signature tags that were pruned, or would be pruned by a dry run.
+func writePruneResult(out io.Writer, res *tufmirror.PruneResult) {
+	for _, tag := range res.Pruned {
+		if res.DryRun {
+			fmt.Fprintf(out, "Would delete target tag %s\n", tag)
+			continue
+		}
+		fmt.Fprintf(out, "Deleted target tag %s\n", tag)
+	}
+	for _, tag := range res.Signatures {
+		if res.DryRun {
+			fmt.Fprintf(out, "Would delete signature tag %s\n", tag)
+			continue
+		}
+		fmt.Fprintf(out, "Deleted signature tag %s\n", tag)
+	}
+	fmt.Fprintf(out, "%d stale target tag(s), %d target tag(s) kept\n", len(res.Pruned), len(res.Kept))
+}
@@ -0,0 +1,239 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/attest/oci"
+	"github.com/docker/go-tuf-mirror/internal/sign"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const staleTargetTag = "0000000000000000000000000000000000000000000000000000000000000000.test.txt"
+
+func TestPruneCmd(t *testing.T) {
+	layoutDir := t.TempDir()
+	layoutMetadata := OCIPrefix + filepath.Join(layoutDir, "metadata")
+	layoutTargets := OCIPrefix + filepath.Join(layoutDir, "targets")
+
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "internal", "test", "testdata", "test-repo"))))
+	defer server.Close()
+	serverMetadata := server.URL + "/metadata"
+	serverTargets := server.URL + "/targets"
+
+	reg := httptest.NewServer(registry.New(registry.WithReferrersSupport(false)))
+	defer reg.Close()
+	url, err := url.Parse(reg.URL)
+	require.NoError(t, err)
+	registryMetadata := RegistryPrefix + "localhost:" + url.Port() + "/test/metadata:latest"
+	registryTargets := RegistryPrefix + "localhost:" + url.Port() + "/test/targets"
+
+	populateMirror(t, serverMetadata, serverTargets, registryMetadata, registryTargets)
+	populateMirror(t, serverMetadata, serverTargets, layoutMetadata, layoutTargets)
+
+	// add a signed stale target tag, an unrelated tag and an unrelated signature tag to each destination
+	stale, err := random.Image(16, 1)
+	require.NoError(t, err)
+	digest, err := stale.Digest()
+	require.NoError(t, err)
+	staleSignatureTag := sign.SignatureTag(digest)
+	unrelatedSignatureTag := sign.SignatureTag(v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("0", 64)})
+	images := map[string]v1.Image{
+		staleTargetTag:        stale,
+		staleSignatureTag:     empty.Image,
+		"unrelated":           empty.Image,
+		unrelatedSignatureTag: empty.Image,
+	}
+	for tag, img := range images {
+		err = oci.PushImageToRegistry(context.Background(), img, strings.TrimPrefix(registryTargets, RegistryPrefix)+":"+tag)
+		require.NoError(t, err)
+		err = oci.SaveImageAsOCILayout(img, filepath.Join(strings.TrimPrefix(layoutTargets, OCIPrefix), tag))
+		require.NoError(t, err)
+	}
+
+	testCases := []struct {
+		name     string
+		metadata string
+		targets  string
+		tags     func(t *testing.T) []string
+	}{
+		{"registry", serverMetadata, registryTargets, func(t *testing.T) []string {
+			repo, err := name.NewRepository(strings.TrimPrefix(registryTargets, RegistryPrefix))
+			require.NoError(t, err)
+			tags, err := remote.List(repo)
+			require.NoError(t, err)
+			return tags
+		}},
+		{"oci layout", layoutMetadata, layoutTargets, func(t *testing.T) []string {
+			entries, err := os.ReadDir(strings.TrimPrefix(layoutTargets, OCIPrefix))
+			require.NoError(t, err)
+			var tags []string
+			for _, e := range entries {
+				tags = append(tags, e.Name())
+			}
+			return tags
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// dry run by default
+			opts := defaultRootOptions()
+			opts.tufPath = t.TempDir()
+			cmd := newPruneCmd(opts)
+			b := bytes.NewBufferString("")
+			cmd.SetOut(b)
+			_ = cmd.PersistentFlags().Set("metadata", tc.metadata)
+			_ = cmd.PersistentFlags().Set("targets", tc.targets)
+
+			err := cmd.Execute()
+			require.NoError(t, err)
+			assert.Contains(t, b.String(), "Would delete target tag "+staleTargetTag+"\n")
+			assert.Contains(t, b.String(), "Would delete signature tag "+staleSignatureTag+"\n")
+			assert.Contains(t, b.String(), "1 stale target tag(s), 5 target tag(s) kept\n")
+			assert.Contains(t, tc.tags(t), staleTargetTag)
+			assert.Contains(t, tc.tags(t), staleSignatureTag)
+
+			// delete
+			cmd = newPruneCmd(opts)
+			b = bytes.NewBufferString("")
+			cmd.SetOut(b)
+			_ = cmd.PersistentFlags().Set("metadata", tc.metadata)
+			_ = cmd.PersistentFlags().Set("targets", tc.targets)
+			_ = cmd.PersistentFlags().Set("dry-run", "false")
+
+			err = cmd.Execute()
+			require.NoError(t, err)
+			assert.Contains(t, b.String(), "Deleted target tag "+staleTargetTag+"\n")
+			assert.Contains(t, b.String(), "Deleted signature tag "+staleSignatureTag+"\n")
+			tags := tc.tags(t)
+			assert.NotContains(t, tags, staleTargetTag)
+			assert.NotContains(t, tags, staleSignatureTag)
+			assert.Contains(t, tags, "unrelated")
+			assert.Contains(t, tags, unrelatedSignatureTag)
+			assert.Contains(t, tags, "test-role")
+			assert.Contains(t, tags, targetFile)
+		})
+	}
+}
+
+func TestTargetsCmdPrune(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "internal", "test", "testdata", "test-repo"))))
+	defer server.Close()
+
+	reg := httptest.NewServer(registry.New(registry.WithReferrersSupport(false)))
+	defer reg.Close()
+	url, err := url.Parse(reg.URL)
+	require.NoError(t, err)
+	repo := "localhost:" + url.Port() + "/test/targets"
+	err = oci.PushImageToRegistry(context.Background(), empty.Image, repo+":"+staleTargetTag)
+	require.NoError(t, err)
+
+	opts := defaultRootOptions()
+	opts.tufPath = t.TempDir()
+	cmd := newTargetsCmd(opts)
+	cmd.SetOut(io.Discard)
+	_ = cmd.PersistentFlags().Set("metadata", server.URL+"/metadata")
+	_ = cmd.PersistentFlags().Set("source", server.URL+"/targets")
+	_ = cmd.PersistentFlags().Set("destination", RegistryPrefix+repo)
+	_ = cmd.PersistentFlags().Set("prune", "true")
+	_ = cmd.PersistentFlags().Set("prune-dry-run", "false")
+
+	err = cmd.Execute()
+	require.NoError(t, err)
+	ref, err := name.NewRepository(repo)
+	require.NoError(t, err)
+	tags, err := remote.List(ref)
+	require.NoError(t, err)
+	assert.NotContains(t, tags, staleTargetTag)
+	assert.Contains(t, tags, targetFile)
+}
+
+func TestAllPrune(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "internal", "test", "testdata", "test-repo"))))
+	defer server.Close()
+	dir := t.TempDir()
+
+	// a layout below a regular file cannot be written
+	file := filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(file, []byte{}, 0o600))
+
+	testCases := []struct {
+		name     string
+		metadata string
+		err      string
+	}{
+		{"metadata failed", OCIPrefix + filepath.Join(file, "metadata"), "error mirroring metadata"},
+		{"metadata published", OCIPrefix + filepath.Join(dir, "metadata"), ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reg := httptest.NewServer(registry.New(registry.WithReferrersSupport(false)))
+			defer reg.Close()
+			url, err := url.Parse(reg.URL)
+			require.NoError(t, err)
+			repo := "localhost:" + url.Port() + "/test/targets"
+			err = oci.PushImageToRegistry(context.Background(), empty.Image, repo+":"+staleTargetTag)
+			require.NoError(t, err)
+
+			opts := defaultRootOptions()
+			opts.tufPath = t.TempDir()
+			cmd := newAllCmd(opts)
+			cmd.SetOut(io.Discard)
+			cmd.SetErr(io.Discard)
+			_ = cmd.Flags().Set("source-metadata", server.URL+"/metadata")
+			_ = cmd.Flags().Set("source-targets", server.URL+"/targets")
+			_ = cmd.Flags().Set("dest-metadata", tc.metadata)
+			_ = cmd.Flags().Set("dest-targets", RegistryPrefix+repo)
+			_ = cmd.Flags().Set("prune", "true")
+			_ = cmd.Flags().Set("prune-dry-run", "false")
+
+			err = cmd.ExecuteContext(context.Background())
+			ref, rerr := name.NewRepository(repo)
+			require.NoError(t, rerr)
+			tags, rerr := remote.List(ref)
+			require.NoError(t, rerr)
+			assert.Contains(t, tags, targetFile)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				// the published metadata may still reference stale targets
+				assert.Contains(t, tags, staleTargetTag)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotContains(t, tags, staleTargetTag)
+		})
+	}
+}
@@ -19,53 +19,215 @@ package cmd
 import (
 	"context"
 	_ "embed"
+	"errors"
 	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
 
-	"github.com/docker/attest/mirror"
 	"github.com/docker/attest/useragent"
+	"github.com/docker/go-tuf-mirror/internal/cache"
+	"github.com/docker/go-tuf-mirror/internal/logging"
+	"github.com/docker/go-tuf-mirror/internal/metrics"
+	"github.com/docker/go-tuf-mirror/internal/notify"
+	"github.com/docker/go-tuf-mirror/pkg/tufmirror"
 	"github.com/spf13/cobra"
 )
 
 const (
-	OCIPrefix         = "oci://"    // filesystem oci layout
-	RegistryPrefix    = "docker://" // remote registry
-	LocalPrefix       = "file://"   // local filesystem
-	WebPrefix         = "https://"  // web
-	InsecureWebPrefix = "http://"   // insecure web
+	OCIPrefix         = tufmirror.OCIPrefix         // filesystem oci layout
+	RegistryPrefix    = tufmirror.RegistryPrefix    // remote registry
+	LocalPrefix       = tufmirror.LocalPrefix       // local filesystem
+	WebPrefix         = tufmirror.WebPrefix         // web
+	InsecureWebPrefix = tufmirror.InsecureWebPrefix // insecure web
 )
 
 type rootOptions struct {
-	tufPath string
-	tufRoot string
-	mirror  *mirror.TUFMirror
-	full    bool
+	logLevel     string
+	logFormat    string
+	log          *slog.Logger
+	metrics      *metrics.Metrics
+	textfile     string // node-exporter textfile the metrics are written to after a run
+	notifyURLs   []string
+	notifySecret string            // file holding the HMAC secret of notifications
+	notified     map[string]string // state of the last notification of each run delivered to each webhook in watch mode, nil outside of it
+	tufPath      string
+	tufRoot      string
+	rootFile     string
+	ephemeral    bool
+	cacheLocks   []*cache.Lock
+	full         bool
+	version      string
 }
 
 func defaultRootOptions() *rootOptions {
-	return &rootOptions{}
+	return &rootOptions{
+		metrics: metrics.New(),
+	}
 }
 
 func newRootCmd(version string) *cobra.Command {
 	o := defaultRootOptions()
+	o.version = version
 	cmd := &cobra.Command{
 		Use:   "go-tuf-mirror",
 		Short: "Mirror TUF metadata to and between OCI registries, filesystems etc",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			o.log, err = logging.New(cmd.ErrOrStderr(), o.logLevel, o.logFormat)
+			return err
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return cmd.Help()
 		},
 	}
+	cmd.PersistentFlags().StringVar(&o.logLevel, "log-level", logging.DefaultLevel, "Log level [debug, info, warn, error], logs are written to stderr")
+	cmd.PersistentFlags().StringVar(&o.logFormat, "log-format", logging.DefaultFormat, fmt.Sprintf("Log format [%s, %s]", logging.TextFormat, logging.JSONFormat))
+	cmd.PersistentFlags().StringVar(&o.textfile, "metrics-textfile", "", "Write Prometheus metrics of the run to this file for the node-exporter textfile collector")
+	cmd.PersistentFlags().StringArrayVar(&o.notifyURLs, "notify-url", nil, "Webhook to POST a JSON event to after each run, may be repeated")
+	cmd.PersistentFlags().StringVar(&o.notifySecret, "notify-secret-file", "", fmt.Sprintf("File holding a secret to sign notifications with, the HMAC-SHA256 of the timestamp in %s and the body is sent in %s", notify.TimestampHeader, notify.SignatureHeader))
 	cmd.PersistentFlags().StringVarP(&o.tufPath, "tuf-path", "t", "", "path on filesystem for tuf root")
 	cmd.PersistentFlags().BoolVarP(&o.full, "full", "f", false, "Mirror full metadata/targets (includes delegated targets)")
 	cmd.PersistentFlags().StringVarP(&o.tufRoot, "tuf-root", "r", "", "specify embedded tuf root [dev, staging, prod], default [prod]")
+	cmd.PersistentFlags().BoolVar(&o.ephemeral, "ephemeral", false, "Use a temporary TUF cache discarded after the run instead of --tuf-path, so no trusted state is kept between runs")
+	cmd.PersistentFlags().StringVar(&o.rootFile, "root-file", "", "Trusted root metadata file, default fetches the initial root from the source")
 
 	cmd.AddCommand(newMetadataCmd(o))      // metadata subcommand
 	cmd.AddCommand(newTargetsCmd(o))       // targets subcommand
 	cmd.AddCommand(newVersionCmd(version)) // version subcommand
 	cmd.AddCommand(newAllCmd(o))           // all subcommand
+	cmd.AddCommand(newListCmd(o))          // list subcommand
+	cmd.AddCommand(newGetCmd(o))           // get subcommand
+	cmd.AddCommand(newDiffCmd(o))          // diff subcommand
+	cmd.AddCommand(newPruneCmd(o))         // prune subcommand
+	cmd.AddCommand(newSyncCmd(o))          // sync subcommand
+	cmd.AddCommand(newVerifyCmd())         // verify subcommand
+	cmd.AddCommand(newCacheCmd(o))         // cache subcommand
 
 	return cmd
 }
 
+// getTUFPath returns the local TUF cache path, defaulting to ~/.docker/tuf.
+// Every source is cached in its own entry below this path.
+func (o *rootOptions) getTUFPath() (string, error) {
+	if o.tufPath != "" {
+		return strings.TrimSpace(o.tufPath), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return filepath.Join(home, ".docker", "tuf"), nil
+}
+
+// logger returns the logger of the command, which writes to stderr so that stdout only holds command results.
+// Commands run without the root command log at the default level and format.
+func (o *rootOptions) logger(cmd *cobra.Command) *slog.Logger {
+	if o.log != nil {
+		return o.log
+	}
+	log, _ := logging.New(cmd.ErrOrStderr(), logging.DefaultLevel, logging.DefaultFormat)
+	return log
+}
+
+// newMirror creates a TUF mirror that performs a verified update against src.
+// Trust is bootstrapped from the initial root of the source and progress is logged.
+func (o *rootOptions) newMirror(cmd *cobra.Command, src tufmirror.Source) (*tufmirror.Mirror, error) {
+	return o.openMirror(cmd, src, o.ephemeral)
+}
+
+// openMirror creates a TUF mirror from a source. An ephemeral mirror uses a temporary cache removed when it is
+// closed, so that trust always starts from the initial root, otherwise the cache entry of the source is used.
+func (o *rootOptions) openMirror(cmd *cobra.Command, src tufmirror.Source, ephemeral bool) (*tufmirror.Mirror, error) {
+	log := o.logger(cmd)
+	rootData, err := o.initialRoot(log, src.RootLocation(), func() ([]byte, error) {
+		return tufmirror.InitialRoot(cmd.Context(), src)
+	})
+	if err != nil {
+		return nil, err
+	}
+	dir := ""
+	if !ephemeral {
+		dir, err = o.cacheDir(log, src.Location(), rootData)
+		if err != nil {
+			return nil, err
+		}
+	}
+	rootLocation := src.RootLocation()
+	if o.rootFile != "" {
+		rootLocation = o.rootFile
+	}
+	return tufmirror.New(cmd.Context(), src, &tufmirror.Options{
+		CacheDir:     dir,
+		Root:         rootData,
+		RootLocation: rootLocation,
+		Version:      o.version,
+		Logger:       log,
+		Observer:     o.metrics,
+	})
+}
+
+// webMirror creates a TUF mirror from web metadata and targets locations.
+func (o *rootOptions) webMirror(cmd *cobra.Command, metadata, targets string) (*tufmirror.Mirror, error) {
+	src, err := tufmirror.NewWebSource(metadata, targets)
+	if err != nil {
+		return nil, err
+	}
+	return o.newMirror(cmd, src)
+}
+
+// cacheDir returns the directory holding the trusted metadata of a metadata location and root until the mirror
+// is released. The cache entry of the source is locked so that concurrent runs do not corrupt it.
+func (o *rootOptions) cacheDir(log *slog.Logger, metadata string, rootData []byte) (string, error) {
+	tufPath, err := o.getTUFPath()
+	if err != nil {
+		return "", err
+	}
+	entry := cache.New(tufPath, metadata, rootData)
+	lock, err := entry.TryLock()
+	if errors.Is(err, cache.ErrLocked) {
+		log.Info("Waiting for lock on TUF cache", "cache", entry.Path)
+		lock, err = entry.Lock()
+	}
+	if err != nil {
+		return "", err
+	}
+	o.cacheLocks = append(o.cacheLocks, lock)
+	err = entry.Create()
+	if err != nil {
+		return "", err
+	}
+	return entry.Path, nil
+}
+
+// releaseCaches unlocks the TUF caches once a command or run is done with its mirrors.
+func (o *rootOptions) releaseCaches() {
+	for _, l := range o.cacheLocks {
+		_ = l.Unlock()
+	}
+	o.cacheLocks = nil
+}
+
+// initialRoot returns the root metadata that trust is bootstrapped from.
+// A trusted root file takes precedence, otherwise the initial root at location is fetched and trusted on first use.
+func (o *rootOptions) initialRoot(log *slog.Logger, location string, fetch func() ([]byte, error)) ([]byte, error) {
+	if o.rootFile != "" {
+		log.Info("Using trusted root", "root", o.rootFile)
+		rootData, err := os.ReadFile(o.rootFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read trusted root: %w", err)
+		}
+		return rootData, nil
+	}
+	log.Info("Fetching initial root", "root", location)
+	rootData, err := fetch()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch root from source: %w", err)
+	}
+	return rootData, nil
+}
+
 // Execute invokes the command.
 func Execute(version string) error {
 	ctx := context.Background()
@@ -0,0 +1,108 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// logValue formats a string value like the text log handler.
+func logValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// savedLog returns the fields logged for a manifest of the given kind saved under name.
+func savedLog(kind, name string) string {
+	return `msg="Saved manifest" kind=` + logValue(kind) + " name=" + logValue(name) + " "
+}
+
+// assertLogged asserts that logs holds the records matching each of the fields, in order.
+func assertLogged(t *testing.T, logs string, fields ...string) {
+	t.Helper()
+	for _, f := range fields {
+		i := strings.Index(logs, f)
+		if !assert.GreaterOrEqual(t, i, 0, "missing %q in logs:\n%s", f, logs) {
+			return
+		}
+		logs = logs[i+len(f):]
+	}
+}
+
+func TestRootCmdLogging(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "internal", "test", "testdata", "test-repo"))))
+	defer server.Close()
+	dir := t.TempDir()
+
+	testCases := []struct {
+		name  string
+		flags []string
+		err   string
+	}{
+		{"json", []string{"--log-format", "json", "--log-level", "debug"}, ""},
+		{"invalid level", []string{"--log-level", "verbose"}, "invalid log level"},
+		{"invalid format", []string{"--log-format", "xml"}, "invalid log format"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd := newRootCmd("test")
+			out := &bytes.Buffer{}
+			logs := &bytes.Buffer{}
+			cmd.SetOut(out)
+			cmd.SetErr(logs)
+			cmd.SetArgs(append([]string{"metadata", "--tuf-path", t.TempDir(),
+				"-s", server.URL + "/metadata", "-d", OCIPrefix + filepath.Join(dir, tc.name)}, tc.flags...))
+
+			err := cmd.Execute()
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+
+			// stdout is reserved for results, every log line is a JSON record
+			assert.Empty(t, out.String())
+			var messages []string
+			for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+				var record map[string]any
+				require.NoError(t, json.Unmarshal([]byte(line), &record), line)
+				messages = append(messages, record["msg"].(string))
+				if record["msg"] == "Saved manifest" {
+					assert.Equal(t, "Metadata manifest", record["kind"])
+					assert.Equal(t, filepath.Join(dir, tc.name), record["name"])
+					assert.Contains(t, record["digest"], "sha256:")
+				}
+			}
+			assert.Contains(t, messages, "Fetching initial root")
+			assert.Contains(t, messages, "Verified TUF metadata")
+			assert.Contains(t, messages, "Fetched metadata")
+			assert.Contains(t, messages, "Saved manifest")
+		})
+	}
+}
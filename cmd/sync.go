@@ -0,0 +1,232 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/docker/attest/mirror"
+	"github.com/docker/go-tuf-mirror/internal/config"
+	"github.com/spf13/cobra"
+)
+
+type syncOptions struct {
+	config      string
+	interval    time.Duration
+	metricsAddr string
+	approveRoot string
+	rootOptions *rootOptions
+}
+
+func defaultSyncOptions(opts *rootOptions) *syncOptions {
+	return &syncOptions{
+		rootOptions: opts,
+	}
+}
+
+func newSyncCmd(opts *rootOptions) *cobra.Command {
+	o := defaultSyncOptions(opts)
+
+	cmd := &cobra.Command{
+		Use:          "sync",
+		Short:        "Run the mirror jobs of a config file",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         o.run,
+	}
+	cmd.PersistentFlags().StringVarP(&o.config, "config", "c", "", "Config file listing the mirror jobs")
+	cmd.PersistentFlags().DurationVar(&o.interval, "interval", 0, "Keep running the mirror jobs at this interval until interrupted, e.g. 15m (default run once)")
+	cmd.PersistentFlags().StringVar(&o.metricsAddr, "metrics-addr", "", "Serve Prometheus metrics on /metrics at this address while running, e.g. :9090")
+	cmd.PersistentFlags().StringVar(&o.approveRoot, "approve-root", "", "Digest of a new root whose key and threshold changes are approved in jobs requiring approval, as printed in the root change summary")
+
+	err := cmd.MarkPersistentFlagRequired("config")
+	if err != nil {
+		log.Fatalf("failed to mark flag required: %s", err)
+	}
+	return cmd
+}
+
+func (o *syncOptions) run(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load(o.config)
+	if err != nil {
+		return err
+	}
+	log := o.rootOptions.logger(cmd)
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	cmd.SetContext(ctx)
+
+	if o.metricsAddr != "" {
+		shutdown, err := o.serveMetrics(log)
+		if err != nil {
+			return err
+		}
+		defer shutdown()
+	}
+
+	if o.interval <= 0 {
+		return o.runJobs(cmd, cfg)
+	}
+	// watch mode, a failed round is logged and retried at the next interval, only changes are notified
+	o.rootOptions.notified = map[string]string{}
+	for {
+		err = o.runJobs(cmd, cfg)
+		if err != nil {
+			log.Error("Sync failed", "error", err)
+		}
+		log.Info("Waiting for next sync", "interval", o.interval)
+		select {
+		case <-ctx.Done():
+			log.Info("Stopped sync")
+			return nil
+		case <-time.After(o.interval):
+		}
+	}
+}
+
+// serveMetrics serves the metrics on /metrics at the metrics address until the returned function is called.
+func (o *syncOptions) serveMetrics(log *slog.Logger) (func(), error) {
+	ln, err := net.Listen("tcp", o.metricsAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on metrics address: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", o.rootOptions.metrics.Handler())
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		err := server.Serve(ln)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("Failed to serve metrics", "error", err)
+		}
+	}()
+	log.Info("Serving metrics", "address", ln.Addr().String())
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}, nil
+}
+
+// runJobs runs every job of a config once and prints a summary, a failed job does not stop the others.
+func (o *syncOptions) runJobs(cmd *cobra.Command, cfg *config.Config) error {
+	errs := make([]error, len(cfg.Mirrors))
+	for i, m := range cfg.Mirrors {
+		o.rootOptions.logger(cmd).Info("Running mirror job", "job", m.Name)
+		errs[i] = o.runJob(cmd, m)
+	}
+
+	failed := 0
+	fmt.Fprintln(cmd.OutOrStdout(), "Sync summary:")
+	for i, m := range cfg.Mirrors {
+		if errs[i] != nil {
+			failed++
+			fmt.Fprintf(cmd.OutOrStdout(), "  %s: failed: %s\n", m.Name, errs[i])
+			continue
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "  %s: ok\n", m.Name)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d mirror jobs failed", failed, len(cfg.Mirrors))
+	}
+	return nil
+}
+
+// runJob mirrors and verifies the targets of a job and only then its metadata, the metadata reusing the
+// verified mirror, so that clients never see metadata referencing targets that are not mirrored yet.
+func (o *syncOptions) runJob(cmd *cobra.Command, m *config.Mirror) error {
+	opts := *o.rootOptions
+	opts.cacheLocks = nil
+	opts.full = m.Options.Full
+	opts.rootFile = m.Source.Root
+
+	var targets *targetsOptions
+	if len(m.Destinations.Targets) > 0 {
+		targets = defaultTargetsOptions(&opts)
+		targets.metadata = m.Source.Metadata
+		targets.source = m.Source.Targets
+		targets.destinations = m.Destinations.Targets
+		targets.roles = m.Filters.Roles
+		targets.targetFilters = m.Filters.Targets
+		targets.validatePolicy = m.Options.ValidatePolicy
+		targets.prune = m.Options.Prune
+		targets.pruneKeep = m.Options.PruneKeep
+		if m.Options.PruneDryRun != nil {
+			targets.pruneDryRun = *m.Options.PruneDryRun
+		}
+		targets.targetTag = m.Options.TargetTagTemplate
+		targets.delegatedTag = m.Options.DelegatedTagTemplate
+		targets.referrers = m.Options.Referrers
+		targets.resume = m.Options.Resume
+		targets.verify = true
+		targets.annotations = jobAnnotations(m)
+		targets.signKey = m.Options.SignKey
+		if m.Options.SignMode != "" {
+			targets.signMode = m.Options.SignMode
+		}
+	}
+
+	var metadata *metadataOptions
+	if len(m.Destinations.Metadata) > 0 {
+		metadata = defaultMetadataOptions(&opts)
+		metadata.source = m.Source.Metadata
+		metadata.targets = mirror.DefaultTargetsURL
+		if m.Source.Targets != "" {
+			metadata.targets = m.Source.Targets
+		}
+		metadata.destinations = m.Destinations.Metadata
+		metadata.roles = m.Filters.Roles
+		metadata.versionTags = m.Options.VersionTags
+		metadata.dateTag = m.Options.DateTag
+		metadata.delegatedTag = m.Options.DelegatedTagTemplate
+		metadata.provenance = m.Options.Provenance
+		metadata.provFile = m.Options.ProvenanceFile
+		metadata.annotations = jobAnnotations(m)
+		metadata.requireRoot = m.Options.RequireRootApproval
+		metadata.approveRoot = o.approveRoot
+		metadata.signKey = m.Options.SignKey
+		if m.Options.SignMode != "" {
+			metadata.signMode = m.Options.SignMode
+		}
+	}
+	return opts.mirrorRun(cmd, metadata, targets)
+}
+
+// jobAnnotations returns the annotations of a mirror job as key=value annotation options, sorted by key.
+func jobAnnotations(m *config.Mirror) []string {
+	keys := make([]string, 0, len(m.Options.Annotations))
+	for key := range m.Options.Annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values = append(values, key+"="+m.Options.Annotations[key])
+	}
+	return values
+}
@@ -0,0 +1,207 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncCmd(t *testing.T) {
+	dir := t.TempDir()
+	testRepo := filepath.Join("..", "internal", "test", "testdata", "test-repo")
+
+	server := httptest.NewServer(http.FileServer(http.Dir(testRepo)))
+	defer server.Close()
+
+	reg := httptest.NewServer(registry.New(registry.WithReferrersSupport(false)))
+	defer reg.Close()
+	url, err := url.Parse(reg.URL)
+	require.NoError(t, err)
+	repo := "localhost:" + url.Port() + "/test"
+
+	root, err := filepath.Abs(filepath.Join(testRepo, "metadata", "1.root.json"))
+	require.NoError(t, err)
+
+	config := fmt.Sprintf(`
+mirrors:
+  - name: registry
+    source:
+      metadata: %[1]s/metadata
+      targets: %[1]s/targets
+      root: %[2]s
+    destinations:
+      metadata: [docker://%[3]s/metadata:latest]
+      targets: [docker://%[3]s/targets]
+    filters:
+      roles: [none]
+      targets: ["*.txt"]
+    options:
+      full: true
+  - name: layout
+    source:
+      metadata: %[1]s/metadata
+    destinations:
+      metadata: [oci://%[4]s]
+  - name: broken
+    source:
+      metadata: %[1]s/missing
+    destinations:
+      metadata: [oci://%[4]s]
+`, server.URL, root, repo, filepath.Join(dir, "metadata"))
+	configPath := filepath.Join(dir, "mirrors.yaml")
+	err = os.WriteFile(configPath, []byte(config), 0o600)
+	require.NoError(t, err)
+
+	opts := defaultRootOptions()
+	opts.tufPath = t.TempDir()
+	cmd := newSyncCmd(opts)
+	b := bytes.NewBufferString("")
+	logs := bytes.NewBufferString("")
+	cmd.SetOut(b)
+	cmd.SetErr(logs)
+	_ = cmd.PersistentFlags().Set("config", configPath)
+
+	err = cmd.Execute()
+	require.ErrorContains(t, err, "1 of 3 mirror jobs failed")
+
+	// stdout only holds the summary
+	assert.True(t, strings.HasPrefix(b.String(), "Sync summary:\n  registry: ok\n  layout: ok\n  broken: failed: error mirroring metadata: "), b.String())
+
+	out := logs.String()
+	// metadata is published once the targets are verified
+	assertLogged(t, out,
+		`msg="Running mirror job" job=registry`+"\n",
+		`msg="Mirroring TUF targets" `,
+		`msg="Using trusted root" root=`+root+"\n",
+		savedLog("Target manifest", repo+"/targets:"+targetFile),
+		`msg="Verified targets" destination=docker://`+repo+"/targets manifests=1\n",
+		`msg="Mirroring TUF metadata" `,
+		`msg="Running mirror job" job=layout`+"\n",
+		`msg="Running mirror job" job=broken`+"\n",
+	)
+	// delegated roles and targets are filtered
+	assert.NotContains(t, out, "Delegated")
+	assert.NotContains(t, out, "mapping.yaml")
+
+	ref, err := name.NewRepository(repo + "/targets")
+	require.NoError(t, err)
+	tags, err := remote.List(ref)
+	require.NoError(t, err)
+	assert.Equal(t, []string{targetFile}, tags)
+
+	_, err = os.Stat(filepath.Join(dir, "metadata", "index.json"))
+	require.NoError(t, err)
+}
+
+func TestSyncCmdWatch(t *testing.T) {
+	dir := t.TempDir()
+
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "internal", "test", "testdata", "test-repo"))))
+	defer server.Close()
+
+	config := fmt.Sprintf(`
+mirrors:
+  - name: layout
+    source:
+      metadata: %s/metadata
+    destinations:
+      metadata: [oci://%s]
+`, server.URL, filepath.Join(dir, "metadata"))
+	configPath := filepath.Join(dir, "mirrors.yaml")
+	err := os.WriteFile(configPath, []byte(config), 0o600)
+	require.NoError(t, err)
+
+	var notifications atomic.Int32
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first notification fails
+		if notifications.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer hook.Close()
+	var delivered atomic.Int32
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered.Add(1)
+	}))
+	defer other.Close()
+
+	// reserve a free port for the metrics server
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	require.NoError(t, ln.Close())
+
+	opts := defaultRootOptions()
+	opts.tufPath = t.TempDir()
+	cmd := newSyncCmd(opts)
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+	_ = cmd.PersistentFlags().Set("config", configPath)
+	_ = cmd.PersistentFlags().Set("interval", "10ms")
+	_ = cmd.PersistentFlags().Set("metrics-addr", addr)
+	opts.notifyURLs = []string{hook.URL, other.URL}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- cmd.ExecuteContext(ctx)
+	}()
+
+	// the jobs keep running until the metrics show several successful rounds
+	require.Eventually(t, func() bool {
+		resp, err := http.Get("http://" + addr + "/metrics")
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return false
+		}
+		return strings.Contains(string(body), `go_tuf_mirror_fetch_duration_seconds_count{operation="metadata_update"} 3`+"\n") &&
+			strings.Contains(string(body), fmt.Sprintf("go_tuf_mirror_last_success_timestamp_seconds{source=%q} ", server.URL+"/metadata"))
+	}, 10*time.Second, 10*time.Millisecond)
+
+	// interrupting the watch stops it without error
+	cancel()
+	require.NoError(t, <-done)
+	_, err = http.Get("http://" + addr + "/metrics")
+	require.Error(t, err)
+	// a failed notification is sent again by the next round, later rounds without changes are not notified
+	assert.Equal(t, int32(2), notifications.Load())
+	// webhooks that received the event are not notified again along with the failed one
+	assert.Equal(t, int32(1), delivered.Load())
+}
@@ -17,29 +17,46 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"log"
-	"os"
-	"path/filepath"
+	"log/slog"
 	"strings"
 
 	"github.com/docker/attest/mirror"
-	"github.com/docker/attest/oci"
-	mirrortuf "github.com/docker/go-tuf-mirror/internal/tuf"
+	"github.com/docker/go-tuf-mirror/internal/annotations"
+	"github.com/docker/go-tuf-mirror/internal/reproducible"
+	"github.com/docker/go-tuf-mirror/internal/sign"
 	"github.com/docker/go-tuf-mirror/internal/util"
-	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/docker/go-tuf-mirror/pkg/tufmirror"
 	"github.com/spf13/cobra"
 )
 
 type targetsOptions struct {
-	source      string
-	destination string
-	metadata    string
-	rootOptions *rootOptions
+	source         string
+	destinations   []string
+	metadata       string
+	validatePolicy bool
+	prune          bool
+	pruneKeep      int
+	pruneDryRun    bool
+	targetTag      string
+	delegatedTag   string
+	roles          []string
+	targetFilters  []string
+	referrers      bool
+	signKey        string
+	signMode       string
+	annotations    []string
+	resume         bool
+	verify         bool
+	rootOptions    *rootOptions
 }
 
 func defaultTargetsOptions(opts *rootOptions) *targetsOptions {
 	return &targetsOptions{
+		pruneDryRun: true,
+		signMode:    sign.TagMode,
 		rootOptions: opts,
 	}
 }
@@ -55,7 +72,21 @@ func newTargetsCmd(opts *rootOptions) *cobra.Command {
 	}
 	cmd.PersistentFlags().StringVarP((&o.metadata), "metadata", "m", mirror.DefaultMetadataURL, fmt.Sprintf("Source metadata location %s<web>, %s<OCI layout>, %s<filesystem> or %s<remote registry>", WebPrefix, OCIPrefix, LocalPrefix, RegistryPrefix))
 	cmd.PersistentFlags().StringVarP(&o.source, "source", "s", mirror.DefaultMetadataURL, fmt.Sprintf("Source targets location %s<web>, %s<OCI layout>, %s<filesystem> or %s<remote registry>", WebPrefix, OCIPrefix, LocalPrefix, RegistryPrefix))
-	cmd.PersistentFlags().StringVarP(&o.destination, "destination", "d", "", fmt.Sprintf("Destination targets location %s<OCI layout>, %s<filesystem> or %s<remote registry>", OCIPrefix, LocalPrefix, RegistryPrefix))
+	cmd.PersistentFlags().StringArrayVarP(&o.destinations, "destination", "d", nil, fmt.Sprintf("Destination targets location %s<OCI layout>, %s<filesystem> or %s<remote registry>, may be repeated", OCIPrefix, LocalPrefix, RegistryPrefix))
+	cmd.PersistentFlags().BoolVar(&o.validatePolicy, "validate-policy", false, "Validate policy mappings and compile Rego policies before mirroring targets")
+	cmd.PersistentFlags().BoolVar(&o.prune, "prune", false, "Prune target tags no longer referenced by the targets metadata after mirroring")
+	cmd.PersistentFlags().IntVar(&o.pruneKeep, "prune-keep", 0, "Number of previous generations of each target to keep when pruning")
+	cmd.PersistentFlags().BoolVar(&o.pruneDryRun, "prune-dry-run", true, "Only report the target tags that would be pruned")
+	cmd.PersistentFlags().StringVar(&o.targetTag, "target-tag-template", "", "Go template for target tags with .Hash and .Name, e.g. '{{.Hash | trunc 12}}-{{.Name}}' (default <hash>.<name>)")
+	cmd.PersistentFlags().StringVar(&o.delegatedTag, "delegated-tag-template", "", "Go template for delegated target index tags with .Name, the role name (default <role>)")
+	cmd.PersistentFlags().StringArrayVar(&o.roles, "role", nil, "Only mirror delegated roles matching this glob pattern, may be repeated")
+	cmd.PersistentFlags().StringArrayVar(&o.targetFilters, "target", nil, "Only mirror top-level targets whose name matches this glob pattern, may be repeated")
+	cmd.PersistentFlags().BoolVar(&o.referrers, "referrers", false, "Attach the signed targets metadata to each target manifest as an OCI referrer")
+	cmd.PersistentFlags().StringVar(&o.signKey, "sign-key", "", "PEM encoded ECDSA or ED25519 private key to sign every mirrored manifest with, encrypted keys use COSIGN_PASSWORD")
+	cmd.PersistentFlags().StringVar(&o.signMode, "sign-mode", sign.TagMode, fmt.Sprintf("Where registries store signatures [%s, %s]", sign.TagMode, sign.ReferrerMode))
+	cmd.PersistentFlags().StringArrayVar(&o.annotations, "annotation", nil, "Annotation key=value to add to every mirrored manifest and index, may be repeated")
+	cmd.PersistentFlags().BoolVar(&o.resume, "resume", false, "Only save target manifests and delegated target indexes that are missing from the destination or differ there, to repair a partial mirror")
+	cmd.PersistentFlags().BoolVar(&o.verify, "verify", false, "Verify that every target manifest and delegated target index is mirrored to the destination after saving")
 
 	err := cmd.MarkPersistentFlagRequired("metadata")
 	if err != nil {
@@ -73,115 +104,97 @@ func newTargetsCmd(opts *rootOptions) *cobra.Command {
 }
 
 func (o *targetsOptions) run(cmd *cobra.Command, args []string) error {
-	// only support web to registry or oci layout for now
+	return o.rootOptions.mirrorRun(cmd, nil, o)
+}
+
+// targetsRun is a validated targets mirroring run.
+type targetsRun struct {
+	source       string
+	locations    []string
+	destinations []tufmirror.Destination
+	options      *tufmirror.TargetsOptions
+}
+
+// validate checks the options and returns the run they describe, before anything is mirrored.
+func (o *targetsOptions) validate() (*targetsRun, error) {
+	// only support web sources for now
 	if !strings.HasPrefix(o.metadata, WebPrefix) && !strings.HasPrefix(o.metadata, InsecureWebPrefix) {
-		return fmt.Errorf("metadata not implemented: %s", o.source)
+		return nil, fmt.Errorf("metadata not implemented: %s", o.metadata)
 	}
 	if !strings.HasPrefix(o.source, WebPrefix) && !strings.HasPrefix(o.source, InsecureWebPrefix) {
-		return fmt.Errorf("source not implemented: %s", o.source)
-	}
-	if !(strings.HasPrefix(o.destination, RegistryPrefix) || strings.HasPrefix(o.destination, OCIPrefix)) {
-		return fmt.Errorf("destination not implemented: %s", o.destination)
+		return nil, fmt.Errorf("source not implemented: %s", o.source)
 	}
 	if !util.IsValidUrl(o.source) {
-		return fmt.Errorf("invalid source url: %s", o.source)
+		return nil, fmt.Errorf("invalid source url: %s", o.source)
 	}
-	if strings.HasPrefix(o.destination, RegistryPrefix) {
-		_, err := name.NewRepository(strings.TrimPrefix(o.destination, RegistryPrefix))
-		if err != nil {
-			return fmt.Errorf("failed to parse destination registry reference: %w", err)
-		}
+	destinations, err := parseDestinations(o.destinations)
+	if err != nil {
+		return nil, err
 	}
+	signer, err := tufmirror.LoadSigner(o.signKey, o.signMode)
+	if err != nil {
+		return nil, err
+	}
+	custom, err := annotations.Parse(o.annotations)
+	if err != nil {
+		return nil, err
+	}
+	created, err := reproducible.SourceDateEpoch()
+	if err != nil {
+		return nil, err
+	}
+	return &targetsRun{
+		source:       o.source,
+		locations:    o.destinations,
+		destinations: destinations,
+		options: &tufmirror.TargetsOptions{
+			Full:                 o.rootOptions.full,
+			Roles:                o.roles,
+			Targets:              o.targetFilters,
+			ValidatePolicy:       o.validatePolicy,
+			TargetTagTemplate:    o.targetTag,
+			DelegatedTagTemplate: o.delegatedTag,
+			Referrers:            o.referrers,
+			Signer:               signer,
+			Annotations:          custom,
+			Created:              created,
+			Resume:               o.resume,
+			Verify:               o.verify,
+			Prune:                o.prune,
+			PruneKeep:            o.pruneKeep,
+			PruneDryRun:          o.pruneDryRun,
+		},
+	}, nil
+}
 
-	fmt.Fprintf(cmd.OutOrStdout(), "Mirroring TUF targets %s to %s\n", o.source, o.destination)
-
-	// use existing mirror from root or create new one
-	m := o.rootOptions.mirror
-	if m == nil {
-		var tufPath string
-		var err error
-		if o.rootOptions.tufPath == "" {
-			home, err := os.UserHomeDir()
-			if err != nil {
-				return fmt.Errorf("failed to get user home directory: %w", err)
-			}
-			tufPath = filepath.Join(home, ".docker", "tuf")
-		} else {
-			tufPath = strings.TrimSpace(o.rootOptions.tufPath)
-		}
-
-		// Fetch root.json from metadata source instead of using embedded root
-		rootURL := strings.TrimSuffix(o.metadata, "/") + "/1.root.json"
-		fmt.Fprintf(cmd.OutOrStdout(), "Fetching initial root from %s\n", rootURL)
-		rootData, err := util.HTTPGet(rootURL)
-		if err != nil {
-			return fmt.Errorf("failed to fetch root from metadata source: %w", err)
-		}
+// mirror saves the targets of the mirror opened by open to every destination. The result is nil if nothing was
+// mirrored.
+func (r *targetsRun) mirror(cmd *cobra.Command, log *slog.Logger, open func() (*tufmirror.Mirror, error)) (*tufmirror.Result, error) {
+	log.Info("Mirroring TUF targets", "source", r.source, "destinations", strings.Join(r.locations, ", "))
 
-		m, err = mirror.NewTUFMirror(cmd.Context(), rootData, tufPath, o.metadata, o.source, &mirrortuf.NullVersionChecker{})
-		if err != nil {
-			return fmt.Errorf("failed to create TUF mirror: %w", err)
-		}
-	} else {
-		// set remote targets url for existing mirror
-		m.TUFClient.SetRemoteTargetsURL(o.source)
+	m, err := open()
+	if err != nil {
+		return nil, err
 	}
-
-	// create target manifests
-	targets, err := m.GetTUFTargetMirrors()
+	res, err := m.MirrorTargets(cmd.Context(), r.destinations, r.options)
 	if err != nil {
-		return fmt.Errorf("failed to create target mirrors: %w", err)
+		return nil, err
 	}
+	return res, writeDestinationSummary(cmd.OutOrStdout(), res)
+}
 
-	// create delegated target manifests
-	var delegated []*mirror.Index
-	if o.rootOptions.full {
-		delegated, err = m.GetDelegatedTargetMirrors()
-		if err != nil {
-			return fmt.Errorf("failed to create delegated target index manifests: %w", err)
-		}
+// prune deletes stale target tags from every destination of the mirror opened by open.
+func (r *targetsRun) prune(cmd *cobra.Command, open func() (*tufmirror.Mirror, error)) error {
+	m, err := open()
+	if err != nil {
+		return err
 	}
-
-	// save target manifests
-	switch {
-	case strings.HasPrefix(o.destination, OCIPrefix):
-		outputPath := strings.TrimPrefix(o.destination, OCIPrefix)
-		for _, t := range targets {
-			path := filepath.Join(outputPath, t.Tag)
-			err = oci.SaveImageAsOCILayout(t.Image, path)
-			if err != nil {
-				return fmt.Errorf("failed to save target as OCI layout: %w", err)
-			}
-			fmt.Fprintf(cmd.OutOrStdout(), "Target manifest layout saved to %s\n", path)
-		}
-		for _, d := range delegated {
-			path := filepath.Join(outputPath, d.Tag)
-			err = oci.SaveIndexAsOCILayout(d.Index, path)
-			if err != nil {
-				return fmt.Errorf("failed to save delegated target index as OCI layout: %w", err)
-			}
-			fmt.Fprintf(cmd.OutOrStdout(), "Delegated target index manifest layout saved to %s\n", path)
-		}
-	case strings.HasPrefix(o.destination, RegistryPrefix):
-		repo := strings.TrimPrefix(o.destination, RegistryPrefix)
-		for _, t := range targets {
-			imageName := fmt.Sprintf("%s:%s", repo, t.Tag)
-			err = oci.PushImageToRegistry(cmd.Context(), t.Image, imageName)
-			if err != nil {
-				return fmt.Errorf("failed to push target manifest: %w", err)
-			}
-			fmt.Fprintf(cmd.OutOrStdout(), "Target manifest pushed to %s\n", imageName)
-		}
-		for _, d := range delegated {
-			imageName := fmt.Sprintf("%s:%s", repo, d.Tag)
-			err = oci.PushIndexToRegistry(cmd.Context(), d.Index, imageName)
-			if err != nil {
-				return fmt.Errorf("failed to push delegated target index manifest: %w", err)
-			}
-			fmt.Fprintf(cmd.OutOrStdout(), "Delegated target index manifest pushed to %s\n", imageName)
+	var errs []error
+	for _, dst := range r.destinations {
+		_, err := m.Prune(cmd.Context(), dst, r.options.PruneKeep, r.options.PruneDryRun)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to prune targets at %s: %w", dst.Location(), err))
 		}
-	default:
-		return fmt.Errorf("destination not implemented: %s", o.destination)
 	}
-	return nil
+	return errors.Join(errs...)
 }
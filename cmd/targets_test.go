@@ -20,6 +20,7 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -28,11 +29,16 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/docker/attest/tuf"
+	"github.com/docker/go-tuf-mirror/internal/annotations"
+	"github.com/docker/go-tuf-mirror/internal/referrers"
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/go-tuf/v2/metadata"
 )
 
 const (
@@ -68,7 +74,7 @@ func TestTargetsCmd(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			expectedOutput := fmt.Sprintf("Mirroring TUF targets %s to %s\n", tc.source, tc.destination)
+			expectedOutput := fmt.Sprintf("msg=\"Mirroring TUF targets\" source=%s destinations=%s\n", tc.source, tc.destination)
 
 			opts := defaultRootOptions()
 			opts.full = tc.full
@@ -79,6 +85,7 @@ func TestTargetsCmd(t *testing.T) {
 			}
 			b := bytes.NewBufferString("")
 			cmd.SetOut(b)
+			cmd.SetErr(b)
 			_ = cmd.PersistentFlags().Set("source", tc.source)
 			_ = cmd.PersistentFlags().Set("destination", tc.destination)
 			_ = cmd.PersistentFlags().Set("metadata", tc.metadata)
@@ -89,7 +96,7 @@ func TestTargetsCmd(t *testing.T) {
 			reader := bufio.NewReader(b)
 			out, err := reader.ReadString('\n')
 			require.NoError(t, err)
-			assert.Equal(t, expectedOutput, out)
+			assert.True(t, strings.HasSuffix(out, expectedOutput), out)
 
 			// check that index was saved to oci layout
 			if strings.HasPrefix(tc.destination, OCIPrefix) {
@@ -113,3 +120,340 @@ func TestTargetsCmd(t *testing.T) {
 		})
 	}
 }
+
+func TestTargetsCmdValidatePolicy(t *testing.T) {
+	tempDir := OCIPrefix + filepath.Join(os.TempDir(), "test")
+
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "internal", "test", "testdata", "test-repo"))))
+	defer server.Close()
+	serverMetadata := server.URL + "/metadata"
+	serverTargets := server.URL + "/targets"
+
+	opts := defaultRootOptions()
+	opts.full = true
+	cmd := newTargetsCmd(opts)
+	b := bytes.NewBufferString("")
+	cmd.SetOut(b)
+	cmd.SetErr(b)
+	_ = cmd.PersistentFlags().Set("source", serverTargets)
+	_ = cmd.PersistentFlags().Set("destination", tempDir)
+	_ = cmd.PersistentFlags().Set("metadata", serverMetadata)
+	_ = cmd.PersistentFlags().Set("validate-policy", "true")
+
+	err := cmd.Execute()
+	require.NoError(t, err)
+	defer os.RemoveAll(strings.TrimPrefix(tempDir, OCIPrefix))
+
+	out := b.String()
+	assert.Contains(t, out, `msg="Validated policy" role=targets mappings=1 policies=1`+"\n")
+	assert.Contains(t, out, `msg="Validated policy" role=test-role mappings=0 policies=0`+"\n")
+}
+
+func TestTargetsCmdTagTemplates(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "internal", "test", "testdata", "test-repo"))))
+	defer server.Close()
+	serverMetadata := server.URL + "/metadata"
+	serverTargets := server.URL + "/targets"
+
+	reg := httptest.NewServer(registry.New(registry.WithReferrersSupport(false)))
+	defer reg.Close()
+	url, err := url.Parse(reg.URL)
+	require.NoError(t, err)
+	repo := "localhost:" + url.Port() + "/test/targets"
+
+	testCases := []struct {
+		name      string
+		target    string
+		delegated string
+		tags      []string
+		err       string
+	}{
+		{"truncated hash", "{{.Hash | trunc 12}}-{{.Name}}", "role-{{.Name}}", []string{"02119a076ec3-test.txt", "baad1a9d61af-mapping.yaml", "role-test-role"}, ""},
+		{"invalid tag", "{{.Name}}/{{.Hash}}", "", nil, "does not match the OCI tag grammar"},
+		{"collision", "target", "", nil, "collides"},
+		{"collision with delegated role", "{{.Name}}", "test.txt", nil, "collides"},
+		{"invalid template", "{{.Hash", "", nil, "failed to parse target tag template"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := defaultRootOptions()
+			opts.full = true
+			opts.tufPath = t.TempDir()
+			cmd := newTargetsCmd(opts)
+			cmd.SetOut(bytes.NewBufferString(""))
+			_ = cmd.PersistentFlags().Set("source", serverTargets)
+			_ = cmd.PersistentFlags().Set("destination", RegistryPrefix+repo)
+			_ = cmd.PersistentFlags().Set("metadata", serverMetadata)
+			_ = cmd.PersistentFlags().Set("target-tag-template", tc.target)
+			_ = cmd.PersistentFlags().Set("delegated-tag-template", tc.delegated)
+
+			err := cmd.Execute()
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			ref, err := name.NewRepository(repo)
+			require.NoError(t, err)
+			tags, err := remote.List(ref)
+			require.NoError(t, err)
+			assert.Subset(t, tags, tc.tags)
+			assert.NotContains(t, tags, targetFile)
+		})
+	}
+}
+
+func TestTargetsCmdReferrers(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "internal", "test", "testdata", "test-repo"))))
+	defer server.Close()
+
+	testCases := []struct {
+		name      string
+		referrers bool
+	}{
+		{"referrers api", true},
+		{"referrers tag schema", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reg := httptest.NewServer(registry.New(registry.WithReferrersSupport(tc.referrers)))
+			defer reg.Close()
+			url, err := url.Parse(reg.URL)
+			require.NoError(t, err)
+			repo := "localhost:" + url.Port() + "/test/targets"
+
+			opts := defaultRootOptions()
+			opts.full = true
+			opts.tufPath = t.TempDir()
+			cmd := newTargetsCmd(opts)
+			b := bytes.NewBufferString("")
+			cmd.SetOut(b)
+			cmd.SetErr(b)
+			_ = cmd.PersistentFlags().Set("source", server.URL+"/targets")
+			_ = cmd.PersistentFlags().Set("destination", RegistryPrefix+repo)
+			_ = cmd.PersistentFlags().Set("metadata", server.URL+"/metadata")
+			_ = cmd.PersistentFlags().Set("referrers", "true")
+
+			err = cmd.Execute()
+			require.NoError(t, err)
+			// 5 top-level targets and 2 delegated targets
+			assert.Equal(t, 7, strings.Count(b.String(), `msg="Saved manifest" kind="Target metadata referrer" `))
+
+			// top-level target
+			r, err := name.NewRepository(repo)
+			require.NoError(t, err)
+			desc, err := remote.Head(r.Tag(targetFile))
+			require.NoError(t, err)
+			assertReferrer(t, r.Digest(desc.Digest.String()), "8.targets.json")
+
+			// delegated target
+			idx, err := remote.Index(r.Tag("test-role"))
+			require.NoError(t, err)
+			manifest, err := idx.IndexManifest()
+			require.NoError(t, err)
+			for _, m := range manifest.Manifests {
+				assertReferrer(t, r.Digest(m.Digest.String()), "2.test-role.json")
+			}
+		})
+	}
+
+	t.Run("oci layout", func(t *testing.T) {
+		dir := t.TempDir()
+		opts := defaultRootOptions()
+		opts.tufPath = t.TempDir()
+		cmd := newTargetsCmd(opts)
+		cmd.SetOut(bytes.NewBufferString(""))
+		_ = cmd.PersistentFlags().Set("source", server.URL+"/targets")
+		_ = cmd.PersistentFlags().Set("destination", OCIPrefix+dir)
+		_ = cmd.PersistentFlags().Set("metadata", server.URL+"/metadata")
+		_ = cmd.PersistentFlags().Set("referrers", "true")
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		p, err := layout.FromPath(filepath.Join(dir, targetFile))
+		require.NoError(t, err)
+		idx, err := p.ImageIndex()
+		require.NoError(t, err)
+		manifest, err := idx.IndexManifest()
+		require.NoError(t, err)
+		require.Len(t, manifest.Manifests, 2)
+		img, err := idx.Image(manifest.Manifests[1].Digest)
+		require.NoError(t, err)
+		m, err := img.Manifest()
+		require.NoError(t, err)
+		require.NotNil(t, m.Subject)
+		assert.Equal(t, manifest.Manifests[0].Digest, m.Subject.Digest)
+		assert.Equal(t, referrers.TargetsArtifactType, m.ArtifactType)
+	})
+}
+
+// assertReferrer checks that subject has a single targets metadata referrer holding filename.
+func assertReferrer(t *testing.T, subject name.Digest, filename string) {
+	idx, err := remote.Referrers(subject)
+	require.NoError(t, err)
+	manifest, err := idx.IndexManifest()
+	require.NoError(t, err)
+	require.Len(t, manifest.Manifests, 1)
+	assert.Equal(t, referrers.TargetsArtifactType, manifest.Manifests[0].ArtifactType)
+
+	img, err := remote.Image(subject.Context().Digest(manifest.Manifests[0].Digest.String()))
+	require.NoError(t, err)
+	m, err := img.Manifest()
+	require.NoError(t, err)
+	require.Len(t, m.Layers, 1)
+	assert.Equal(t, filename, m.Layers[0].Annotations[tuf.TUFFileNameAnnotation])
+	layer, err := img.LayerByDigest(m.Layers[0].Digest)
+	require.NoError(t, err)
+	rc, err := layer.Uncompressed()
+	require.NoError(t, err)
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	_, err = metadata.Targets().FromBytes(data)
+	require.NoError(t, err)
+}
+
+func TestTargetsCmdAnnotations(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "internal", "test", "testdata", "test-repo"))))
+	defer server.Close()
+
+	reg := httptest.NewServer(registry.New(registry.WithReferrersSupport(false)))
+	defer reg.Close()
+	url, err := url.Parse(reg.URL)
+	require.NoError(t, err)
+	repo := "localhost:" + url.Port() + "/test/annotations"
+
+	opts := defaultRootOptions()
+	opts.tufPath = t.TempDir()
+	opts.full = true
+	cmd := newTargetsCmd(opts)
+	cmd.SetOut(bytes.NewBufferString(""))
+	_ = cmd.PersistentFlags().Set("source", server.URL+"/targets")
+	_ = cmd.PersistentFlags().Set("metadata", server.URL+"/metadata")
+	_ = cmd.PersistentFlags().Set("destination", RegistryPrefix+repo)
+	_ = cmd.PersistentFlags().Set("annotation", "org.example.team=tuf")
+	_ = cmd.PersistentFlags().Set("referrers", "true")
+
+	err = cmd.Execute()
+	require.NoError(t, err)
+
+	assertAnnotations := func(t *testing.T, ann map[string]string, role, version string) {
+		assert.Equal(t, server.URL+"/targets", ann[annotations.Source])
+		assert.Equal(t, "unknown", ann[annotations.Version])
+		assert.Equal(t, "tuf", ann["org.example.team"])
+		assert.Equal(t, role, ann[annotations.Role])
+		assert.Equal(t, version, ann[annotations.RoleVersion])
+	}
+
+	ref, err := name.ParseReference(repo + ":" + targetFile)
+	require.NoError(t, err)
+	img, err := remote.Image(ref)
+	require.NoError(t, err)
+	manifest, err := img.Manifest()
+	require.NoError(t, err)
+	assertAnnotations(t, manifest.Annotations, "targets", "8")
+	// referrers refer to the annotated manifest
+	digest, err := img.Digest()
+	require.NoError(t, err)
+	assertReferrer(t, ref.Context().Digest(digest.String()), "8.targets.json")
+
+	ref, err = name.ParseReference(repo + ":test-role")
+	require.NoError(t, err)
+	index, err := remote.Index(ref)
+	require.NoError(t, err)
+	indexManifest, err := index.IndexManifest()
+	require.NoError(t, err)
+	assertAnnotations(t, indexManifest.Annotations, "test-role", "2")
+	require.NotEmpty(t, indexManifest.Manifests)
+	for _, desc := range indexManifest.Manifests {
+		assert.NotEmpty(t, desc.Annotations[tuf.TUFFileNameAnnotation])
+		img, err := index.Image(desc.Digest)
+		require.NoError(t, err)
+		manifest, err := img.Manifest()
+		require.NoError(t, err)
+		assertAnnotations(t, manifest.Annotations, "test-role", "2")
+	}
+}
+
+func TestTargetsCmdResume(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "internal", "test", "testdata", "test-repo"))))
+	defer server.Close()
+
+	reg := httptest.NewServer(registry.New(registry.WithReferrersSupport(false)))
+	defer reg.Close()
+	url, err := url.Parse(reg.URL)
+	require.NoError(t, err)
+	repo := "localhost:" + url.Port() + "/test/resume"
+	layoutDir := t.TempDir()
+	fileDir := t.TempDir()
+	mappingFile := "baad1a9d61afa5d6f8717f576b57b9749e5549da4b826746fd73a5a914ac5be1.mapping.yaml"
+
+	testCases := []struct {
+		name        string
+		destination string
+		// damage removes one target and replaces the delegated index
+		damage func(t *testing.T)
+	}{
+		{"registry", RegistryPrefix + repo, func(t *testing.T) {
+			r, err := name.NewRepository(repo)
+			require.NoError(t, err)
+			require.NoError(t, remote.Delete(r.Tag(targetFile)))
+			other, err := remote.Image(r.Tag(mappingFile))
+			require.NoError(t, err)
+			require.NoError(t, remote.Write(r.Tag("test-role"), other))
+		}},
+		{"oci layout", OCIPrefix + layoutDir, func(t *testing.T) {
+			require.NoError(t, os.RemoveAll(filepath.Join(layoutDir, targetFile)))
+			require.NoError(t, os.RemoveAll(filepath.Join(layoutDir, "test-role")))
+		}},
+		{"filesystem", LocalPrefix + fileDir, func(t *testing.T) {
+			require.NoError(t, os.Remove(filepath.Join(fileDir, targetFile)))
+			delegated := filepath.Join(fileDir, "test-role", "d1bb6181284970ae43fbbc88b5e72f9a5942ebac20588aa0c4bf78ba621e1ee2.test.txt")
+			require.NoError(t, os.WriteFile(delegated, []byte("stale"), 0o600))
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run := func(resume bool) string {
+				b := bytes.NewBufferString("")
+				opts := defaultRootOptions()
+				opts.tufPath = t.TempDir()
+				opts.full = true
+				cmd := newTargetsCmd(opts)
+				cmd.SetOut(b)
+				cmd.SetErr(b)
+				_ = cmd.PersistentFlags().Set("source", server.URL+"/targets")
+				_ = cmd.PersistentFlags().Set("metadata", server.URL+"/metadata")
+				_ = cmd.PersistentFlags().Set("destination", tc.destination)
+				_ = cmd.PersistentFlags().Set("resume", fmt.Sprint(resume))
+				require.NoError(t, cmd.Execute())
+				return b.String()
+			}
+
+			compared := func(missing int) string {
+				return fmt.Sprintf("msg=\"Compared manifests\" destination=%s missing=%d total=6\n", tc.destination, missing)
+			}
+
+			// resuming an empty destination saves everything
+			out := run(true)
+			assert.Contains(t, out, compared(6))
+
+			// an intact mirror is left alone
+			out = run(true)
+			assert.Contains(t, out, compared(0))
+			assert.NotContains(t, out, "Saved manifest")
+
+			tc.damage(t)
+			out = run(true)
+			assert.Contains(t, out, compared(2))
+			assert.Contains(t, out, `msg="Skipped up to date manifest" kind="Target manifest" tag=`+mappingFile+" ")
+			assert.Equal(t, 2, strings.Count(out, "Saved manifest"))
+
+			out = run(true)
+			assert.Contains(t, out, compared(0))
+		})
+	}
+}
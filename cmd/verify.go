@@ -0,0 +1,168 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/docker/attest/oci"
+	"github.com/docker/go-tuf-mirror/internal/sign"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/spf13/cobra"
+)
+
+type verifyOptions struct {
+	key string
+}
+
+func defaultVerifyOptions() *verifyOptions {
+	return &verifyOptions{}
+}
+
+func newVerifyCmd() *cobra.Command {
+	o := defaultVerifyOptions()
+
+	cmd := &cobra.Command{
+		Use:          "verify <location>...",
+		Short:        "Verify the signatures of mirrored manifests",
+		Long:         fmt.Sprintf("Verify the signatures of mirrored manifests in %s<remote registry> locations against a public key. Locations without a tag verify every tag of the repository. Other locations, such as OCI layouts, are rejected.", RegistryPrefix),
+		Args:         cobra.MinimumNArgs(1),
+		SilenceUsage: true,
+		RunE:         o.run,
+	}
+	cmd.PersistentFlags().StringVar(&o.key, "key", "", "PEM encoded ECDSA or ED25519 public key to verify signatures with")
+
+	err := cmd.MarkPersistentFlagRequired("key")
+	if err != nil {
+		log.Fatalf("failed to mark flag required: %s", err)
+	}
+	return cmd
+}
+
+func (o *verifyOptions) run(cmd *cobra.Command, args []string) error {
+	verifier, err := sign.LoadVerifier(o.key)
+	if err != nil {
+		return err
+	}
+	// reject unsupported locations before anything is verified
+	for _, location := range args {
+		if !strings.HasPrefix(location, RegistryPrefix) {
+			return fmt.Errorf("unsupported location %s: only %s<remote registry> locations can be verified", location, RegistryPrefix)
+		}
+	}
+	var refs []name.Reference
+	for _, location := range args {
+		locationRefs, err := verifyReferences(cmd, location)
+		if err != nil {
+			return err
+		}
+		refs = append(refs, locationRefs...)
+	}
+
+	failed := 0
+	for _, ref := range refs {
+		err = verifyReference(cmd, verifier, ref)
+		if err != nil {
+			fmt.Fprintf(cmd.OutOrStdout(), "Failed to verify signature of %s: %s\n", ref.Name(), err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Verified signature of %s\n", ref.Name())
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to verify %d of %d manifests", failed, len(refs))
+	}
+	return nil
+}
+
+// verifyReferences returns the references to verify for a location, every tag of the repository if
+// the location has no tag. Signature and referrers tag schema tags are skipped.
+func verifyReferences(cmd *cobra.Command, location string) ([]name.Reference, error) {
+	location = strings.TrimPrefix(location, RegistryPrefix)
+	repo, err := name.NewRepository(location)
+	if err == nil {
+		tags, err := remote.List(repo, oci.WithOptions(cmd.Context(), nil)...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags of %s: %w", repo.Name(), err)
+		}
+		var refs []name.Reference
+		for _, tag := range tags {
+			if sign.IsSignatureTag(tag) {
+				continue
+			}
+			refs = append(refs, repo.Tag(tag))
+		}
+		return refs, nil
+	}
+	ref, err := name.ParseReference(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse location %s: %w", location, err)
+	}
+	return []name.Reference{ref}, nil
+}
+
+// verifyReference verifies the signatures stored in the signature tag or as referrers of ref.
+func verifyReference(cmd *cobra.Command, verifier signature.Verifier, ref name.Reference) error {
+	opts := oci.WithOptions(cmd.Context(), nil)
+	desc, err := remote.Head(ref, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to get manifest: %w", err)
+	}
+	repo := ref.Context()
+
+	var errs []error
+	sig, err := remote.Image(repo.Tag(sign.SignatureTag(desc.Digest)), opts...)
+	if err == nil {
+		err = sign.Verify(cmd.Context(), verifier, sig, desc.Digest)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	index, err := remote.Referrers(repo.Digest(desc.Digest.String()), opts...)
+	if err != nil {
+		return fmt.Errorf("failed to get referrers: %w", err)
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return fmt.Errorf("failed to read referrers: %w", err)
+	}
+	for _, referrer := range manifest.Manifests {
+		if referrer.ArtifactType != sign.SignatureArtifactType {
+			continue
+		}
+		sig, err := remote.Image(repo.Digest(referrer.Digest.String()), opts...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to get signature %s: %w", referrer.Digest, err))
+			continue
+		}
+		err = sign.Verify(cmd.Context(), verifier, sig, desc.Digest)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return sign.ErrNoSignature
+	}
+	return errors.Join(errs...)
+}
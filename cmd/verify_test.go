@@ -0,0 +1,137 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/go-tuf-mirror/internal/sign"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestKeyPair(t *testing.T) (string, string) {
+	priv, pub, err := cryptoutils.GeneratePEMEncodedECDSAKeyPair(elliptic.P256(), cryptoutils.StaticPasswordFunc([]byte("secret")))
+	require.NoError(t, err)
+	dir := t.TempDir()
+	privPath := filepath.Join(dir, "cosign.key")
+	pubPath := filepath.Join(dir, "cosign.pub")
+	require.NoError(t, os.WriteFile(privPath, priv, 0o600))
+	require.NoError(t, os.WriteFile(pubPath, pub, 0o600))
+	return privPath, pubPath
+}
+
+func TestSignAndVerify(t *testing.T) {
+	t.Setenv("COSIGN_PASSWORD", "secret")
+	key, pub := writeTestKeyPair(t)
+	otherKey, otherPub := writeTestKeyPair(t)
+
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "internal", "test", "testdata", "test-repo"))))
+	defer server.Close()
+	serverMetadata := server.URL + "/metadata"
+	serverTargets := server.URL + "/targets"
+
+	reg := httptest.NewServer(registry.New(registry.WithReferrersSupport(false)))
+	defer reg.Close()
+	url, err := url.Parse(reg.URL)
+	require.NoError(t, err)
+
+	for _, mode := range []string{sign.TagMode, sign.ReferrerMode} {
+		t.Run(mode, func(t *testing.T) {
+			metadataPath := RegistryPrefix + "localhost:" + url.Port() + "/" + mode + "/metadata"
+			targetsPath := RegistryPrefix + "localhost:" + url.Port() + "/" + mode + "/targets"
+
+			opts := defaultRootOptions()
+			opts.full = true
+			opts.tufRoot = "dev"
+			metadata := newMetadataCmd(opts)
+			metadata.SetOut(bytes.NewBufferString(""))
+			_ = metadata.PersistentFlags().Set("source", serverMetadata)
+			_ = metadata.PersistentFlags().Set("destination", metadataPath+":latest")
+			_ = metadata.PersistentFlags().Set("sign-key", key)
+			_ = metadata.PersistentFlags().Set("sign-mode", mode)
+			require.NoError(t, metadata.Execute())
+
+			mirrorTargets := func(key string) string {
+				targets := newTargetsCmd(opts)
+				logs := bytes.NewBufferString("")
+				targets.SetOut(bytes.NewBufferString(""))
+				targets.SetErr(logs)
+				_ = targets.PersistentFlags().Set("source", serverTargets)
+				_ = targets.PersistentFlags().Set("metadata", serverMetadata)
+				_ = targets.PersistentFlags().Set("destination", targetsPath)
+				_ = targets.PersistentFlags().Set("sign-key", key)
+				_ = targets.PersistentFlags().Set("sign-mode", mode)
+				require.NoError(t, targets.Execute())
+				return logs.String()
+			}
+			assert.Contains(t, mirrorTargets(key), `msg="Saved signature" `)
+
+			verify := newVerifyCmd()
+			b := bytes.NewBufferString("")
+			verify.SetOut(b)
+			verify.SetArgs([]string{"--key", pub, metadataPath, targetsPath})
+			require.NoError(t, verify.Execute())
+			assert.Contains(t, b.String(), "Verified signature of localhost:"+url.Port()+"/"+mode+"/metadata:latest")
+			assert.Contains(t, b.String(), "Verified signature of localhost:"+url.Port()+"/"+mode+"/targets:"+targetFile)
+			assert.Contains(t, b.String(), "Verified signature of localhost:"+url.Port()+"/"+mode+"/metadata:test-role")
+			assert.NotContains(t, b.String(), ".sig")
+
+			// other locations are rejected before anything is verified
+			verify = newVerifyCmd()
+			b = bytes.NewBufferString("")
+			verify.SetOut(b)
+			verify.SetArgs([]string{"--key", pub, metadataPath, OCIPrefix + t.TempDir()})
+			verify.SilenceErrors = true
+			require.ErrorContains(t, verify.Execute(), "unsupported location "+OCIPrefix)
+			assert.Empty(t, b.String())
+
+			verify = newVerifyCmd()
+			b = bytes.NewBufferString("")
+			verify.SetOut(b)
+			verify.SetArgs([]string{"--key", otherPub, metadataPath + ":latest"})
+			verify.SilenceErrors = true
+			assert.Error(t, verify.Execute())
+			assert.Contains(t, b.String(), "Failed to verify signature of")
+
+			// signed manifests are not signed again by the same key
+			logs := mirrorTargets(key)
+			assert.Contains(t, logs, `msg="Skipped up to date signature" `)
+			assert.NotContains(t, logs, `msg="Saved signature" `)
+
+			// signatures of other keys are kept
+			assert.Contains(t, mirrorTargets(otherKey), `msg="Saved signature" `)
+			for _, k := range []string{pub, otherPub} {
+				verify = newVerifyCmd()
+				b = bytes.NewBufferString("")
+				verify.SetOut(b)
+				verify.SetArgs([]string{"--key", k, targetsPath})
+				require.NoError(t, verify.Execute())
+				assert.Contains(t, b.String(), "Verified signature of localhost:"+url.Port()+"/"+mode+"/targets:"+targetFile)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package annotations adds OCI annotations to mirrored manifests and indexes.
+package annotations
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/docker/attest/oci"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	// Source is the TUF source location the manifest was mirrored from.
+	Source = ocispec.AnnotationSource
+	// Created is the time the manifest was mirrored.
+	Created = ocispec.AnnotationCreated
+	// Version is the version of the mirror.
+	Version = "com.docker.tuf-mirror.version"
+	// Role is the TUF role whose metadata the manifest holds or whose targets it holds.
+	Role = "com.docker.tuf.role"
+	// RoleVersion is the version of the TUF role.
+	RoleVersion = "com.docker.tuf.role.version"
+)
+
+// Parse parses key=value annotations.
+func Parse(values []string) (map[string]string, error) {
+	annotations := make(map[string]string, len(values))
+	for _, value := range values {
+		key, val, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid annotation %q, expected key=value", value)
+		}
+		annotations[key] = val
+	}
+	return annotations, nil
+}
+
+// Merge returns the union of annotation sets, later sets taking precedence.
+func Merge(sets ...map[string]string) map[string]string {
+	merged := map[string]string{}
+	for _, set := range sets {
+		for key, value := range set {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// WithRole returns the annotations with the role and its version added.
+func WithRole(annotations map[string]string, role string, version int64) map[string]string {
+	return Merge(map[string]string{Role: role, RoleVersion: strconv.FormatInt(version, 10)}, annotations)
+}
+
+// Image returns the image with annotations added to its manifest.
+func Image(img *oci.EmptyConfigImage, annotations map[string]string) (*oci.EmptyConfigImage, error) {
+	annotated, ok := mutate.Annotations(img.Image, annotations).(v1.Image)
+	if !ok {
+		return nil, fmt.Errorf("failed to annotate image")
+	}
+	return &oci.EmptyConfigImage{Image: annotated}, nil
+}
+
+// Index returns the index with annotations added to its manifest and to the manifests of its images.
+// Descriptor annotations of the images are kept.
+func Index(index v1.ImageIndex, annotations map[string]string) (v1.ImageIndex, error) {
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index manifest: %w", err)
+	}
+	annotated := v1.ImageIndex(empty.Index)
+	if manifest.MediaType != "" {
+		annotated = mutate.IndexMediaType(annotated, manifest.MediaType)
+	}
+	for _, desc := range manifest.Manifests {
+		if !desc.MediaType.IsImage() {
+			return nil, fmt.Errorf("failed to annotate index: unexpected manifest %s of type %s", desc.Digest, desc.MediaType)
+		}
+		img, err := index.Image(desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read image %s: %w", desc.Digest, err)
+		}
+		child, err := Image(&oci.EmptyConfigImage{Image: img}, annotations)
+		if err != nil {
+			return nil, err
+		}
+		annotated = mutate.AppendManifests(annotated, mutate.IndexAddendum{
+			Add:        child,
+			Descriptor: v1.Descriptor{Annotations: desc.Annotations, Platform: desc.Platform},
+		})
+	}
+	annotated, ok := mutate.Annotations(annotated, Merge(manifest.Annotations, annotations)).(v1.ImageIndex)
+	if !ok {
+		return nil, fmt.Errorf("failed to annotate index")
+	}
+	return annotated, nil
+}
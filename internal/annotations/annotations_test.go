@@ -0,0 +1,91 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package annotations
+
+import (
+	"testing"
+
+	"github.com/docker/attest/oci"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	ann, err := Parse([]string{"a=b", "c=d=e", "f="})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "b", "c": "d=e", "f": ""}, ann)
+
+	for _, value := range []string{"a", "=b"} {
+		_, err = Parse([]string{value})
+		assert.Error(t, err, value)
+	}
+}
+
+func TestWithRole(t *testing.T) {
+	ann := WithRole(map[string]string{"a": "b"}, "targets", 8)
+	assert.Equal(t, map[string]string{"a": "b", Role: "targets", RoleVersion: "8"}, ann)
+
+	// given annotations take precedence
+	ann = WithRole(map[string]string{Role: "custom"}, "targets", 8)
+	assert.Equal(t, "custom", ann[Role])
+}
+
+func testImage(t *testing.T, data string) *oci.EmptyConfigImage {
+	img := empty.Image
+	img = mutate.MediaType(img, types.OCIManifestSchema1)
+	img = mutate.ConfigMediaType(img, types.OCIConfigJSON)
+	img, err := mutate.Append(img, mutate.Addendum{Layer: static.NewLayer([]byte(data), "text/plain")})
+	require.NoError(t, err)
+	return &oci.EmptyConfigImage{Image: img}
+}
+
+func TestImage(t *testing.T) {
+	img, err := Image(testImage(t, "test"), map[string]string{"a": "b"})
+	require.NoError(t, err)
+	manifest, err := img.Manifest()
+	require.NoError(t, err)
+	assert.Equal(t, "b", manifest.Annotations["a"])
+	// the empty config is kept
+	assert.Equal(t, types.MediaType("application/vnd.oci.empty.v1+json"), manifest.Config.MediaType)
+}
+
+func TestIndex(t *testing.T) {
+	index := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{
+		Add:        testImage(t, "test"),
+		Descriptor: v1.Descriptor{Annotations: map[string]string{"file": "test.txt"}},
+	})
+	index = mutate.Annotations(index, map[string]string{"kept": "yes"}).(v1.ImageIndex)
+
+	annotated, err := Index(index, map[string]string{"a": "b"})
+	require.NoError(t, err)
+	manifest, err := annotated.IndexManifest()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "b", "kept": "yes"}, manifest.Annotations)
+	require.Len(t, manifest.Manifests, 1)
+	assert.Equal(t, "test.txt", manifest.Manifests[0].Annotations["file"])
+
+	img, err := annotated.Image(manifest.Manifests[0].Digest)
+	require.NoError(t, err)
+	imgManifest, err := img.Manifest()
+	require.NoError(t, err)
+	assert.Equal(t, "b", imgManifest.Annotations["a"])
+}
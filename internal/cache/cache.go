@@ -0,0 +1,234 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package cache manages the local TUF cache, holding trusted metadata in a separate entry per source
+// so that mirroring different repositories never shares or mixes trusted state.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	sourceFile = "source.json" // describes the source of an entry
+	lockSuffix = ".lock"       // lock files are kept next to their entry
+)
+
+// ErrLocked is returned when a cache entry is locked by another run.
+var ErrLocked = errors.New("cache entry is locked")
+
+// Entry is the cache of a single source, identified by its metadata location and trusted root.
+type Entry struct {
+	Key      string    `json:"key"`
+	Path     string    `json:"path"`
+	Metadata string    `json:"metadata,omitempty"`
+	Root     string    `json:"root,omitempty"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// Key returns the key of the cache entry of a metadata location and the root trust is bootstrapped from.
+func Key(metadata string, root []byte) string {
+	h := sha256.New()
+	h.Write([]byte(strings.TrimSuffix(metadata, "/")))
+	h.Write([]byte{'\n'})
+	h.Write(root)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// New returns the cache entry of a metadata location and root below dir.
+func New(dir, metadata string, root []byte) *Entry {
+	rootDigest := sha256.Sum256(root)
+	key := Key(metadata, root)
+	return &Entry{
+		Key:      key,
+		Path:     filepath.Join(dir, key),
+		Metadata: strings.TrimSuffix(metadata, "/"),
+		Root:     hex.EncodeToString(rootDigest[:]),
+	}
+}
+
+// Create creates the directory of the cache entry and records its source, if it does not exist yet.
+// The entry must be locked.
+func (e *Entry) Create() error {
+	err := os.MkdirAll(e.Path, 0o755)
+	if err != nil {
+		return fmt.Errorf("failed to create cache directory %s: %w", e.Path, err)
+	}
+	path := filepath.Join(e.Path, sourceFile)
+	_, err = os.Stat(path)
+	if err == nil {
+		return nil
+	}
+	data, err := json.MarshalIndent(&Entry{Metadata: e.Metadata, Root: e.Root}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cache source: %w", err)
+	}
+	// write atomically so that listing the cache never reads a partial source
+	f, err := os.CreateTemp(e.Path, sourceFile)
+	if err != nil {
+		return fmt.Errorf("failed to write cache source: %w", err)
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("failed to write cache source: %w", err)
+	}
+	return nil
+}
+
+// List returns the cache entries below dir sorted by metadata location. Entries written before the cache was
+// namespaced by source have no metadata location.
+func List(dir string) ([]*Entry, error) {
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache directory %s: %w", dir, err)
+	}
+	var entries []*Entry
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		e, err := read(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Metadata != entries[j].Metadata {
+			return entries[i].Metadata < entries[j].Metadata
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	return entries, nil
+}
+
+// read reads the cache entry at path along with its size and last modification.
+func read(path string) (*Entry, error) {
+	e := &Entry{}
+	data, err := os.ReadFile(filepath.Join(path, sourceFile))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read cache source: %w", err)
+	}
+	if err == nil {
+		err = json.Unmarshal(data, e)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode cache source %s: %w", path, err)
+		}
+	}
+	e.Key = filepath.Base(path)
+	e.Path = path
+	err = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			e.Size += info.Size()
+		}
+		if info.ModTime().After(e.Modified) {
+			e.Modified = info.ModTime()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache entry %s: %w", path, err)
+	}
+	return e, nil
+}
+
+// Lock is an exclusive lock on a cache entry, held across processes.
+type Lock struct {
+	file *os.File
+}
+
+// Lock locks the cache entry, waiting until no other run holds it.
+func (e *Entry) Lock() (*Lock, error) {
+	return e.lock(true)
+}
+
+// TryLock locks the cache entry, returning ErrLocked if another run holds it.
+func (e *Entry) TryLock() (*Lock, error) {
+	return e.lock(false)
+}
+
+func (e *Entry) lock(wait bool) (*Lock, error) {
+	err := os.MkdirAll(filepath.Dir(e.Path), 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	f, err := os.OpenFile(e.Path+lockSuffix, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cache lock: %w", err)
+	}
+	err = lockFile(f, wait)
+	if err != nil {
+		f.Close()
+		if errors.Is(err, ErrLocked) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to lock cache entry %s: %w", e.Path, err)
+	}
+	return &Lock{file: f}, nil
+}
+
+// Unlock releases the lock.
+func (l *Lock) Unlock() error {
+	err := unlockFile(l.file)
+	if err != nil {
+		l.file.Close()
+		return fmt.Errorf("failed to unlock cache entry: %w", err)
+	}
+	return l.file.Close()
+}
+
+// Remove deletes the cache entry, returning ErrLocked if another run holds it. The lock file is kept: a run
+// waiting on it would otherwise hold a lock on an unlinked file while the next run locks a new one.
+func (e *Entry) Remove() error {
+	l, err := e.TryLock()
+	if err != nil {
+		return err
+	}
+	err = os.RemoveAll(e.Path)
+	if err != nil {
+		_ = l.Unlock()
+		return fmt.Errorf("failed to remove cache entry %s: %w", e.Path, err)
+	}
+	return l.Unlock()
+}
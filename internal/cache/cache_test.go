@@ -0,0 +1,97 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKey(t *testing.T) {
+	root := []byte(`{"signed":{}}`)
+	key := Key("https://example.com/metadata", root)
+	assert.Equal(t, key, Key("https://example.com/metadata/", root))
+	assert.NotEqual(t, key, Key("https://example.com/staging/metadata", root))
+	assert.NotEqual(t, key, Key("https://example.com/metadata", []byte(`{"signed":{"version":2}}`)))
+}
+
+func TestCreateAndList(t *testing.T) {
+	dir := t.TempDir()
+	prod := New(dir, "https://example.com/metadata", []byte("prod"))
+	staging := New(dir, "https://example.com/staging/metadata", []byte("staging"))
+	for _, e := range []*Entry{staging, prod} {
+		l, err := e.Lock()
+		require.NoError(t, err)
+		require.NoError(t, e.Create())
+		require.NoError(t, e.Create())
+		require.NoError(t, os.WriteFile(filepath.Join(e.Path, "root.json"), []byte("root"), 0o600))
+		require.NoError(t, l.Unlock())
+	}
+	// entries written before the cache was namespaced by source
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "legacy"), 0o755))
+
+	entries, err := List(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "legacy", entries[0].Key)
+	assert.Empty(t, entries[0].Metadata)
+	assert.Equal(t, prod.Key, entries[1].Key)
+	assert.Equal(t, "https://example.com/metadata", entries[1].Metadata)
+	assert.Equal(t, prod.Root, entries[1].Root)
+	assert.Equal(t, prod.Path, entries[1].Path)
+	assert.Positive(t, entries[1].Size)
+	assert.False(t, entries[1].Modified.IsZero())
+	assert.Equal(t, staging.Key, entries[2].Key)
+
+	entries, err = List(filepath.Join(dir, "missing"))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestLock(t *testing.T) {
+	e := New(t.TempDir(), "https://example.com/metadata", []byte("root"))
+	l, err := e.Lock()
+	require.NoError(t, err)
+	require.NoError(t, e.Create())
+
+	_, err = e.TryLock()
+	require.ErrorIs(t, err, ErrLocked)
+	// entries in use are not removed
+	require.ErrorIs(t, e.Remove(), ErrLocked)
+	_, err = os.Stat(e.Path)
+	require.NoError(t, err)
+
+	require.NoError(t, l.Unlock())
+	require.NoError(t, e.Remove())
+	_, err = os.Stat(e.Path)
+	assert.True(t, os.IsNotExist(err))
+	// the lock file is kept so that runs waiting on it keep locking the same file
+	_, err = os.Stat(e.Path + lockSuffix)
+	require.NoError(t, err)
+	l, err = e.TryLock()
+	require.NoError(t, err)
+	require.NoError(t, l.Unlock())
+
+	// lock files are not listed as entries
+	entries, err := List(filepath.Dir(e.Path))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,150 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config lists the mirror jobs run by sync.
+type Config struct {
+	Mirrors []*Mirror `yaml:"mirrors"`
+}
+
+// Mirror is a single mirror job from a source TUF repository to one or more destinations.
+type Mirror struct {
+	Name         string       `yaml:"name"`
+	Source       Source       `yaml:"source"`
+	Destinations Destinations `yaml:"destinations"`
+	Filters      Filters      `yaml:"filters"`
+	Options      Options      `yaml:"options"`
+}
+
+// Source is the TUF repository to mirror.
+type Source struct {
+	Metadata string `yaml:"metadata"`
+	Targets  string `yaml:"targets"`
+	// Root is a trusted root metadata file, relative paths are resolved against the config file.
+	// If empty the initial root is fetched from the source and trusted on first use.
+	Root string `yaml:"root"`
+}
+
+// Destinations are the metadata and targets locations to mirror to, either may be empty.
+type Destinations struct {
+	Metadata []string `yaml:"metadata"`
+	Targets  []string `yaml:"targets"`
+}
+
+// Filters limit the delegated roles and top-level targets that are mirrored, as glob patterns.
+type Filters struct {
+	Roles   []string `yaml:"roles"`
+	Targets []string `yaml:"targets"`
+}
+
+// Options are the mirror options, named after the corresponding command line flags.
+type Options struct {
+	Full                 bool              `yaml:"full"`
+	VersionTags          bool              `yaml:"version-tags"`
+	DateTag              bool              `yaml:"date-tag"`
+	ValidatePolicy       bool              `yaml:"validate-policy"`
+	Prune                bool              `yaml:"prune"`
+	PruneKeep            int               `yaml:"prune-keep"`
+	PruneDryRun          *bool             `yaml:"prune-dry-run"`
+	TargetTagTemplate    string            `yaml:"target-tag-template"`
+	DelegatedTagTemplate string            `yaml:"delegated-tag-template"`
+	Referrers            bool              `yaml:"referrers"`
+	SignKey              string            `yaml:"sign-key"`
+	SignMode             string            `yaml:"sign-mode"`
+	Provenance           bool              `yaml:"provenance"`
+	ProvenanceFile       string            `yaml:"provenance-file"`
+	Annotations          map[string]string `yaml:"annotations"`
+	Resume               bool              `yaml:"resume"`
+	RequireRootApproval  bool              `yaml:"require-approval-on-root-change"`
+}
+
+// Load reads and validates a config file.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	config, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	for _, m := range config.Mirrors {
+		if m.Source.Root != "" && !filepath.IsAbs(m.Source.Root) {
+			m.Source.Root = filepath.Join(filepath.Dir(path), m.Source.Root)
+		}
+		if m.Options.SignKey != "" && !filepath.IsAbs(m.Options.SignKey) {
+			m.Options.SignKey = filepath.Join(filepath.Dir(path), m.Options.SignKey)
+		}
+		if m.Options.ProvenanceFile != "" && !filepath.IsAbs(m.Options.ProvenanceFile) {
+			m.Options.ProvenanceFile = filepath.Join(filepath.Dir(path), m.Options.ProvenanceFile)
+		}
+	}
+	return config, nil
+}
+
+// Parse parses and validates config data, rejecting unknown fields.
+func Parse(data []byte) (*Config, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	config := &Config{}
+	err := dec.Decode(config)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	err = config.validate()
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (c *Config) validate() error {
+	if len(c.Mirrors) == 0 {
+		return fmt.Errorf("no mirrors configured")
+	}
+	names := map[string]bool{}
+	for i, m := range c.Mirrors {
+		if m.Name == "" {
+			return fmt.Errorf("mirror %d has no name", i+1)
+		}
+		if names[m.Name] {
+			return fmt.Errorf("duplicate mirror name %s", m.Name)
+		}
+		names[m.Name] = true
+		if m.Source.Metadata == "" {
+			return fmt.Errorf("mirror %s has no source metadata location", m.Name)
+		}
+		if len(m.Destinations.Metadata) == 0 && len(m.Destinations.Targets) == 0 {
+			return fmt.Errorf("mirror %s has no destinations", m.Name)
+		}
+		if len(m.Destinations.Targets) > 0 && m.Source.Targets == "" {
+			return fmt.Errorf("mirror %s has target destinations but no source targets location", m.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"valid", `
+mirrors:
+  - name: prod
+    source:
+      metadata: https://docker.github.io/tuf/metadata
+      targets: https://docker.github.io/tuf/targets
+    destinations:
+      metadata: [docker://registry.example.com/tuf-metadata:latest]
+      targets: [docker://registry.example.com/tuf-targets]
+    filters:
+      roles: [doi]
+    options:
+      full: true
+      prune-dry-run: false
+`, ""},
+		{"empty", "", "no mirrors configured"},
+		{"unknown field", "mirrors:\n  - name: prod\n    sources: {}\n", "field sources not found"},
+		// roots are only approved on the command line, never by a committed config
+		{"approve root", "mirrors:\n  - name: prod\n    options: {approve-root: sha256:abc}\n", "field approve-root not found"},
+		{"missing name", "mirrors:\n  - source: {metadata: https://example.com}\n", "mirror 1 has no name"},
+		{"duplicate name", `
+mirrors:
+  - name: prod
+    source: {metadata: https://example.com}
+    destinations: {metadata: [oci://metadata]}
+  - name: prod
+    source: {metadata: https://example.com}
+    destinations: {metadata: [oci://metadata]}
+`, "duplicate mirror name prod"},
+		{"missing source", "mirrors:\n  - name: prod\n", "has no source metadata location"},
+		{"missing destinations", "mirrors:\n  - name: prod\n    source: {metadata: https://example.com}\n", "has no destinations"},
+		{"missing source targets", `
+mirrors:
+  - name: prod
+    source: {metadata: https://example.com}
+    destinations: {targets: [oci://targets]}
+`, "has target destinations but no source targets location"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := Parse([]byte(tc.config))
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, config.Mirrors, 1)
+			m := config.Mirrors[0]
+			assert.Equal(t, "prod", m.Name)
+			assert.Equal(t, []string{"doi"}, m.Filters.Roles)
+			assert.True(t, m.Options.Full)
+			require.NotNil(t, m.Options.PruneDryRun)
+			assert.False(t, *m.Options.PruneDryRun)
+		})
+	}
+}
+
+func TestLoadResolvesRoot(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mirrors.yaml")
+	err := os.WriteFile(path, []byte(`
+mirrors:
+  - name: prod
+    source: {metadata: https://example.com, root: roots/root.json}
+    destinations: {metadata: [oci://metadata]}
+`), 0o600)
+	require.NoError(t, err)
+
+	config, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "roots", "root.json"), config.Mirrors[0].Source.Root)
+}
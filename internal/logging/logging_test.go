@@ -0,0 +1,69 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	testCases := []struct {
+		name     string
+		level    string
+		format   string
+		expected string
+		err      string
+	}{
+		{"text", "info", "text", "level=INFO msg=saved name=test\n", ""},
+		{"json", "INFO", "json", `"level":"INFO","msg":"saved","name":"test"}`, ""},
+		{"filtered", "warn", "text", "", ""},
+		{"invalid level", "verbose", "text", "", "invalid log level"},
+		{"invalid format", "info", "xml", "", "invalid log format"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			logger, err := New(b, tc.level, tc.format)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			logger.Debug("debug")
+			logger.Info("saved", "name", "test")
+			if tc.expected == "" {
+				assert.Empty(t, b.String())
+				return
+			}
+			assert.Contains(t, b.String(), tc.expected)
+			if tc.format == JSONFormat {
+				assert.True(t, json.Valid(b.Bytes()))
+			}
+		})
+	}
+}
+
+func TestDiscard(t *testing.T) {
+	assert.False(t, Discard().Enabled(context.Background(), slog.LevelError))
+}
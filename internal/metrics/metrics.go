@@ -0,0 +1,192 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package metrics exports Prometheus metrics of mirror runs, served on /metrics by long-running runs and
+// written to a node-exporter textfile by one-shot runs.
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	mirrortuf "github.com/docker/go-tuf-mirror/internal/tuf"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "go_tuf_mirror"
+
+// targetKinds are the kinds of saved manifests that count as targets.
+var targetKinds = map[string]bool{
+	"Target manifest":                 true,
+	"Delegated target index manifest": true,
+}
+
+// Metrics holds the metrics of the mirror runs of a process. It is a tufmirror.Observer.
+type Metrics struct {
+	registry      *prometheus.Registry
+	lastSuccess   *prometheus.GaugeVec
+	roleVersion   *prometheus.GaugeVec
+	targets       *prometheus.CounterVec
+	bytes         *prometheus.CounterVec
+	fetchDuration *prometheus.HistogramVec
+	pushDuration  *prometheus.HistogramVec
+	expiry        *expiryCollector
+}
+
+// New returns the metrics of a process, registered with a new registry.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		lastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "last_success_timestamp_seconds",
+			Help:      "Unix time of the last successful mirror run of a source.",
+		}, []string{"source"}),
+		roleVersion: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "role_version",
+			Help:      "Version of the verified metadata of a role.",
+		}, []string{"source", "role"}),
+		targets: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "targets_total",
+			Help:      "Target manifests and delegated target indexes by result: pushed, unchanged, skipped or failed.",
+		}, []string{"destination", "result"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "bytes_total",
+			Help:      "Bytes of manifests and layers fetched from sources or pushed to destinations.",
+		}, []string{"direction"}),
+		fetchDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "fetch_duration_seconds",
+			Help:      "Latency of fetching and verifying metadata and targets from a source.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+		pushDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "push_duration_seconds",
+			Help:      "Latency of saving a manifest to a destination.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"kind"}),
+		expiry: &expiryCollector{
+			desc: prometheus.NewDesc(namespace+"_role_expiry_seconds",
+				"Seconds until the verified metadata of a role expires, negative once expired.",
+				[]string{"source", "role"}, nil),
+			expires: map[[2]string]time.Time{},
+			now:     time.Now,
+		},
+	}
+	m.registry.MustRegister(m.lastSuccess, m.roleVersion, m.targets, m.bytes, m.fetchDuration, m.pushDuration, m.expiry)
+	return m
+}
+
+// ObserveFetch records the latency and bytes of a fetch from a source.
+func (m *Metrics) ObserveFetch(operation string, bytes int64, duration time.Duration, err error) {
+	m.fetchDuration.WithLabelValues(operation).Observe(duration.Seconds())
+	if err == nil {
+		m.bytes.WithLabelValues("fetched").Add(float64(bytes))
+	}
+}
+
+// ObserveSave records the latency of a manifest saved to a destination and counts saved targets. Only manifests
+// the destination did not hold before count as pushed, along with their bytes.
+func (m *Metrics) ObserveSave(destination, kind string, bytes int64, duration time.Duration, changed bool, err error) {
+	m.pushDuration.WithLabelValues(label(kind)).Observe(duration.Seconds())
+	result := "pushed"
+	switch {
+	case err != nil:
+		result = "failed"
+	case !changed:
+		result = "unchanged"
+	default:
+		m.bytes.WithLabelValues("pushed").Add(float64(bytes))
+	}
+	if targetKinds[kind] {
+		m.targets.WithLabelValues(destination, result).Inc()
+	}
+}
+
+// ObserveSkip counts targets already saved to a destination.
+func (m *Metrics) ObserveSkip(destination, kind string) {
+	if targetKinds[kind] {
+		m.targets.WithLabelValues(destination, "skipped").Inc()
+	}
+}
+
+// SetRoles records the versions and expiry of the verified roles of a source.
+func (m *Metrics) SetRoles(source string, roles []*mirrortuf.Role) {
+	for _, role := range roles {
+		m.roleVersion.WithLabelValues(source, role.Name).Set(float64(role.Version))
+		m.expiry.set(source, role.Name, role.Expires)
+	}
+}
+
+// SetLastSuccess records the time of a successful mirror run of a source.
+func (m *Metrics) SetLastSuccess(source string, t time.Time) {
+	m.lastSuccess.WithLabelValues(source).Set(float64(t.Unix()))
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// WriteTextfile atomically writes the metrics to a file for the node-exporter textfile collector.
+func (m *Metrics) WriteTextfile(path string) error {
+	err := prometheus.WriteToTextfile(path, m.registry)
+	if err != nil {
+		return fmt.Errorf("failed to write metrics textfile: %w", err)
+	}
+	return nil
+}
+
+// label turns a manifest kind into a label value, e.g. "Target manifest" into "target_manifest".
+func label(kind string) string {
+	return strings.ReplaceAll(strings.ToLower(kind), " ", "_")
+}
+
+// expiryCollector reports the seconds until roles expire at collection time, so that the value stays
+// current between mirror runs.
+type expiryCollector struct {
+	desc    *prometheus.Desc
+	mu      sync.Mutex
+	expires map[[2]string]time.Time
+	now     func() time.Time
+}
+
+func (c *expiryCollector) set(source, role string, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expires[[2]string{source, role}] = expires
+}
+
+func (c *expiryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *expiryCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for key, expires := range c.expires {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, expires.Sub(now).Seconds(), key[0], key[1])
+	}
+}
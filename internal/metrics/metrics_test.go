@@ -0,0 +1,93 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	mirrortuf "github.com/docker/go-tuf-mirror/internal/tuf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := New()
+	m.expiry.now = func() time.Time { return now }
+
+	m.ObserveFetch("metadata", 100, time.Second, nil)
+	m.ObserveFetch("targets", 50, time.Second, errors.New("failed"))
+	m.ObserveSave("oci://dst", "Target manifest", 10, time.Second, true, nil)
+	m.ObserveSave("oci://dst", "Target manifest", 10, time.Second, false, nil)
+	m.ObserveSave("oci://dst", "Target manifest", 10, time.Second, true, errors.New("failed"))
+	m.ObserveSave("oci://dst", "Metadata manifest", 20, time.Second, true, nil)
+	m.ObserveSkip("oci://dst", "Target manifest")
+	m.ObserveSkip("oci://dst", "Metadata manifest")
+	m.SetRoles("https://src", []*mirrortuf.Role{
+		{Name: "timestamp", Version: 7, Expires: now.Add(time.Hour)},
+		{Name: "root", Version: 1, Expires: now.Add(-time.Minute)},
+	})
+	m.SetLastSuccess("https://src", now)
+
+	server := httptest.NewServer(m.Handler())
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	out := string(body)
+
+	for _, line := range []string{
+		`go_tuf_mirror_bytes_total{direction="fetched"} 100`,
+		`go_tuf_mirror_bytes_total{direction="pushed"} 30`,
+		`go_tuf_mirror_targets_total{destination="oci://dst",result="pushed"} 1`,
+		`go_tuf_mirror_targets_total{destination="oci://dst",result="unchanged"} 1`,
+		`go_tuf_mirror_targets_total{destination="oci://dst",result="failed"} 1`,
+		`go_tuf_mirror_targets_total{destination="oci://dst",result="skipped"} 1`,
+		`go_tuf_mirror_fetch_duration_seconds_count{operation="targets"} 1`,
+		`go_tuf_mirror_push_duration_seconds_count{kind="target_manifest"} 3`,
+		`go_tuf_mirror_push_duration_seconds_count{kind="metadata_manifest"} 1`,
+		`go_tuf_mirror_role_version{role="timestamp",source="https://src"} 7`,
+		`go_tuf_mirror_role_expiry_seconds{role="timestamp",source="https://src"} 3600`,
+		`go_tuf_mirror_role_expiry_seconds{role="root",source="https://src"} -60`,
+		`go_tuf_mirror_last_success_timestamp_seconds{source="https://src"} 1.7040672e+09`,
+	} {
+		assert.Contains(t, out, line+"\n")
+	}
+}
+
+func TestWriteTextfile(t *testing.T) {
+	m := New()
+	m.SetLastSuccess("https://src", time.Unix(1, 0))
+
+	path := filepath.Join(t.TempDir(), "go_tuf_mirror.prom")
+	require.NoError(t, m.WriteTextfile(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `go_tuf_mirror_last_success_timestamp_seconds{source="https://src"} 1`+"\n")
+
+	err = m.WriteTextfile(filepath.Join(path, "invalid"))
+	require.ErrorContains(t, err, "failed to write metrics textfile")
+}
@@ -0,0 +1,190 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package notify posts JSON events of mirror runs to webhooks, optionally signed with an HMAC of the body and
+// the time it was sent.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SignatureHeader holds the HMAC-SHA256 of the timestamp and the body, as sha256=<hex>, when a secret is
+	// configured.
+	SignatureHeader = "X-Go-Tuf-Mirror-Signature"
+	// TimestampHeader holds the time the event was sent, in seconds since the Unix epoch, when a secret is
+	// configured. It is covered by the signature, so receivers can reject replayed events.
+	TimestampHeader = "X-Go-Tuf-Mirror-Timestamp"
+	// EventHeader holds the type of the event.
+	EventHeader = "X-Go-Tuf-Mirror-Event"
+	// RunEvent is the type of the event sent after a mirror run.
+	RunEvent = "run"
+)
+
+// Event describes a mirror run.
+type Event struct {
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	Metadata string    `json:"metadata"`
+	Targets  string    `json:"targets"`
+	Success  bool      `json:"success"`
+	Error    string    `json:"error,omitempty"`
+	// Roles are the versions of the verified roles, empty if the metadata could not be verified.
+	Roles        []*Role        `json:"roles,omitempty"`
+	Destinations []*Destination `json:"destinations"`
+}
+
+// Role is the version of a verified role.
+type Role struct {
+	Name    string `json:"name"`
+	Version int64  `json:"version"`
+}
+
+// Destination is the outcome of a run at one destination.
+type Destination struct {
+	// Kind is what was mirrored to the destination, metadata or targets.
+	Kind     string `json:"kind"`
+	Location string `json:"location"`
+	Success  bool   `json:"success"`
+	Error    string `json:"error,omitempty"`
+	// Manifests are the manifests saved to the destination, including those it already held.
+	Manifests []*Manifest `json:"manifests"`
+	// Changed are the saved manifests the destination did not hold before the run.
+	Changed []*Manifest `json:"changed"`
+}
+
+// Manifest is a manifest saved to a destination.
+type Manifest struct {
+	Name   string `json:"name"`
+	Digest string `json:"digest"`
+}
+
+// Notifier posts events to webhooks.
+type Notifier struct {
+	urls   []string
+	secret []byte
+	client *http.Client
+}
+
+// New returns a notifier posting to urls. Events are signed with the secret, unless it is empty.
+func New(urls []string, secret []byte) *Notifier {
+	return &Notifier{
+		urls:   urls,
+		secret: secret,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// LoadSecret reads a webhook secret from a file, ignoring surrounding whitespace. An empty path returns no secret.
+func LoadSecret(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notify secret: %w", err)
+	}
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return nil, fmt.Errorf("notify secret is empty: %s", path)
+	}
+	return []byte(secret), nil
+}
+
+// Sign returns the signature header value of a body sent at timestamp, the HMAC of "<timestamp>.<body>".
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether a signature header value matches a body sent at timestamp, and the timestamp is
+// within tolerance of the current time, for receivers of events.
+func Verify(secret, body []byte, timestamp, signature string, tolerance time.Duration) bool {
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := time.Since(time.Unix(sec, 0))
+	if age > tolerance || age < -tolerance {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// URLs returns the webhooks events are posted to.
+func (n *Notifier) URLs() []string {
+	return n.urls
+}
+
+// Notify posts an event to every webhook. Every webhook is tried, failures are returned together.
+func (n *Notifier) Notify(ctx context.Context, event *Event) error {
+	var errs []error
+	for _, url := range n.urls {
+		err := n.NotifyURL(ctx, url, event)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NotifyURL posts an event to a single webhook.
+func (n *Notifier) NotifyURL(ctx context.Context, url string, event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	return n.post(ctx, url, event.Type, body)
+}
+
+func (n *Notifier) post(ctx context.Context, url, eventType string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, eventType)
+	if len(n.secret) > 0 {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, Sign(n.secret, timestamp, body))
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to notify %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to notify %s: unexpected status %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotify(t *testing.T) {
+	secret := []byte("secret")
+	var bodies [][]byte
+	var signatures, timestamps []string
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, RunEvent, r.Header.Get(EventHeader))
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		bodies = append(bodies, body)
+		signatures = append(signatures, r.Header.Get(SignatureHeader))
+		timestamps = append(timestamps, r.Header.Get(TimestampHeader))
+	}))
+	defer hook.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	event := &Event{
+		Type:     RunEvent,
+		Metadata: "https://example.com/metadata",
+		Success:  true,
+		Roles:    []*Role{{Name: "timestamp", Version: 7}},
+		Destinations: []*Destination{{
+			Kind:      "metadata",
+			Location:  "oci://metadata",
+			Success:   true,
+			Manifests: []*Manifest{{Name: "metadata", Digest: "sha256:abc"}},
+		}},
+	}
+
+	// every webhook is tried, even after a failed one
+	err := New([]string{failing.URL, hook.URL}, secret).Notify(context.Background(), event)
+	require.ErrorContains(t, err, "failed to notify "+failing.URL+": unexpected status 500")
+	err = New([]string{hook.URL}, nil).Notify(context.Background(), event)
+	require.NoError(t, err)
+
+	require.Len(t, bodies, 2)
+	assert.True(t, Verify(secret, bodies[0], timestamps[0], signatures[0], time.Minute))
+	assert.False(t, Verify([]byte("other"), bodies[0], timestamps[0], signatures[0], time.Minute))
+	// the timestamp is signed, so an event can not be replayed with a later one
+	later := strconv.FormatInt(time.Now().Add(time.Second).Unix()+1, 10)
+	assert.False(t, Verify(secret, bodies[0], later, signatures[0], time.Minute))
+	// stale events are rejected
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	assert.False(t, Verify(secret, bodies[0], old, Sign(secret, old, bodies[0]), time.Minute))
+	assert.False(t, Verify(secret, bodies[0], "invalid", signatures[0], time.Minute))
+	// without a secret events are not signed
+	assert.Empty(t, signatures[1])
+	assert.Empty(t, timestamps[1])
+
+	received := &Event{}
+	require.NoError(t, json.Unmarshal(bodies[0], received))
+	assert.Equal(t, event, received)
+}
+
+func TestLoadSecret(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secret")
+	require.NoError(t, os.WriteFile(path, []byte("secret\n"), 0o600))
+	empty := filepath.Join(dir, "empty")
+	require.NoError(t, os.WriteFile(empty, []byte("\n"), 0o600))
+
+	secret, err := LoadSecret(path)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("secret"), secret)
+
+	secret, err = LoadSecret("")
+	require.NoError(t, err)
+	assert.Nil(t, secret)
+
+	_, err = LoadSecret(empty)
+	require.ErrorContains(t, err, "notify secret is empty")
+	_, err = LoadSecret(filepath.Join(dir, "missing"))
+	require.ErrorContains(t, err, "failed to read notify secret")
+}
@@ -0,0 +1,195 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/docker/attest/mapping"
+	attestpolicy "github.com/docker/attest/policy"
+	"github.com/docker/attest/tuf"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/theupdateframework/go-tuf/v2/metadata"
+)
+
+// FetchFunc returns the verified contents of a target file.
+type FetchFunc func(target string) ([]byte, error)
+
+// Result describes the policy material found in a role.
+type Result struct {
+	Role     string
+	Mappings []string
+	Policies []string
+}
+
+// Validate validates the policy material of the top-level targets role and, if delegated is set,
+// of every delegated targets role known to the TUF client.
+func Validate(ctx context.Context, client *tuf.Client, delegated bool) ([]*Result, error) {
+	dir, err := os.MkdirTemp("", "go-tuf-mirror-policy")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	fetch := func(target string) ([]byte, error) {
+		file, err := client.DownloadTarget(target, filepath.Join(dir, filepath.FromSlash(target)))
+		if err != nil {
+			return nil, err
+		}
+		return file.Data, nil
+	}
+
+	md := client.GetMetadata()
+	top := md.Targets[metadata.TARGETS]
+	result, err := ValidateRole(ctx, metadata.TARGETS, top.Signed.Targets, fetch)
+	if err != nil {
+		return nil, err
+	}
+	results := []*Result{result}
+	if !delegated || top.Signed.Delegations == nil {
+		return results, nil
+	}
+	for _, role := range top.Signed.Delegations.Roles {
+		roleMeta, err := client.LoadDelegatedTargets(role.Name, metadata.TARGETS)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load delegated targets metadata: %w", err)
+		}
+		result, err := ValidateRole(ctx, role.Name, roleMeta.Signed.Targets, fetch)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// ValidateRole validates every policy mapping in the targets of a role.
+// Each mapping must parse, every file it references must be a target of the same role
+// and the Rego files of each policy must compile.
+func ValidateRole(ctx context.Context, role string, targets map[string]*metadata.TargetFiles, fetch FetchFunc) (*Result, error) {
+	result := &Result{Role: role}
+	var validationErrors []error
+	for _, target := range sortedTargets(targets) {
+		if path.Base(target) != mapping.MappingFilename {
+			continue
+		}
+		result.Mappings = append(result.Mappings, target)
+		data, err := fetch(target)
+		if err != nil {
+			validationErrors = append(validationErrors, fmt.Errorf("failed to fetch policy mapping %s: %w", target, err))
+			continue
+		}
+		mappings, err := parseMappings(data)
+		if err != nil {
+			validationErrors = append(validationErrors, fmt.Errorf("failed to parse policy mapping %s: %w", target, err))
+			continue
+		}
+		for _, id := range sortedPolicies(mappings.Policies) {
+			err = validatePolicy(ctx, target, mappings.Policies[id], targets, fetch)
+			if err != nil {
+				validationErrors = append(validationErrors, fmt.Errorf("invalid policy %s in %s: %w", id, target, err))
+				continue
+			}
+			result.Policies = append(result.Policies, id)
+		}
+	}
+	if len(validationErrors) > 0 {
+		return nil, fmt.Errorf("policy validation failed for role %s: %w", role, errors.Join(validationErrors...))
+	}
+	return result, nil
+}
+
+// validatePolicy checks that all files of a policy of the mapping target are role targets and compiles its
+// Rego modules.
+func validatePolicy(ctx context.Context, mappingTarget string, p *mapping.PolicyMapping, targets map[string]*metadata.TargetFiles, fetch FetchFunc) error {
+	var regoOpts []func(*rego.Rego)
+	for _, f := range p.Files {
+		target, ok := policyTarget(mappingTarget, f.Path, targets)
+		if !ok {
+			return fmt.Errorf("policy file %s is not a target in the same role", f.Path)
+		}
+		if filepath.Ext(target) != ".rego" {
+			continue
+		}
+		data, err := fetch(target)
+		if err != nil {
+			return fmt.Errorf("failed to fetch policy file %s: %w", target, err)
+		}
+		regoOpts = append(regoOpts, rego.Module(target, string(data)))
+	}
+	if len(regoOpts) == 0 {
+		return nil
+	}
+	regoOpts = append(regoOpts, rego.Query(attestpolicy.DefaultQuery))
+	// register the attest builtins so that policies calling them compile
+	for _, custom := range attestpolicy.RegoFunctions(attestpolicy.NewRegoFunctionOptions(nil, nil)) {
+		regoOpts = append(regoOpts, custom.Func)
+	}
+	_, err := rego.New(regoOpts...).PrepareForEval(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to compile rego: %w", err)
+	}
+	return nil
+}
+
+// policyTarget returns the target of a policy file path. Paths are relative to the directory of the mapping,
+// like files of local policies, or else name the target as is, like files of TUF policies.
+func policyTarget(mappingTarget, file string, targets map[string]*metadata.TargetFiles) (string, bool) {
+	for _, target := range []string{path.Join(path.Dir(mappingTarget), file), file} {
+		if _, ok := targets[target]; ok {
+			return target, true
+		}
+	}
+	return "", false
+}
+
+// parseMappings parses policy mapping data using the attest mapping loader.
+func parseMappings(data []byte) (*mapping.PolicyMappings, error) {
+	dir, err := os.MkdirTemp("", "go-tuf-mirror-mapping")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	err = os.WriteFile(filepath.Join(dir, mapping.MappingFilename), data, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write policy mapping: %w", err)
+	}
+	return mapping.LoadLocalMappings(dir)
+}
+
+func sortedTargets(targets map[string]*metadata.TargetFiles) []string {
+	names := make([]string, 0, len(targets))
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedPolicies(policies map[string]*mapping.PolicyMapping) []string {
+	ids := make([]string, 0, len(policies))
+	for id := range policies {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
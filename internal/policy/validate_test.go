@@ -0,0 +1,85 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package policy
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/go-tuf/v2/metadata"
+)
+
+const (
+	testMapping = `version: v1
+kind: policy-mapping
+policies:
+  - id: test
+    description: test policy
+    files:
+      - path: test.rego
+`
+	testRego = `package attest
+
+import rego.v1
+
+result := {"success": true, "violations": set(), "summary": {}}
+`
+)
+
+func TestValidateRole(t *testing.T) {
+	testCases := []struct {
+		name  string
+		files map[string]string
+		err   string
+	}{
+		{"valid policy", map[string]string{"mapping.yaml": testMapping, "test.rego": testRego}, ""},
+		{"no mapping", map[string]string{"test.rego": testRego}, ""},
+		{"mapping in subdirectory", map[string]string{"doi/mapping.yaml": testMapping, "doi/test.rego": testRego}, ""},
+		{"mapping in subdirectory with target path", map[string]string{"doi/mapping.yaml": testMapping, "test.rego": testRego}, ""},
+		{"missing policy file", map[string]string{"mapping.yaml": testMapping}, "policy file test.rego is not a target in the same role"},
+		{"missing policy file in subdirectory", map[string]string{"doi/mapping.yaml": testMapping, "other/test.rego": testRego}, "policy file test.rego is not a target in the same role"},
+		{"invalid rego", map[string]string{"mapping.yaml": testMapping, "test.rego": "package attest\n\nresult := {"}, "failed to compile rego"},
+		{"invalid mapping kind", map[string]string{"mapping.yaml": "version: v1\nkind: other\n"}, "file is not of kind policy-mapping"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			targets := map[string]*metadata.TargetFiles{}
+			for name := range tc.files {
+				targets[name] = &metadata.TargetFiles{Path: name}
+			}
+			fetch := func(target string) ([]byte, error) {
+				data, ok := tc.files[target]
+				if !ok {
+					return nil, fmt.Errorf("target not found: %s", target)
+				}
+				return []byte(data), nil
+			}
+
+			_, err := ValidateRole(context.Background(), metadata.TARGETS, targets, fetch)
+			if tc.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
@@ -0,0 +1,186 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package provenance describes mirror runs as in-toto statements with a SLSA provenance predicate,
+// recording where mirrored data came from and what was produced from it.
+package provenance
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/docker/attest/attestation"
+	"github.com/docker/attest/oci"
+	"github.com/docker/go-tuf-mirror/internal/referrers"
+	mirrortuf "github.com/docker/go-tuf-mirror/internal/tuf"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+	slsa "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v1"
+)
+
+const (
+	// BuilderID identifies the mirror as the builder of the mirrored artifacts.
+	BuilderID = "https://github.com/docker/go-tuf-mirror"
+	// BuildType describes how the external parameters of a mirror run are interpreted.
+	BuildType = "https://github.com/docker/go-tuf-mirror/mirror@v1"
+	// ArtifactType is the artifact type of provenance attestations attached as referrers.
+	ArtifactType = intoto.PayloadType
+)
+
+// Run describes a mirror run.
+type Run struct {
+	// Command is the mirror command, metadata or targets.
+	Command string
+	// Metadata and Targets are the source locations.
+	Metadata string
+	Targets  string
+	// Destinations are the destination locations.
+	Destinations []string
+	// RootLocation is where the trusted root was read from and Root its content.
+	RootLocation string
+	Root         []byte
+	// Roles are the verified roles the mirrored data was taken from.
+	Roles []*mirrortuf.Role
+	// Version is the version of the mirror.
+	Version   string
+	StartedOn time.Time
+}
+
+// Subjects maps the names of mirrored manifests to their digests.
+type Subjects map[string]v1.Hash
+
+// ExternalParameters are the user controlled parameters of a mirror run.
+type ExternalParameters struct {
+	Command      string   `json:"command"`
+	Metadata     string   `json:"metadata"`
+	Targets      string   `json:"targets,omitempty"`
+	Destinations []string `json:"destinations"`
+}
+
+// InternalParameters are the parameters of a mirror run taken from the verified TUF metadata.
+type InternalParameters struct {
+	Roles []*RoleVersion `json:"roles"`
+}
+
+// RoleVersion is the version and expiry of a verified role.
+type RoleVersion struct {
+	Name    string    `json:"name"`
+	Version int64     `json:"version"`
+	Expires time.Time `json:"expires"`
+}
+
+// Add records a mirrored manifest under name.
+func (s Subjects) Add(name string, m referrers.Manifest) error {
+	digest, err := m.Digest()
+	if err != nil {
+		return fmt.Errorf("failed to get digest of %s: %w", name, err)
+	}
+	s[name] = digest
+	return nil
+}
+
+// Statement returns the in-toto statement of the run that produced subjects, finished at finishedOn.
+func (r *Run) Statement(subjects Subjects, finishedOn time.Time) *intoto.Statement {
+	names := make([]string, 0, len(subjects))
+	for name := range subjects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	statementSubjects := make([]intoto.Subject, 0, len(names))
+	for _, name := range names {
+		digest := subjects[name]
+		statementSubjects = append(statementSubjects, intoto.Subject{
+			Name:   name,
+			Digest: common.DigestSet{digest.Algorithm: digest.Hex},
+		})
+	}
+
+	roles := make([]*RoleVersion, 0, len(r.Roles))
+	for _, role := range r.Roles {
+		roles = append(roles, &RoleVersion{Name: role.Name, Version: role.Version, Expires: role.Expires})
+	}
+	rootDigest := sha256.Sum256(r.Root)
+	startedOn := r.StartedOn.UTC()
+	finishedOn = finishedOn.UTC()
+
+	return &intoto.Statement{
+		StatementHeader: intoto.StatementHeader{
+			Type:          intoto.StatementInTotoV01,
+			PredicateType: slsa.PredicateSLSAProvenance,
+			Subject:       statementSubjects,
+		},
+		Predicate: slsa.ProvenancePredicate{
+			BuildDefinition: slsa.ProvenanceBuildDefinition{
+				BuildType: BuildType,
+				ExternalParameters: ExternalParameters{
+					Command:      r.Command,
+					Metadata:     r.Metadata,
+					Targets:      r.Targets,
+					Destinations: r.Destinations,
+				},
+				InternalParameters: InternalParameters{Roles: roles},
+				ResolvedDependencies: []slsa.ResourceDescriptor{{
+					Name:   "root.json",
+					URI:    r.RootLocation,
+					Digest: common.DigestSet{"sha256": hex.EncodeToString(rootDigest[:])},
+				}},
+			},
+			RunDetails: slsa.ProvenanceRunDetails{
+				Builder: slsa.Builder{
+					ID:      BuilderID,
+					Version: map[string]string{"go-tuf-mirror": r.Version},
+				},
+				BuildMetadata: slsa.BuildMetadata{
+					StartedOn:  &startedOn,
+					FinishedOn: &finishedOn,
+				},
+			},
+		},
+	}
+}
+
+// NewAttestation returns an artifact referring to subject that holds the in-toto statement.
+func NewAttestation(subject v1.Descriptor, statement *intoto.Statement) (v1.Image, error) {
+	data, err := json.Marshal(statement)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal provenance statement: %w", err)
+	}
+	img := empty.Image
+	img = mutate.MediaType(img, types.OCIManifestSchema1)
+	img = mutate.ConfigMediaType(img, types.OCIConfigJSON)
+	img = mutate.ArtifactType(img, ArtifactType)
+	img, err = mutate.Append(img, mutate.Addendum{
+		Layer:       static.NewLayer(data, intoto.PayloadType),
+		Annotations: map[string]string{attestation.InTotoPredicateType: statement.PredicateType},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to append provenance layer: %w", err)
+	}
+	att, ok := mutate.Subject(img, referrers.Descriptor(subject)).(v1.Image)
+	if !ok {
+		return nil, fmt.Errorf("failed to set provenance subject")
+	}
+	return &oci.EmptyConfigImage{Image: att}, nil
+}
@@ -0,0 +1,66 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package prune
+
+import (
+	"regexp"
+	"sort"
+)
+
+// targetTag matches the <sha256>.<name> tags used for top-level targets.
+var targetTag = regexp.MustCompile(`^([0-9a-f]{64})\.(.+)$`)
+
+// Plan lists the target tags of a destination that are kept and pruned.
+type Plan struct {
+	Keep  []string
+	Prune []string
+}
+
+// NewPlan decides which target tags to prune.
+// current maps each target name to its current sha256 hash, previous maps each target name to its
+// previous hashes, newest first, of which the first keep are retained.
+// Tags that are not target tags, such as delegated role indexes, are never pruned.
+func NewPlan(tags []string, current map[string]string, previous map[string][]string, keep int) *Plan {
+	plan := &Plan{}
+	sorted := append([]string{}, tags...)
+	sort.Strings(sorted)
+	for _, tag := range sorted {
+		match := targetTag.FindStringSubmatch(tag)
+		if match == nil {
+			continue
+		}
+		hash, target := match[1], match[2]
+		if current[target] == hash || isRecent(previous[target], hash, keep) {
+			plan.Keep = append(plan.Keep, tag)
+			continue
+		}
+		plan.Prune = append(plan.Prune, tag)
+	}
+	return plan
+}
+
+func isRecent(hashes []string, hash string, keep int) bool {
+	for i, h := range hashes {
+		if i >= keep {
+			return false
+		}
+		if h == hash {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package prune
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPlan(t *testing.T) {
+	hash := func(c string) string { return strings.Repeat(c, 64) }
+	tags := []string{
+		hash("a") + ".policy.rego",
+		hash("b") + ".policy.rego",
+		hash("c") + ".policy.rego",
+		hash("d") + ".policy.rego",
+		hash("e") + ".removed.txt",
+		"test-role",
+		"latest",
+	}
+	current := map[string]string{"policy.rego": hash("a")}
+	previous := map[string][]string{"policy.rego": {hash("b"), hash("c")}, "removed.txt": {hash("e")}}
+
+	testCases := []struct {
+		name  string
+		keep  int
+		prune []string
+	}{
+		{"keep none", 0, []string{hash("b") + ".policy.rego", hash("c") + ".policy.rego", hash("d") + ".policy.rego", hash("e") + ".removed.txt"}},
+		{"keep one", 1, []string{hash("c") + ".policy.rego", hash("d") + ".policy.rego"}},
+		{"keep all", 5, []string{hash("d") + ".policy.rego"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			plan := NewPlan(tags, current, previous, tc.keep)
+			assert.Equal(t, tc.prune, plan.Prune)
+			assert.Len(t, plan.Keep, 5-len(tc.prune))
+		})
+	}
+}
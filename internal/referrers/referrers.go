@@ -0,0 +1,88 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package referrers builds OCI 1.1 referrers that attach TUF metadata to mirrored targets,
+// so registry tooling can discover the metadata vouching for a target without knowing the mirror tag conventions.
+package referrers
+
+import (
+	"fmt"
+
+	"github.com/docker/attest/oci"
+	"github.com/docker/attest/tuf"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+const (
+	// TargetsArtifactType is the artifact type of referrers holding the targets metadata of a target.
+	TargetsArtifactType = "application/vnd.tuf.metadata.targets+json"
+	// MetadataMediaType is the media type of TUF metadata layers, as used by the mirror.
+	MetadataMediaType = "application/vnd.tuf.metadata+json"
+)
+
+// NewTargetsReferrer returns an artifact referring to subject that holds the signed targets metadata,
+// including its signatures, of the role that lists the target. filename is annotated on the metadata layer.
+func NewTargetsReferrer(subject v1.Descriptor, filename string, metadata []byte) (v1.Image, error) {
+	img := empty.Image
+	img = mutate.MediaType(img, types.OCIManifestSchema1)
+	img = mutate.ConfigMediaType(img, types.OCIConfigJSON)
+	img = mutate.ArtifactType(img, TargetsArtifactType)
+	img, err := mutate.Append(img, mutate.Addendum{
+		Layer:       static.NewLayer(metadata, MetadataMediaType),
+		Annotations: map[string]string{tuf.TUFFileNameAnnotation: filename},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to append metadata layer: %w", err)
+	}
+	referrer, ok := mutate.Subject(img, Descriptor(subject)).(v1.Image)
+	if !ok {
+		return nil, fmt.Errorf("failed to set referrer subject")
+	}
+	return &oci.EmptyConfigImage{Image: referrer}, nil
+}
+
+// Descriptor returns the subject descriptor for a manifest descriptor, dropping annotations and platform.
+func Descriptor(desc v1.Descriptor) v1.Descriptor {
+	return v1.Descriptor{MediaType: desc.MediaType, Digest: desc.Digest, Size: desc.Size}
+}
+
+// Manifest is an image or image index manifest.
+type Manifest interface {
+	RawManifest() ([]byte, error)
+	Digest() (v1.Hash, error)
+	MediaType() (types.MediaType, error)
+}
+
+// Describe returns the descriptor of an image or image index manifest.
+func Describe(m Manifest) (v1.Descriptor, error) {
+	raw, err := m.RawManifest()
+	if err != nil {
+		return v1.Descriptor{}, fmt.Errorf("failed to get manifest: %w", err)
+	}
+	digest, err := m.Digest()
+	if err != nil {
+		return v1.Descriptor{}, fmt.Errorf("failed to get digest: %w", err)
+	}
+	mediaType, err := m.MediaType()
+	if err != nil {
+		return v1.Descriptor{}, fmt.Errorf("failed to get media type: %w", err)
+	}
+	return v1.Descriptor{MediaType: mediaType, Digest: digest, Size: int64(len(raw))}, nil
+}
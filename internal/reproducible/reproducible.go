@@ -0,0 +1,164 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package reproducible makes mirrored manifests deterministic, so mirroring unchanged TUF metadata
+// produces byte-identical manifests and pushes of unchanged manifests are no-ops.
+package reproducible
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/attest/mirror"
+	"github.com/docker/attest/oci"
+	"github.com/docker/attest/tuf"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+)
+
+// SourceDateEpochEnv is the environment variable holding the timestamp to use instead of the
+// current time, see https://reproducible-builds.org/specs/source-date-epoch/.
+const SourceDateEpochEnv = "SOURCE_DATE_EPOCH"
+
+// SourceDateEpoch returns the time set in SOURCE_DATE_EPOCH, or the zero time if it is not set.
+func SourceDateEpoch() (time.Time, error) {
+	value := os.Getenv(SourceDateEpochEnv)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s %q: %w", SourceDateEpochEnv, value, err)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// Image returns the image with its layers in a deterministic order: by TUF role, in the order the
+// mirror adds roles, then by metadata version and file name.
+func Image(img *oci.EmptyConfigImage) (*oci.EmptyConfigImage, error) {
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image manifest: %w", err)
+	}
+	descs := append([]v1.Descriptor{}, manifest.Layers...)
+	sort.SliceStable(descs, func(i, j int) bool {
+		return lessFile(descs[i].Annotations[tuf.TUFFileNameAnnotation], descs[j].Annotations[tuf.TUFFileNameAnnotation])
+	})
+
+	base := empty.Image
+	base = mutate.MediaType(base, manifest.MediaType)
+	base = mutate.ConfigMediaType(base, manifest.Config.MediaType)
+	addenda := make([]mutate.Addendum, 0, len(descs))
+	for _, desc := range descs {
+		layer, err := img.LayerByDigest(desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read layer %s: %w", desc.Digest, err)
+		}
+		addenda = append(addenda, mutate.Addendum{Layer: layer, Annotations: desc.Annotations, MediaType: desc.MediaType})
+	}
+	sorted, err := mutate.Append(base, addenda...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to append layers: %w", err)
+	}
+	if len(manifest.Annotations) > 0 {
+		var ok bool
+		sorted, ok = mutate.Annotations(sorted, manifest.Annotations).(v1.Image)
+		if !ok {
+			return nil, fmt.Errorf("failed to annotate image")
+		}
+	}
+	return &oci.EmptyConfigImage{Image: sorted}, nil
+}
+
+// Index returns the index with its manifests ordered by the TUF file name they are annotated with.
+func Index(index v1.ImageIndex) (v1.ImageIndex, error) {
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index manifest: %w", err)
+	}
+	descs := append([]v1.Descriptor{}, manifest.Manifests...)
+	sort.SliceStable(descs, func(i, j int) bool {
+		return descs[i].Annotations[tuf.TUFFileNameAnnotation] < descs[j].Annotations[tuf.TUFFileNameAnnotation]
+	})
+
+	sorted := v1.ImageIndex(empty.Index)
+	if manifest.MediaType != "" {
+		sorted = mutate.IndexMediaType(sorted, manifest.MediaType)
+	}
+	for _, desc := range descs {
+		if !desc.MediaType.IsImage() {
+			return nil, fmt.Errorf("failed to sort index: unexpected manifest %s of type %s", desc.Digest, desc.MediaType)
+		}
+		img, err := index.Image(desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read image %s: %w", desc.Digest, err)
+		}
+		sorted = mutate.AppendManifests(sorted, mutate.IndexAddendum{
+			Add:        img,
+			Descriptor: v1.Descriptor{Annotations: desc.Annotations, Platform: desc.Platform},
+		})
+	}
+	if len(manifest.Annotations) > 0 {
+		var ok bool
+		sorted, ok = mutate.Annotations(sorted, manifest.Annotations).(v1.ImageIndex)
+		if !ok {
+			return nil, fmt.Errorf("failed to annotate index")
+		}
+	}
+	return sorted, nil
+}
+
+// lessFile orders TUF metadata file names ([<version>.]<role>.json) by role, then version.
+func lessFile(a, b string) bool {
+	roleA, versionA := parseFile(a)
+	roleB, versionB := parseFile(b)
+	if rankA, rankB := rank(roleA), rank(roleB); rankA != rankB {
+		return rankA < rankB
+	}
+	if roleA != roleB {
+		return roleA < roleB
+	}
+	if versionA != versionB {
+		return versionA < versionB
+	}
+	return a < b
+}
+
+// parseFile returns the role and version of a metadata file name, version 0 if it is unversioned.
+func parseFile(name string) (string, int64) {
+	name = strings.TrimSuffix(name, ".json")
+	if prefix, role, found := strings.Cut(name, "."); found {
+		if version, err := strconv.ParseInt(prefix, 10, 64); err == nil {
+			return role, version
+		}
+	}
+	return name, 0
+}
+
+// rank returns the position of a top-level role in the metadata manifest, other roles sort last.
+func rank(role string) int {
+	for i, r := range mirror.TUFRoles {
+		if string(r) == role {
+			return i
+		}
+	}
+	return len(mirror.TUFRoles)
+}
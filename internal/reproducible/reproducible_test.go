@@ -0,0 +1,116 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package reproducible
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/attest/oci"
+	"github.com/docker/attest/tuf"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceDateEpoch(t *testing.T) {
+	t.Setenv(SourceDateEpochEnv, "")
+	created, err := SourceDateEpoch()
+	require.NoError(t, err)
+	assert.True(t, created.IsZero())
+
+	t.Setenv(SourceDateEpochEnv, "1700000000")
+	created, err = SourceDateEpoch()
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC), created)
+
+	t.Setenv(SourceDateEpochEnv, "yesterday")
+	_, err = SourceDateEpoch()
+	assert.Error(t, err)
+}
+
+func testImage(t *testing.T, files ...string) *oci.EmptyConfigImage {
+	img := empty.Image
+	img = mutate.MediaType(img, types.OCIManifestSchema1)
+	img = mutate.ConfigMediaType(img, types.OCIConfigJSON)
+	for _, file := range files {
+		var err error
+		img, err = mutate.Append(img, mutate.Addendum{
+			Layer:       static.NewLayer([]byte(file), "application/vnd.tuf.metadata+json"),
+			Annotations: map[string]string{tuf.TUFFileNameAnnotation: file},
+		})
+		require.NoError(t, err)
+	}
+	return &oci.EmptyConfigImage{Image: img}
+}
+
+func layerFiles(t *testing.T, img v1.Image) []string {
+	manifest, err := img.Manifest()
+	require.NoError(t, err)
+	var files []string
+	for _, desc := range manifest.Layers {
+		files = append(files, desc.Annotations[tuf.TUFFileNameAnnotation])
+	}
+	return files
+}
+
+func TestImage(t *testing.T) {
+	expected := []string{"1.root.json", "2.root.json", "10.root.json", "7.snapshot.json", "8.targets.json", "timestamp.json"}
+	a, err := Image(testImage(t, "10.root.json", "2.root.json", "1.root.json", "7.snapshot.json", "8.targets.json", "timestamp.json"))
+	require.NoError(t, err)
+	b, err := Image(testImage(t, "2.root.json", "1.root.json", "10.root.json", "7.snapshot.json", "8.targets.json", "timestamp.json"))
+	require.NoError(t, err)
+	assert.Equal(t, expected, layerFiles(t, a))
+
+	digestA, err := a.Digest()
+	require.NoError(t, err)
+	digestB, err := b.Digest()
+	require.NoError(t, err)
+	assert.Equal(t, digestA, digestB)
+}
+
+func TestIndex(t *testing.T) {
+	newIndex := func(files ...string) v1.ImageIndex {
+		index := v1.ImageIndex(empty.Index)
+		for _, file := range files {
+			index = mutate.AppendManifests(index, mutate.IndexAddendum{
+				Add:        testImage(t, file),
+				Descriptor: v1.Descriptor{Annotations: map[string]string{tuf.TUFFileNameAnnotation: file}},
+			})
+		}
+		return index
+	}
+	a, err := Index(newIndex("role/b.txt", "role/a.txt"))
+	require.NoError(t, err)
+	b, err := Index(newIndex("role/a.txt", "role/b.txt"))
+	require.NoError(t, err)
+
+	manifest, err := a.IndexManifest()
+	require.NoError(t, err)
+	require.Len(t, manifest.Manifests, 2)
+	assert.Equal(t, "role/a.txt", manifest.Manifests[0].Annotations[tuf.TUFFileNameAnnotation])
+
+	digestA, err := a.Digest()
+	require.NoError(t, err)
+	digestB, err := b.Digest()
+	require.NoError(t, err)
+	assert.Equal(t, digestA, digestB)
+}
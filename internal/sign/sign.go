@@ -0,0 +1,258 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package sign creates and verifies cosign compatible signatures of mirrored manifests.
+package sign
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/docker/attest/oci"
+	"github.com/docker/go-tuf-mirror/internal/referrers"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/sigstore/sigstore/pkg/signature/options"
+	"github.com/sigstore/sigstore/pkg/signature/payload"
+)
+
+const (
+	// TagMode stores signatures in a sha256-<digest>.sig tag, as cosign does by default.
+	TagMode = "tag"
+	// ReferrerMode stores signatures as OCI referrers of the signed manifest.
+	ReferrerMode = "referrer"
+
+	// SimpleSigningMediaType is the media type of signature payload layers.
+	SimpleSigningMediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+	// SignatureAnnotation holds the base64 encoded signature of a payload layer.
+	SignatureAnnotation = "dev.cosignproject.cosign/signature"
+	// SignatureArtifactType is the artifact type of signature referrers.
+	SignatureArtifactType = "application/vnd.dev.cosign.artifact.sig.v1+json"
+
+	// passwordEnv holds the password of encrypted keys, as used by cosign.
+	passwordEnv = "COSIGN_PASSWORD"
+)
+
+// signatureTag matches the tags of signatures and of referrers stored with the referrers tag schema.
+var signatureTag = regexp.MustCompile(`^sha256-[0-9a-f]{64}(\.sig)?$`)
+
+// ErrNoSignature is returned when a manifest has no signature.
+var ErrNoSignature = errors.New("no signature found")
+
+// LoadSigner loads a PEM encoded ECDSA or ED25519 private key.
+// Encrypted cosign keys are decrypted with the password in COSIGN_PASSWORD.
+func LoadSigner(path string) (signature.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+	key, err := cryptoutils.UnmarshalPEMToPrivateKey(data, func(bool) ([]byte, error) {
+		return []byte(os.Getenv(passwordEnv)), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key %s: %w", path, err)
+	}
+	signer, err := signature.LoadSigner(key, crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing key %s: %w", path, err)
+	}
+	return signer, nil
+}
+
+// LoadVerifier loads a PEM encoded ECDSA or ED25519 public key.
+func LoadVerifier(path string) (signature.Verifier, error) {
+	verifier, err := signature.LoadVerifierFromPEMFile(path, crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load public key %s: %w", path, err)
+	}
+	return verifier, nil
+}
+
+// SignatureTag returns the tag that stores the signatures of the manifest with digest.
+func SignatureTag(digest v1.Hash) string {
+	return fmt.Sprintf("%s-%s.sig", digest.Algorithm, digest.Hex)
+}
+
+// IsSignatureTag returns true for signature tags and referrers tag schema tags, which are not signed themselves.
+func IsSignatureTag(tag string) bool {
+	return signatureTag.MatchString(tag)
+}
+
+// NewSignature signs the manifest described by subject, claimed to be identity, and returns the signature artifact.
+// In referrer mode the artifact refers to the signed manifest. In tag mode the signature is appended to base,
+// the signature image already stored in the signature tag if not nil, so that signatures of other signers
+// are kept, as cosign does.
+func NewSignature(ctx context.Context, signer signature.Signer, identity string, subject v1.Descriptor, mode string, base v1.Image) (v1.Image, error) {
+	data, err := json.Marshal(payload.SimpleContainerImage{
+		Critical: payload.Critical{
+			Identity: payload.Identity{DockerReference: identity},
+			Image:    payload.Image{DockerManifestDigest: subject.Digest.String()},
+			Type:     payload.CosignSignatureType,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signature payload: %w", err)
+	}
+	sig, err := signer.SignMessage(bytes.NewReader(data), options.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign %s: %w", subject.Digest, err)
+	}
+
+	img := empty.Image
+	img = mutate.MediaType(img, types.OCIManifestSchema1)
+	img = mutate.ConfigMediaType(img, types.OCIConfigJSON)
+	if mode == ReferrerMode {
+		img = mutate.ArtifactType(img, SignatureArtifactType)
+	}
+	var layers []mutate.Addendum
+	if base != nil && mode != ReferrerMode {
+		layers, err = signatureLayers(base)
+		if err != nil {
+			return nil, err
+		}
+	}
+	layers = append(layers, mutate.Addendum{
+		Layer:       static.NewLayer(data, SimpleSigningMediaType),
+		Annotations: map[string]string{SignatureAnnotation: base64.StdEncoding.EncodeToString(sig)},
+	})
+	img, err = mutate.Append(img, layers...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to append signature layer: %w", err)
+	}
+	if mode == ReferrerMode {
+		var ok bool
+		img, ok = mutate.Subject(img, referrers.Descriptor(subject)).(v1.Image)
+		if !ok {
+			return nil, fmt.Errorf("failed to set signature subject")
+		}
+	}
+	return &oci.EmptyConfigImage{Image: img}, nil
+}
+
+// signatureLayers returns the layers of a signature image with their annotations, to carry them over to a new
+// signature image. The layers are read into memory, as the empty config of signature images has no diff IDs
+// to describe them.
+func signatureLayers(img v1.Image) ([]mutate.Addendum, error) {
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signature manifest: %w", err)
+	}
+	layers := make([]mutate.Addendum, 0, len(manifest.Layers))
+	for _, desc := range manifest.Layers {
+		layer, err := img.LayerByDigest(desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signature layer: %w", err)
+		}
+		rc, err := layer.Compressed()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signature layer: %w", err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signature layer: %w", err)
+		}
+		layers = append(layers, mutate.Addendum{Layer: static.NewLayer(data, desc.MediaType), Annotations: desc.Annotations})
+	}
+	return layers, nil
+}
+
+// Signed returns true if a signature artifact holds a valid signature of the manifest with digest by signer,
+// so that the manifest need not be signed again.
+func Signed(ctx context.Context, signer signature.Signer, sig v1.Image, digest v1.Hash) (bool, error) {
+	pub, err := signer.PublicKey()
+	if err != nil {
+		return false, fmt.Errorf("failed to get public key: %w", err)
+	}
+	verifier, err := signature.LoadVerifier(pub, crypto.SHA256)
+	if err != nil {
+		return false, fmt.Errorf("failed to load verifier: %w", err)
+	}
+	return Verify(ctx, verifier, sig, digest) == nil, nil
+}
+
+// Verify checks that a signature artifact holds a signature of the manifest with digest by verifier.
+func Verify(ctx context.Context, verifier signature.Verifier, sig v1.Image, digest v1.Hash) error {
+	manifest, err := sig.Manifest()
+	if err != nil {
+		return fmt.Errorf("failed to read signature manifest: %w", err)
+	}
+	var errs []error
+	for _, desc := range manifest.Layers {
+		if desc.MediaType != SimpleSigningMediaType {
+			continue
+		}
+		err := verifyLayer(ctx, verifier, sig, desc, digest)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return ErrNoSignature
+	}
+	return errors.Join(errs...)
+}
+
+func verifyLayer(ctx context.Context, verifier signature.Verifier, sig v1.Image, desc v1.Descriptor, digest v1.Hash) error {
+	raw, err := base64.StdEncoding.DecodeString(desc.Annotations[SignatureAnnotation])
+	if err != nil {
+		return fmt.Errorf("failed to decode signature: %w", err)
+	}
+	layer, err := sig.LayerByDigest(desc.Digest)
+	if err != nil {
+		return fmt.Errorf("failed to read signature payload: %w", err)
+	}
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		return fmt.Errorf("failed to read signature payload: %w", err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return fmt.Errorf("failed to read signature payload: %w", err)
+	}
+	err = verifier.VerifySignature(bytes.NewReader(raw), bytes.NewReader(data), options.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	var p payload.SimpleContainerImage
+	err = json.Unmarshal(data, &p)
+	if err != nil {
+		return fmt.Errorf("failed to parse signature payload: %w", err)
+	}
+	if p.Critical.Type != payload.CosignSignatureType {
+		return fmt.Errorf("unexpected signature type %q", p.Critical.Type)
+	}
+	if !strings.EqualFold(p.Critical.Image.DockerManifestDigest, digest.String()) {
+		return fmt.Errorf("signature is for %s, not %s", p.Critical.Image.DockerManifestDigest, digest)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package sign
+
+import (
+	"context"
+	"crypto/elliptic"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/go-tuf-mirror/internal/referrers"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeKeyPair(t *testing.T, password string) (string, string) {
+	priv, pub, err := cryptoutils.GeneratePEMEncodedECDSAKeyPair(elliptic.P256(), cryptoutils.StaticPasswordFunc([]byte(password)))
+	require.NoError(t, err)
+	dir := t.TempDir()
+	privPath := filepath.Join(dir, "cosign.key")
+	pubPath := filepath.Join(dir, "cosign.pub")
+	require.NoError(t, os.WriteFile(privPath, priv, 0o600))
+	require.NoError(t, os.WriteFile(pubPath, pub, 0o600))
+	return privPath, pubPath
+}
+
+func TestSignVerify(t *testing.T) {
+	t.Setenv(passwordEnv, "secret")
+	privPath, pubPath := writeKeyPair(t, "secret")
+	signer, err := LoadSigner(privPath)
+	require.NoError(t, err)
+	verifier, err := LoadVerifier(pubPath)
+	require.NoError(t, err)
+
+	subject, err := referrers.Describe(empty.Image)
+	require.NoError(t, err)
+	other := v1.Hash{Algorithm: "sha256", Hex: "0000000000000000000000000000000000000000000000000000000000000000"}
+
+	for _, mode := range []string{TagMode, ReferrerMode} {
+		t.Run(mode, func(t *testing.T) {
+			sig, err := NewSignature(context.Background(), signer, "example.com/repo", subject, mode, nil)
+			require.NoError(t, err)
+			require.NoError(t, Verify(context.Background(), verifier, sig, subject.Digest))
+			assert.Error(t, Verify(context.Background(), verifier, sig, other))
+
+			manifest, err := sig.Manifest()
+			require.NoError(t, err)
+			if mode == ReferrerMode {
+				require.NotNil(t, manifest.Subject)
+				assert.Equal(t, subject.Digest, manifest.Subject.Digest)
+				assert.Equal(t, SignatureArtifactType, manifest.ArtifactType)
+			} else {
+				assert.Nil(t, manifest.Subject)
+			}
+		})
+	}
+
+	_, otherPub := writeKeyPair(t, "secret")
+	otherVerifier, err := LoadVerifier(otherPub)
+	require.NoError(t, err)
+	sig, err := NewSignature(context.Background(), signer, "example.com/repo", subject, TagMode, nil)
+	require.NoError(t, err)
+	assert.Error(t, Verify(context.Background(), otherVerifier, sig, subject.Digest))
+	assert.ErrorIs(t, Verify(context.Background(), verifier, empty.Image, subject.Digest), ErrNoSignature)
+}
+
+func TestAppendSignature(t *testing.T) {
+	t.Setenv(passwordEnv, "secret")
+	privPath, pubPath := writeKeyPair(t, "secret")
+	signer, err := LoadSigner(privPath)
+	require.NoError(t, err)
+	verifier, err := LoadVerifier(pubPath)
+	require.NoError(t, err)
+	otherPriv, otherPub := writeKeyPair(t, "secret")
+	other, err := LoadSigner(otherPriv)
+	require.NoError(t, err)
+	otherVerifier, err := LoadVerifier(otherPub)
+	require.NoError(t, err)
+
+	subject, err := referrers.Describe(empty.Image)
+	require.NoError(t, err)
+
+	// another signer signed the manifest first
+	base, err := NewSignature(context.Background(), other, "example.com/repo", subject, TagMode, nil)
+	require.NoError(t, err)
+	signed, err := Signed(context.Background(), signer, base, subject.Digest)
+	require.NoError(t, err)
+	assert.False(t, signed)
+
+	sig, err := NewSignature(context.Background(), signer, "example.com/repo", subject, TagMode, base)
+	require.NoError(t, err)
+	manifest, err := sig.Manifest()
+	require.NoError(t, err)
+	assert.Len(t, manifest.Layers, 2)
+	// both signatures are kept
+	require.NoError(t, Verify(context.Background(), verifier, sig, subject.Digest))
+	require.NoError(t, Verify(context.Background(), otherVerifier, sig, subject.Digest))
+	signed, err = Signed(context.Background(), signer, sig, subject.Digest)
+	require.NoError(t, err)
+	assert.True(t, signed)
+}
+
+func TestLoadSignerWrongPassword(t *testing.T) {
+	t.Setenv(passwordEnv, "wrong")
+	privPath, _ := writeKeyPair(t, "secret")
+	_, err := LoadSigner(privPath)
+	assert.Error(t, err)
+}
+
+func TestIsSignatureTag(t *testing.T) {
+	digest := v1.Hash{Algorithm: "sha256", Hex: "02119a076ec3878c736c3a95e20794f5a8d5bce3d7ecc264681bb7334ca2e24b"}
+	assert.True(t, IsSignatureTag(SignatureTag(digest)))
+	assert.True(t, IsSignatureTag("sha256-"+digest.Hex))
+	assert.False(t, IsSignatureTag("latest"))
+	assert.False(t, IsSignatureTag(digest.Hex+".test.txt"))
+}
@@ -0,0 +1,161 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package tags
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// maxTagLength is the maximum length of a tag allowed by the OCI distribution spec.
+const maxTagLength = 128
+
+// tagPattern is the tag grammar of the OCI distribution spec.
+var tagPattern = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}$`)
+
+// funcs are the functions available to tag templates.
+var funcs = template.FuncMap{
+	"trunc":   trunc,
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"replace": func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+}
+
+// Target is the data available to target tag templates.
+type Target struct {
+	// Hash is the sha256 hash of the target.
+	Hash string
+	// Name is the file name of the target.
+	Name string
+}
+
+// Delegated is the data available to delegated role tag templates.
+type Delegated struct {
+	// Name is the name of the delegated role.
+	Name string
+}
+
+// Templates renders the tags of mirrored targets and delegated roles.
+// A nil template keeps the tag chosen by the mirror, <hash>.<name> for targets and the role name
+// for delegated roles, which is what TUF clients reading from a registry expect.
+type Templates struct {
+	target    *template.Template
+	delegated *template.Template
+}
+
+// NewTemplates parses the target and delegated role tag templates, either of which may be empty.
+func NewTemplates(target, delegated string) (*Templates, error) {
+	t := &Templates{}
+	var err error
+	if target != "" {
+		t.target, err = template.New("target").Funcs(funcs).Option("missingkey=error").Parse(target)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse target tag template: %w", err)
+		}
+	}
+	if delegated != "" {
+		t.delegated, err = template.New("delegated").Funcs(funcs).Option("missingkey=error").Parse(delegated)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse delegated tag template: %w", err)
+		}
+	}
+	return t, nil
+}
+
+// HasTargetTemplate returns true if target tags are templated.
+func (t *Templates) HasTargetTemplate() bool {
+	return t.target != nil
+}
+
+// Target returns the tag for a target mirrored with tag <hash>.<name>.
+func (t *Templates) Target(tag string) (string, error) {
+	if t.target == nil {
+		return tag, nil
+	}
+	hash, name, found := strings.Cut(tag, ".")
+	if !found {
+		return "", fmt.Errorf("unexpected target tag %s", tag)
+	}
+	return render(t.target, &Target{Hash: hash, Name: name})
+}
+
+// Delegated returns the tag for a delegated role.
+func (t *Templates) Delegated(role string) (string, error) {
+	if t.delegated == nil {
+		return role, nil
+	}
+	return render(t.delegated, &Delegated{Name: role})
+}
+
+func render(tmpl *template.Template, data any) (string, error) {
+	var b bytes.Buffer
+	err := tmpl.Execute(&b, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to render %s tag template: %w", tmpl.Name(), err)
+	}
+	tag := b.String()
+	err = Validate(tag)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s tag rendered from template: %w", tmpl.Name(), err)
+	}
+	return tag, nil
+}
+
+// Validate checks a tag against the OCI tag grammar.
+func Validate(tag string) error {
+	if len(tag) > maxTagLength {
+		return fmt.Errorf("tag %s is longer than %d characters", tag, maxTagLength)
+	}
+	if !tagPattern.MatchString(tag) {
+		return fmt.Errorf("tag %q does not match the OCI tag grammar %s", tag, tagPattern)
+	}
+	return nil
+}
+
+// Collisions tracks the tags assigned to mirrored files to detect collisions before anything is pushed.
+type Collisions struct {
+	owners map[string]string
+}
+
+// NewCollisions returns an empty collision tracker.
+func NewCollisions() *Collisions {
+	return &Collisions{owners: map[string]string{}}
+}
+
+// Add assigns tag to the named file, returning an error if the tag is already assigned to another file.
+func (c *Collisions) Add(tag, file string) error {
+	if owner, ok := c.owners[tag]; ok && owner != file {
+		return fmt.Errorf("tag %s collides for %s and %s", tag, owner, file)
+	}
+	c.owners[tag] = file
+	return nil
+}
+
+// trunc returns the first n characters of s, or the last -n characters if n is negative.
+func trunc(n int, s string) string {
+	switch {
+	case n >= 0 && len(s) > n:
+		return s[:n]
+	case n < 0 && len(s) > -n:
+		return s[len(s)+n:]
+	default:
+		return s
+	}
+}
@@ -0,0 +1,82 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package tags
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplates(t *testing.T) {
+	hash := strings.Repeat("a", 64)
+
+	testCases := []struct {
+		name      string
+		template  string
+		delegated bool
+		input     string
+		expected  string
+		err       string
+	}{
+		{"default target", "", false, hash + ".policy.rego", hash + ".policy.rego", ""},
+		{"default delegated", "", true, "doi", "doi", ""},
+		{"truncated hash", "{{.Hash | trunc 12}}-{{.Name}}", false, hash + ".policy.rego", "aaaaaaaaaaaa-policy.rego", ""},
+		{"truncated from end", "{{.Hash | trunc -4}}", false, hash + ".policy.rego", "aaaa", ""},
+		{"replace", "{{.Name | replace \".\" \"_\" | upper}}", false, hash + ".policy.rego", "POLICY_REGO", ""},
+		{"delegated", "role-{{.Name}}", true, "doi", "role-doi", ""},
+		{"too long", "{{.Hash}}{{.Hash}}{{.Hash}}", false, hash + ".policy.rego", "", "longer than 128"},
+		{"invalid character", "{{.Name}}:{{.Hash}}", false, hash + ".policy.rego", "", "OCI tag grammar"},
+		{"unknown field", "{{.Role}}", true, "doi", "", "failed to render"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var templates *Templates
+			var err error
+			if tc.delegated {
+				templates, err = NewTemplates("", tc.template)
+			} else {
+				templates, err = NewTemplates(tc.template, "")
+			}
+			require.NoError(t, err)
+
+			var tag string
+			if tc.delegated {
+				tag, err = templates.Delegated(tc.input)
+			} else {
+				tag, err = templates.Target(tc.input)
+			}
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, tag)
+		})
+	}
+}
+
+func TestCollisions(t *testing.T) {
+	c := NewCollisions()
+	require.NoError(t, c.Add("a", "target a"))
+	require.NoError(t, c.Add("a", "target a"))
+	require.NoError(t, c.Add("b", "target b"))
+	assert.ErrorContains(t, c.Add("a", "target c"), "tag a collides for target a and target c")
+}
@@ -0,0 +1,135 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package tuf
+
+import (
+	"maps"
+)
+
+// ChangeType is the kind of change between two repositories.
+type ChangeType string
+
+const (
+	Added    ChangeType = "added"
+	Removed  ChangeType = "removed"
+	Modified ChangeType = "modified"
+)
+
+// Diff lists the differences between two repositories.
+type Diff struct {
+	Roles   []*RoleChange   `json:"roles"`
+	Targets []*TargetChange `json:"targets"`
+}
+
+// RoleChange describes a role that was added, removed or modified.
+type RoleChange struct {
+	Name        string     `json:"name"`
+	Change      ChangeType `json:"change"`
+	From        *Role      `json:"from,omitempty"`
+	To          *Role      `json:"to,omitempty"`
+	AddedKeys   []string   `json:"added_keys,omitempty"`
+	RemovedKeys []string   `json:"removed_keys,omitempty"`
+}
+
+// TargetChange describes a target that was added, removed or modified.
+type TargetChange struct {
+	Path   string     `json:"path"`
+	Change ChangeType `json:"change"`
+	From   *Target    `json:"from,omitempty"`
+	To     *Target    `json:"to,omitempty"`
+}
+
+// Empty returns true if there are no differences.
+func (d *Diff) Empty() bool {
+	return len(d.Roles) == 0 && len(d.Targets) == 0
+}
+
+// Compare returns the differences between from and to.
+// Roles are listed in the order of to, followed by roles only present in from; targets likewise.
+func Compare(from, to *Repository) *Diff {
+	diff := &Diff{Roles: []*RoleChange{}, Targets: []*TargetChange{}}
+
+	fromRoles := map[string]*Role{}
+	for _, r := range from.Roles {
+		fromRoles[r.Name] = r
+	}
+	for _, r := range to.Roles {
+		old, ok := fromRoles[r.Name]
+		if !ok {
+			diff.Roles = append(diff.Roles, &RoleChange{Name: r.Name, Change: Added, To: r, AddedKeys: r.KeyIDs})
+			continue
+		}
+		delete(fromRoles, r.Name)
+		added, removed := compareKeys(old.KeyIDs, r.KeyIDs)
+		if old.Version != r.Version || !old.Expires.Equal(r.Expires) || old.Threshold != r.Threshold || old.Parent != r.Parent || len(added) > 0 || len(removed) > 0 {
+			diff.Roles = append(diff.Roles, &RoleChange{Name: r.Name, Change: Modified, From: old, To: r, AddedKeys: added, RemovedKeys: removed})
+		}
+	}
+	for _, r := range from.Roles {
+		if _, ok := fromRoles[r.Name]; ok {
+			diff.Roles = append(diff.Roles, &RoleChange{Name: r.Name, Change: Removed, From: r, RemovedKeys: r.KeyIDs})
+		}
+	}
+
+	fromTargets := map[string]*Target{}
+	for _, t := range from.Targets {
+		fromTargets[t.Path] = t
+	}
+	for _, t := range to.Targets {
+		old, ok := fromTargets[t.Path]
+		if !ok {
+			diff.Targets = append(diff.Targets, &TargetChange{Path: t.Path, Change: Added, To: t})
+			continue
+		}
+		delete(fromTargets, t.Path)
+		if old.Length != t.Length || old.Role != t.Role || !maps.Equal(old.Hashes, t.Hashes) {
+			diff.Targets = append(diff.Targets, &TargetChange{Path: t.Path, Change: Modified, From: old, To: t})
+		}
+	}
+	for _, t := range from.Targets {
+		if _, ok := fromTargets[t.Path]; ok {
+			diff.Targets = append(diff.Targets, &TargetChange{Path: t.Path, Change: Removed, From: t})
+		}
+	}
+	return diff
+}
+
+// ExpiryChanged returns true if the expiry of a modified role changed.
+func (c *RoleChange) ExpiryChanged() bool {
+	return c.From != nil && c.To != nil && !c.From.Expires.Equal(c.To.Expires)
+}
+
+// compareKeys returns the key IDs only present in to and only present in from.
+func compareKeys(from, to []string) (added, removed []string) {
+	fromKeys := map[string]bool{}
+	for _, k := range from {
+		fromKeys[k] = true
+	}
+	toKeys := map[string]bool{}
+	for _, k := range to {
+		toKeys[k] = true
+		if !fromKeys[k] {
+			added = append(added, k)
+		}
+	}
+	for _, k := range from {
+		if !toKeys[k] {
+			removed = append(removed, k)
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,84 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package tuf
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/docker/attest/tuf"
+	"github.com/theupdateframework/go-tuf/v2/metadata"
+)
+
+// MetadataFetcher fetches metadata files by name without verifying them.
+type MetadataFetcher interface {
+	FetchMetadata(ctx context.Context, name string) ([]byte, error)
+}
+
+// CurrentTargets returns the sha256 hash of each trusted top-level target.
+func CurrentTargets(client *tuf.Client) map[string]string {
+	current := map[string]string{}
+	for path, t := range client.GetMetadata().Targets[metadata.TARGETS].Signed.Targets {
+		if h, ok := t.Hashes["sha256"]; ok {
+			current[path] = h.String()
+		}
+	}
+	return current
+}
+
+// PreviousTargets returns up to limit previous sha256 hashes of each top-level target, newest first.
+// It walks back through the consistent snapshot targets metadata of the source until every target
+// has limit previous hashes or no older metadata is available.
+// The older metadata is not verified, so the result must only be used to decide what to retain.
+func PreviousTargets(ctx context.Context, src MetadataFetcher, client *tuf.Client, limit int) map[string][]string {
+	previous := map[string][]string{}
+	if limit <= 0 || !client.GetMetadata().Root.Signed.ConsistentSnapshot {
+		return previous
+	}
+	current := CurrentTargets(client)
+	for path := range current {
+		previous[path] = []string{}
+	}
+	for v := client.GetMetadata().Targets[metadata.TARGETS].Signed.Version - 1; v > 0 && !satisfied(previous, limit); v-- {
+		data, err := src.FetchMetadata(ctx, fmt.Sprintf("%d.%s.json", v, metadata.TARGETS))
+		if err != nil {
+			break
+		}
+		md, err := metadata.Targets().FromBytes(data)
+		if err != nil {
+			break
+		}
+		for path, t := range md.Signed.Targets {
+			h, ok := t.Hashes["sha256"]
+			if !ok || h.String() == current[path] || slices.Contains(previous[path], h.String()) || len(previous[path]) >= limit {
+				continue
+			}
+			previous[path] = append(previous[path], h.String())
+		}
+	}
+	return previous
+}
+
+func satisfied(previous map[string][]string, limit int) bool {
+	for _, hashes := range previous {
+		if len(hashes) < limit {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,134 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package tuf
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/docker/attest/tuf"
+	"github.com/theupdateframework/go-tuf/v2/metadata"
+)
+
+// Repository is a snapshot of the verified state of a TUF repository.
+type Repository struct {
+	Roles   []*Role   `json:"roles"`
+	Targets []*Target `json:"targets"`
+}
+
+// Role describes a top-level or delegated role.
+type Role struct {
+	Name      string    `json:"name"`
+	Parent    string    `json:"parent,omitempty"`
+	Version   int64     `json:"version"`
+	Expires   time.Time `json:"expires"`
+	Threshold int       `json:"threshold"`
+	KeyIDs    []string  `json:"keyids"`
+}
+
+// Target describes a target file and the role that signed it.
+type Target struct {
+	Path   string            `json:"path"`
+	Role   string            `json:"role"`
+	Length int64             `json:"length"`
+	Hashes map[string]string `json:"hashes"`
+}
+
+// Inspect walks the trusted metadata of a TUF client, loading delegated targets metadata as needed.
+// Roles are returned top-level first, followed by delegated roles in delegation order.
+func Inspect(client *tuf.Client) (*Repository, error) {
+	md := client.GetMetadata()
+	root := md.Root.Signed
+	repo := &Repository{}
+	repo.Roles = append(repo.Roles,
+		topLevelRole(metadata.ROOT, root.Version, root.Expires, root.Roles),
+		topLevelRole(metadata.TIMESTAMP, md.Timestamp.Signed.Version, md.Timestamp.Signed.Expires, root.Roles),
+		topLevelRole(metadata.SNAPSHOT, md.Snapshot.Signed.Version, md.Snapshot.Signed.Expires, root.Roles),
+	)
+	visited := map[string]bool{}
+	err := repo.addTargetsRole(client, topLevelRole(metadata.TARGETS, 0, time.Time{}, root.Roles), md.Targets[metadata.TARGETS], visited)
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// Role returns the role with the given name, or nil.
+func (r *Repository) Role(name string) *Role {
+	for _, role := range r.Roles {
+		if role.Name == name {
+			return role
+		}
+	}
+	return nil
+}
+
+// addTargetsRole records a targets role with its targets and recurses into its delegations.
+func (r *Repository) addTargetsRole(client *tuf.Client, role *Role, md *metadata.Metadata[metadata.TargetsType], visited map[string]bool) error {
+	visited[role.Name] = true
+	role.Version = md.Signed.Version
+	role.Expires = md.Signed.Expires
+	r.Roles = append(r.Roles, role)
+	for _, path := range sortedKeys(md.Signed.Targets) {
+		t := md.Signed.Targets[path]
+		hashes := map[string]string{}
+		for alg, h := range t.Hashes {
+			hashes[alg] = h.String()
+		}
+		r.Targets = append(r.Targets, &Target{Path: path, Role: role.Name, Length: t.Length, Hashes: hashes})
+	}
+	if md.Signed.Delegations == nil {
+		return nil
+	}
+	for _, d := range md.Signed.Delegations.Roles {
+		if visited[d.Name] {
+			continue
+		}
+		delegated, err := client.LoadDelegatedTargets(d.Name, role.Name)
+		if err != nil {
+			return fmt.Errorf("failed to load delegated targets metadata for role %s: %w", d.Name, err)
+		}
+		keyIDs := append([]string{}, d.KeyIDs...)
+		sort.Strings(keyIDs)
+		child := &Role{Name: d.Name, Parent: role.Name, Threshold: d.Threshold, KeyIDs: keyIDs}
+		err = r.addTargetsRole(client, child, delegated, visited)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func topLevelRole(name string, version int64, expires time.Time, roles map[string]*metadata.Role) *Role {
+	role := &Role{Name: name, Version: version, Expires: expires}
+	if r, ok := roles[name]; ok {
+		role.Threshold = r.Threshold
+		role.KeyIDs = append([]string{}, r.KeyIDs...)
+		sort.Strings(role.KeyIDs)
+	}
+	return role
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,114 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package tuf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/theupdateframework/go-tuf/v2/metadata"
+)
+
+// RootRotation describes how a new root changed the keys and thresholds of the top-level roles.
+type RootRotation struct {
+	FromVersion int64 `json:"from_version"`
+	ToVersion   int64 `json:"to_version"`
+	// Digest is the sha256 digest of the new root, as sha256:<hex>.
+	Digest string `json:"digest"`
+	// Roles are the roles whose keys or threshold changed, top-level roles first.
+	Roles []*RoleRotation `json:"roles"`
+}
+
+// RoleRotation describes the key and threshold changes of a role.
+type RoleRotation struct {
+	Name          string   `json:"name"`
+	FromThreshold int      `json:"from_threshold"`
+	ToThreshold   int      `json:"to_threshold"`
+	AddedKeys     []string `json:"added_keys,omitempty"`
+	RemovedKeys   []string `json:"removed_keys,omitempty"`
+}
+
+// Rotated returns true if the keys or threshold of any role changed.
+func (r *RootRotation) Rotated() bool {
+	return len(r.Roles) > 0
+}
+
+// ThresholdChanged returns true if the threshold of the role changed.
+func (r *RoleRotation) ThresholdChanged() bool {
+	return r.FromThreshold != r.ToThreshold
+}
+
+// RootDigest returns the sha256 digest of root metadata, as sha256:<hex>.
+func RootDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// CompareRoots returns the key and threshold changes of the roles of root metadata from to root metadata to.
+// The roots are not verified, so to must be trusted already.
+func CompareRoots(from, to []byte) (*RootRotation, error) {
+	fromRoot, err := metadata.Root().FromBytes(from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse previous root: %w", err)
+	}
+	toRoot, err := metadata.Root().FromBytes(to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse new root: %w", err)
+	}
+	rotation := &RootRotation{
+		FromVersion: fromRoot.Signed.Version,
+		ToVersion:   toRoot.Signed.Version,
+		Digest:      RootDigest(to),
+		Roles:       []*RoleRotation{},
+	}
+	for _, name := range roleNames(fromRoot.Signed.Roles, toRoot.Signed.Roles) {
+		change := &RoleRotation{Name: name}
+		var fromKeys, toKeys []string
+		if r, ok := fromRoot.Signed.Roles[name]; ok {
+			change.FromThreshold = r.Threshold
+			fromKeys = r.KeyIDs
+		}
+		if r, ok := toRoot.Signed.Roles[name]; ok {
+			change.ToThreshold = r.Threshold
+			toKeys = r.KeyIDs
+		}
+		change.AddedKeys, change.RemovedKeys = compareKeys(fromKeys, toKeys)
+		if change.ThresholdChanged() || len(change.AddedKeys) > 0 || len(change.RemovedKeys) > 0 {
+			rotation.Roles = append(rotation.Roles, change)
+		}
+	}
+	return rotation, nil
+}
+
+// roleNames returns the names of the roles of either root, top-level roles first followed by any other
+// roles sorted by name.
+func roleNames(from, to map[string]*metadata.Role) []string {
+	names := []string{metadata.ROOT, metadata.TIMESTAMP, metadata.SNAPSHOT, metadata.TARGETS}
+	var other []string
+	for _, roles := range []map[string]*metadata.Role{from, to} {
+		for name := range roles {
+			if !slices.Contains(names, name) && !slices.Contains(other, name) {
+				other = append(other, name)
+			}
+		}
+	}
+	sort.Strings(other)
+	return append(names, other...)
+}
@@ -0,0 +1,300 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package tuf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/attest/tuf"
+	"github.com/docker/go-tuf-mirror/internal/util"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/theupdateframework/go-tuf/v2/metadata"
+	"github.com/theupdateframework/go-tuf/v2/metadata/config"
+)
+
+const (
+	initialRoot       = "1.root.json"
+	maxMetadataLength = 5120000
+	registryTimeout   = 15 * time.Second
+)
+
+var errFileNotFound = errors.New("file not found")
+
+// ErrNotFound is wrapped by the error of FetchMetadata if the source does not have the metadata file.
+var ErrNotFound = errors.New("metadata not found")
+
+// Source is a TUF repository location that the TUF client can fetch metadata and targets from.
+type Source struct {
+	// Location is the user facing metadata location.
+	Location string
+	// MetadataURL is the metadata source passed to the TUF client.
+	MetadataURL string
+	// TargetsURL is the targets source passed to the TUF client.
+	TargetsURL string
+
+	registry bool
+	server   *http.Server
+}
+
+// NewWebSource returns a source for a TUF repository served over http(s).
+func NewWebSource(metadataURL, targetsURL string) *Source {
+	return &Source{Location: metadataURL, MetadataURL: metadataURL, TargetsURL: targetsURL}
+}
+
+// NewRegistrySource returns a source for a TUF repository mirrored to an OCI registry.
+func NewRegistrySource(location, metadataRef, targetsRepo string) *Source {
+	return &Source{Location: location, MetadataURL: metadataRef, TargetsURL: targetsRepo, registry: true}
+}
+
+// NewLayoutSource returns a source for a TUF repository mirrored to OCI layouts on the filesystem.
+// The layouts are served to the TUF client from a loopback http server until the source is closed.
+func NewLayoutSource(location, metadataPath, targetsPath string) (*Source, error) {
+	mux := http.NewServeMux()
+	mux.Handle("/metadata/", http.StripPrefix("/metadata/", layoutHandler(func(name string) ([]byte, error) {
+		return readLayoutMetadata(metadataPath, name)
+	})))
+	mux.Handle("/targets/", http.StripPrefix("/targets/", layoutHandler(func(name string) ([]byte, error) {
+		return readLayoutTarget(targetsPath, name)
+	})))
+	return newLocalSource(location, mux)
+}
+
+// NewFilesystemSource returns a source for a TUF repository stored on the filesystem
+// using the same directory structure as a web repository.
+func NewFilesystemSource(location, metadataPath, targetsPath string) (*Source, error) {
+	mux := http.NewServeMux()
+	mux.Handle("/metadata/", http.StripPrefix("/metadata/", http.FileServer(http.Dir(metadataPath))))
+	mux.Handle("/targets/", http.StripPrefix("/targets/", http.FileServer(http.Dir(targetsPath))))
+	return newLocalSource(location, mux)
+}
+
+func newLocalSource(location string, handler http.Handler) (*Source, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on loopback address: %w", err)
+	}
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: registryTimeout}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	base := "http://" + listener.Addr().String()
+	return &Source{
+		Location:    location,
+		MetadataURL: base + "/metadata",
+		TargetsURL:  base + "/targets",
+		server:      server,
+	}, nil
+}
+
+// RootLocation returns the user facing location of the initial root metadata.
+func (s *Source) RootLocation() string {
+	return strings.TrimSuffix(s.Location, "/") + "/" + initialRoot
+}
+
+// InitialRoot fetches the first version of the root metadata from the source.
+// The root is trusted on first use, as the mirror has no other way to bootstrap trust.
+func (s *Source) InitialRoot(ctx context.Context) ([]byte, error) {
+	return s.FetchMetadata(ctx, initialRoot)
+}
+
+// FetchMetadata fetches a metadata file by name from the source without verifying it.
+// The error wraps ErrNotFound if the source does not have the file.
+func (s *Source) FetchMetadata(ctx context.Context, name string) ([]byte, error) {
+	data, err := s.fetchMetadata(ctx, name)
+	if err != nil && isNotFound(err) {
+		return nil, fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	return data, err
+}
+
+func (s *Source) fetchMetadata(ctx context.Context, name string) ([]byte, error) {
+	if !s.registry {
+		return util.HTTPGet(strings.TrimSuffix(s.MetadataURL, "/") + "/" + name)
+	}
+	fetcher, err := tuf.NewRegistryFetcher(ctx, &config.UpdaterConfig{RemoteMetadataURL: s.MetadataURL, RemoteTargetsURL: s.TargetsURL})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create registry fetcher: %w", err)
+	}
+	return fetcher.DownloadFile(s.MetadataURL+"/"+name, maxMetadataLength, registryTimeout)
+}
+
+// isNotFound reports whether a fetch failed because the file, or the manifest or registry repository
+// holding it, does not exist.
+func isNotFound(err error) bool {
+	var statusErr *util.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusNotFound
+	}
+	var downloadErr *metadata.ErrDownloadHTTP
+	if errors.As(err, &downloadErr) {
+		return downloadErr.StatusCode == http.StatusNotFound
+	}
+	var terr *transport.Error
+	return errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound
+}
+
+// Close releases any resources held by the source.
+func (s *Source) Close() error {
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Close()
+}
+
+// layoutHandler serves files found by read, answering 404 for unknown files.
+func layoutHandler(read func(name string) ([]byte, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := read(r.URL.Path)
+		switch {
+		case errors.Is(err, errFileNotFound):
+			http.NotFound(w, r)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		default:
+			_, _ = w.Write(data)
+		}
+	})
+}
+
+// readLayoutMetadata reads a metadata file from a metadata layout.
+// Top-level metadata is stored in the layout at root, delegated metadata in a layout named after the role.
+func readLayoutMetadata(root, name string) ([]byte, error) {
+	role := roleFromFilename(name)
+	switch role {
+	case metadata.ROOT, metadata.SNAPSHOT, metadata.TARGETS, metadata.TIMESTAMP:
+		return readLayoutFile(root, name)
+	default:
+		return readLayoutFile(filepath.Join(root, role), name)
+	}
+}
+
+// readLayoutTarget reads a target file from a targets layout.
+// Top-level targets are stored in a layout named after the target, delegated targets in an index
+// layout named after the first directory of the target path.
+func readLayoutTarget(root, name string) ([]byte, error) {
+	subdir, _, found := strings.Cut(name, "/")
+	if found {
+		return readLayoutFile(filepath.Join(root, subdir), name)
+	}
+	return readLayoutFile(filepath.Join(root, name), name)
+}
+
+// readLayoutFile returns the contents of the layer annotated with name in the layout at dir.
+func readLayoutFile(dir, name string) ([]byte, error) {
+	p, err := layout.FromPath(dir)
+	if err != nil {
+		return nil, errFileNotFound
+	}
+	index, err := p.ImageIndex()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read layout index %s: %w", dir, err)
+	}
+	return findInIndex(index, name)
+}
+
+// findInIndex searches the images of an index for a layer annotated with name.
+// Images annotated with name are searched for a layer annotated with the base name,
+// matching how delegated targets are stored.
+func findInIndex(index v1.ImageIndex, name string) ([]byte, error) {
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index manifest: %w", err)
+	}
+	for _, desc := range manifest.Manifests {
+		switch {
+		case desc.MediaType.IsIndex():
+			child, err := index.ImageIndex(desc.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read index %s: %w", desc.Digest, err)
+			}
+			data, err := findInIndex(child, name)
+			if !errors.Is(err, errFileNotFound) {
+				return data, err
+			}
+		case desc.MediaType.IsImage():
+			img, err := index.Image(desc.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read image %s: %w", desc.Digest, err)
+			}
+			layerName := name
+			if desc.Annotations[tuf.TUFFileNameAnnotation] == name {
+				layerName = path.Base(name)
+			}
+			data, err := findInImage(img, layerName)
+			if !errors.Is(err, errFileNotFound) {
+				return data, err
+			}
+		}
+	}
+	return nil, errFileNotFound
+}
+
+// findInImage returns the contents of the layer annotated with name.
+func findInImage(img v1.Image, name string) ([]byte, error) {
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image manifest: %w", err)
+	}
+	for _, desc := range manifest.Layers {
+		if desc.Annotations[tuf.TUFFileNameAnnotation] != name {
+			continue
+		}
+		layer, err := img.LayerByDigest(desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read layer %s: %w", desc.Digest, err)
+		}
+		rc, err := layer.Uncompressed()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read layer %s: %w", desc.Digest, err)
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+	return nil, errFileNotFound
+}
+
+// roleFromFilename returns the role name from a (consistent snapshot) metadata file name.
+func roleFromFilename(filename string) string {
+	name := strings.TrimSuffix(filename, ".json")
+	if version, role, found := strings.Cut(name, "."); found && isVersion(version) {
+		return role
+	}
+	return name
+}
+
+func isVersion(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
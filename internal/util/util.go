@@ -34,6 +34,15 @@ func IsValidUrl(toTest string) bool {
 	return err == nil && u.Scheme != "" && u.Host != ""
 }
 
+// StatusError is returned by HTTPGet for responses other than 200 OK.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("HTTP GET returned status %d", e.StatusCode)
+}
+
 // HTTPGet fetches content from a URL and returns it as bytes.
 func HTTPGet(url string) ([]byte, error) {
 	resp, err := http.Get(url)
@@ -43,7 +52,7 @@ func HTTPGet(url string) ([]byte, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP GET returned status %d", resp.StatusCode)
+		return nil, &StatusError{StatusCode: resp.StatusCode}
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -0,0 +1,97 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package tufmirror
+
+import (
+	"fmt"
+
+	"github.com/docker/attest/mirror"
+	"github.com/docker/attest/oci"
+	"github.com/docker/attest/tuf"
+	"github.com/docker/go-tuf-mirror/internal/annotations"
+	mirrortuf "github.com/docker/go-tuf-mirror/internal/tuf"
+	"github.com/theupdateframework/go-tuf/v2/metadata"
+)
+
+// roleVersion returns the version of a verified role.
+func roleVersion(repo *mirrortuf.Repository, role string) (int64, error) {
+	r := repo.Role(role)
+	if r == nil {
+		return 0, fmt.Errorf("failed to find role %s in TUF metadata", role)
+	}
+	return r.Version, nil
+}
+
+// annotateMetadata annotates the metadata manifest with the timestamp version, which identifies the
+// snapshot it holds, and each delegated metadata manifest with the version of its role.
+// Delegated metadata manifests must still be tagged with their role name.
+func annotateMetadata(client *tuf.Client, ann map[string]string, image *oci.EmptyConfigImage, delegated []*mirror.Image) (*oci.EmptyConfigImage, error) {
+	repo, err := mirrortuf.Inspect(client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect TUF metadata: %w", err)
+	}
+	version, err := roleVersion(repo, metadata.TIMESTAMP)
+	if err != nil {
+		return nil, err
+	}
+	image, err = annotations.Image(image, annotations.WithRole(ann, metadata.TIMESTAMP, version))
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range delegated {
+		version, err := roleVersion(repo, d.Tag)
+		if err != nil {
+			return nil, err
+		}
+		d.Image, err = annotations.Image(d.Image, annotations.WithRole(ann, d.Tag, version))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return image, nil
+}
+
+// annotateTargets annotates target manifests with the version of the top-level targets role and
+// each delegated target index, and the images in it, with the version of its role.
+// Delegated target indexes must still be tagged with their role name.
+func annotateTargets(client *tuf.Client, ann map[string]string, targets []*mirror.Image, delegated []*mirror.Index) error {
+	repo, err := mirrortuf.Inspect(client)
+	if err != nil {
+		return fmt.Errorf("failed to inspect TUF metadata: %w", err)
+	}
+	version, err := roleVersion(repo, metadata.TARGETS)
+	if err != nil {
+		return err
+	}
+	for _, t := range targets {
+		t.Image, err = annotations.Image(t.Image, annotations.WithRole(ann, metadata.TARGETS, version))
+		if err != nil {
+			return err
+		}
+	}
+	for _, d := range delegated {
+		version, err := roleVersion(repo, d.Tag)
+		if err != nil {
+			return err
+		}
+		d.Index, err = annotations.Index(d.Index, annotations.WithRole(ann, d.Tag, version))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package tufmirror
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// Destination is a location mirrored manifests are saved to. Manifests are saved with a tag, or at the
+// destination itself for an empty tag, like the metadata manifest.
+type Destination interface {
+	// Location returns the user facing destination location.
+	Location() string
+	// Name returns the name a manifest saved with tag is available at.
+	Name(tag string) string
+	// SaveImage saves an image manifest with tag.
+	SaveImage(ctx context.Context, tag string, img v1.Image) error
+	// SaveIndex saves an index manifest with tag.
+	SaveIndex(ctx context.Context, tag string, idx v1.ImageIndex) error
+	// SaveReferrer saves an image referring to the manifest saved with tag and returns its name.
+	SaveReferrer(ctx context.Context, tag string, img v1.Image) (string, error)
+	// SaveSignature signs the subject with signer and saves the signature, keeping signatures of other signers.
+	// It returns nil if the subject already has a valid signature by signer.
+	SaveSignature(ctx context.Context, signer *Signer, subject v1.Descriptor) (*Manifest, error)
+	// ImageExists returns true if the image manifest is saved with tag.
+	ImageExists(ctx context.Context, tag string, img v1.Image) (bool, error)
+	// IndexExists returns true if the index manifest is saved with tag.
+	IndexExists(ctx context.Context, tag string, idx v1.ImageIndex) (bool, error)
+	// Digest returns the digest of the manifest saved with tag, or nil if there is none.
+	Digest(ctx context.Context, tag string) (*v1.Hash, error)
+	// Tags lists the tags saved to the destination.
+	Tags(ctx context.Context) ([]string, error)
+	// Delete deletes the manifest saved with tag.
+	Delete(ctx context.Context, tag string) error
+}
+
+// DestinationDriver opens the destination at a location, given without its scheme.
+type DestinationDriver func(location string) (Destination, error)
+
+var (
+	driversMu sync.RWMutex
+	drivers   = map[string]DestinationDriver{}
+)
+
+// RegisterDestination makes a destination driver available for locations prefixed with scheme://.
+// Registering a scheme again replaces its driver.
+func RegisterDestination(scheme string, driver DestinationDriver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	drivers[scheme] = driver
+}
+
+// DestinationSchemes returns the sorted schemes of the registered destination drivers.
+func DestinationSchemes() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	schemes := make([]string, 0, len(drivers))
+	for scheme := range drivers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// ParseDestination opens the destination at a location prefixed with the scheme of a registered driver.
+func ParseDestination(location string) (Destination, error) {
+	scheme, rest, found := strings.Cut(location, "://")
+	driversMu.RLock()
+	driver, ok := drivers[scheme]
+	driversMu.RUnlock()
+	if !found || !ok {
+		return nil, fmt.Errorf("destination not implemented: %s", location)
+	}
+	return driver(rest)
+}
@@ -0,0 +1,262 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package tufmirror
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/attest/tuf"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func init() {
+	RegisterDestination(strings.TrimSuffix(LocalPrefix, "://"), func(location string) (Destination, error) {
+		return NewFileDestination(location), nil
+	})
+}
+
+// FileDestination saves the TUF files held by manifests to a directory, using the same structure as a web
+// TUF repository, so that it can be served as is or mirrored from with a filesystem source.
+// Files are named after their TUF file name annotation, tags only name the manifests they were saved from.
+type FileDestination struct {
+	path string
+}
+
+// NewFileDestination returns a destination for a TUF repository directory at path.
+func NewFileDestination(path string) *FileDestination {
+	return &FileDestination{path: path}
+}
+
+func (d *FileDestination) Location() string {
+	return LocalPrefix + d.path
+}
+
+func (d *FileDestination) Name(tag string) string {
+	if tag == "" {
+		return d.path
+	}
+	return filepath.Join(d.path, tag)
+}
+
+// SaveImage writes every TUF file of the image, like the metadata files of a metadata manifest.
+func (d *FileDestination) SaveImage(_ context.Context, _ string, img v1.Image) error {
+	files, err := tufFiles(img, "")
+	if err != nil {
+		return err
+	}
+	return d.write(files)
+}
+
+// SaveIndex writes the TUF files of every image in the index, like the targets of a delegated role.
+func (d *FileDestination) SaveIndex(_ context.Context, _ string, idx v1.ImageIndex) error {
+	files, err := indexFiles(idx)
+	if err != nil {
+		return err
+	}
+	return d.write(files)
+}
+
+func (d *FileDestination) SaveReferrer(context.Context, string, v1.Image) (string, error) {
+	return "", fmt.Errorf("referrers are not supported by filesystem destinations: %s", d.Location())
+}
+
+func (d *FileDestination) SaveSignature(context.Context, *Signer, v1.Descriptor) (*Manifest, error) {
+	return nil, fmt.Errorf("signatures are not supported by filesystem destinations: %s", d.Location())
+}
+
+// ImageExists returns true if every TUF file of the image is written with the same content.
+func (d *FileDestination) ImageExists(_ context.Context, _ string, img v1.Image) (bool, error) {
+	files, err := tufFiles(img, "")
+	if err != nil {
+		return false, err
+	}
+	return d.exist(files)
+}
+
+// IndexExists returns true if every TUF file of the images in the index is written with the same content.
+func (d *FileDestination) IndexExists(_ context.Context, _ string, idx v1.ImageIndex) (bool, error) {
+	files, err := indexFiles(idx)
+	if err != nil {
+		return false, err
+	}
+	return d.exist(files)
+}
+
+// Digest returns nil, as filesystem destinations do not save manifests.
+func (d *FileDestination) Digest(context.Context, string) (*v1.Hash, error) {
+	return nil, nil
+}
+
+// Tags lists the files and directories of the repository, top-level targets being named like their tags.
+func (d *FileDestination) Tags(_ context.Context) ([]string, error) {
+	entries, err := os.ReadDir(d.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", d.path, err)
+	}
+	tags := make([]string, 0, len(entries))
+	for _, e := range entries {
+		tags = append(tags, e.Name())
+	}
+	return tags, nil
+}
+
+// Delete removes the file or directory named tag.
+func (d *FileDestination) Delete(_ context.Context, tag string) error {
+	if !filepath.IsLocal(tag) {
+		return fmt.Errorf("invalid tag %q", tag)
+	}
+	return os.RemoveAll(d.Name(tag))
+}
+
+// tufFile is a TUF file held by a layer, named relative to the repository directory.
+type tufFile struct {
+	name  string
+	layer v1.Layer
+}
+
+// tufFiles returns the layers of an image annotated with a TUF file name, placed in dir.
+func tufFiles(img v1.Image, dir string) ([]*tufFile, error) {
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image manifest: %w", err)
+	}
+	var files []*tufFile
+	for _, desc := range manifest.Layers {
+		name, ok := desc.Annotations[tuf.TUFFileNameAnnotation]
+		if !ok {
+			continue
+		}
+		name = path.Join(dir, name)
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			return nil, fmt.Errorf("invalid TUF file name %q", name)
+		}
+		layer, err := img.LayerByDigest(desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read layer %s: %w", desc.Digest, err)
+		}
+		files = append(files, &tufFile{name: name, layer: layer})
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("manifest holds no TUF files")
+	}
+	return files, nil
+}
+
+// indexFiles returns the TUF files of the images in an index. Images annotated with a TUF file name
+// hold a file of that name, its layer being annotated with the base name.
+func indexFiles(idx v1.ImageIndex) ([]*tufFile, error) {
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index manifest: %w", err)
+	}
+	var files []*tufFile
+	for _, desc := range manifest.Manifests {
+		img, err := idx.Image(desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read image %s: %w", desc.Digest, err)
+		}
+		dir := ""
+		if name, ok := desc.Annotations[tuf.TUFFileNameAnnotation]; ok {
+			dir = path.Dir(name)
+		}
+		imageFiles, err := tufFiles(img, dir)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, imageFiles...)
+	}
+	return files, nil
+}
+
+// write writes files atomically, so that a repository being served never exposes partial files.
+func (d *FileDestination) write(files []*tufFile) error {
+	for _, f := range files {
+		target := filepath.Join(d.path, filepath.FromSlash(f.name))
+		err := os.MkdirAll(filepath.Dir(target), 0o755)
+		if err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		err = writeLayer(target, f.layer)
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", target, err)
+		}
+	}
+	return nil
+}
+
+func writeLayer(target string, layer v1.Layer) error {
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".tmp-"+filepath.Base(target))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, rc)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Chmod(0o644)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// exist returns true if every file is written with the content of its layer.
+func (d *FileDestination) exist(files []*tufFile) (bool, error) {
+	for _, f := range files {
+		diffID, err := f.layer.DiffID()
+		if err != nil {
+			return false, fmt.Errorf("failed to get layer digest: %w", err)
+		}
+		file, err := os.Open(filepath.Join(d.path, filepath.FromSlash(f.name)))
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, file)
+		file.Close()
+		if err != nil {
+			return false, err
+		}
+		if diffID.Algorithm != "sha256" || diffID.Hex != hex.EncodeToString(h.Sum(nil)) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
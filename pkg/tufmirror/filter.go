@@ -0,0 +1,62 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package tufmirror
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// validatePatterns checks that filter patterns are valid glob patterns.
+func validatePatterns(patterns []string) error {
+	for _, p := range patterns {
+		_, err := path.Match(p, "")
+		if err != nil {
+			return fmt.Errorf("invalid filter pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// filterByName returns the items whose name matches any of the glob patterns.
+// All items are returned if there are no patterns.
+func filterByName[T any](items []T, patterns []string, name func(T) string) []T {
+	if len(patterns) == 0 {
+		return items
+	}
+	var filtered []T
+	for _, item := range items {
+		for _, p := range patterns {
+			// patterns are validated up front
+			if ok, _ := path.Match(p, name(item)); ok {
+				filtered = append(filtered, item)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// targetName returns the target name of a <hash>.<name> target tag.
+func targetName(tag string) string {
+	_, name, found := strings.Cut(tag, ".")
+	if !found {
+		return tag
+	}
+	return name
+}
@@ -0,0 +1,222 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package tufmirror
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/attest/oci"
+	"github.com/docker/go-tuf-mirror/internal/sign"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+)
+
+func init() {
+	RegisterDestination(strings.TrimSuffix(OCIPrefix, "://"), func(location string) (Destination, error) {
+		return NewLayoutDestination(location), nil
+	})
+}
+
+// LayoutDestination saves manifests to OCI layouts on the filesystem, a layout per tag below the path
+// of the destination, which itself holds the layout of the metadata manifest.
+type LayoutDestination struct {
+	path string
+}
+
+// NewLayoutDestination returns a destination for OCI layouts below path.
+func NewLayoutDestination(path string) *LayoutDestination {
+	return &LayoutDestination{path: path}
+}
+
+func (d *LayoutDestination) Location() string {
+	return OCIPrefix + d.path
+}
+
+func (d *LayoutDestination) Name(tag string) string {
+	if tag == "" {
+		return d.path
+	}
+	return filepath.Join(d.path, tag)
+}
+
+func (d *LayoutDestination) SaveImage(_ context.Context, tag string, img v1.Image) error {
+	return oci.SaveImageAsOCILayout(img, d.Name(tag))
+}
+
+func (d *LayoutDestination) SaveIndex(_ context.Context, tag string, idx v1.ImageIndex) error {
+	return oci.SaveIndexAsOCILayout(idx, d.Name(tag))
+}
+
+// SaveReferrer appends the referrer to the layout of the manifest it refers to.
+func (d *LayoutDestination) SaveReferrer(_ context.Context, tag string, img v1.Image) (string, error) {
+	digest, err := img.Digest()
+	if err != nil {
+		return "", fmt.Errorf("failed to get referrer digest: %w", err)
+	}
+	path := d.Name(tag)
+	p, err := layout.FromPath(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open layout %s: %w", path, err)
+	}
+	err = p.AppendImage(img)
+	if err != nil {
+		return "", fmt.Errorf("failed to save referrer to layout %s: %w", path, err)
+	}
+	return path + "@" + digest.String(), nil
+}
+
+// SaveSignature always stores the signature in a signature layout next to the other layouts.
+func (d *LayoutDestination) SaveSignature(ctx context.Context, signer *Signer, subject v1.Descriptor) (*Manifest, error) {
+	tag := sign.SignatureTag(subject.Digest)
+	base, err := d.image(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+	if base != nil {
+		signed, err := signer.Signed(ctx, base, subject.Digest)
+		if err != nil || signed {
+			return nil, err
+		}
+	}
+	sig, err := signer.Sign(ctx, d.Location(), subject, SignatureTagMode, base)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := sig.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get signature digest: %w", err)
+	}
+	err = d.SaveImage(ctx, tag, sig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save signature as OCI layout: %w", err)
+	}
+	return &Manifest{Name: d.Name(tag), Digest: digest}, nil
+}
+
+// image returns the image saved in the layout of tag, nil if there is none.
+func (d *LayoutDestination) image(ctx context.Context, tag string) (v1.Image, error) {
+	digest, err := d.Digest(ctx, tag)
+	if digest == nil || err != nil {
+		return nil, err
+	}
+	path := d.Name(tag)
+	p, err := layout.FromPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open layout %s: %w", path, err)
+	}
+	img, err := p.Image(*digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image of layout %s: %w", path, err)
+	}
+	return img, nil
+}
+
+// ImageExists returns true if the layout of tag contains the image.
+func (d *LayoutDestination) ImageExists(_ context.Context, tag string, img v1.Image) (bool, error) {
+	digest, err := img.Digest()
+	if err != nil {
+		return false, fmt.Errorf("failed to get image digest: %w", err)
+	}
+	return d.contains(tag, []v1.Hash{digest}), nil
+}
+
+// IndexExists returns true if the layout of tag contains every manifest of the index, as the layout
+// of an index holds its manifests rather than the index itself.
+func (d *LayoutDestination) IndexExists(_ context.Context, tag string, idx v1.ImageIndex) (bool, error) {
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return false, fmt.Errorf("failed to read index manifest: %w", err)
+	}
+	digests := make([]v1.Hash, 0, len(manifest.Manifests))
+	for _, desc := range manifest.Manifests {
+		digests = append(digests, desc.Digest)
+	}
+	return d.contains(tag, digests), nil
+}
+
+func (d *LayoutDestination) contains(tag string, digests []v1.Hash) bool {
+	p, err := layout.FromPath(d.Name(tag))
+	if err != nil {
+		return false
+	}
+	index, err := p.ImageIndex()
+	if err != nil {
+		return false
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return false
+	}
+	saved := map[v1.Hash]bool{}
+	for _, desc := range manifest.Manifests {
+		saved[desc.Digest] = true
+	}
+	for _, digest := range digests {
+		if !saved[digest] {
+			return false
+		}
+	}
+	return true
+}
+
+// Digest returns the digest of the last manifest in the layout of tag, or nil if there is no layout.
+func (d *LayoutDestination) Digest(_ context.Context, tag string) (*v1.Hash, error) {
+	path := d.Name(tag)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+	p, err := layout.FromPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open layout %s: %w", path, err)
+	}
+	index, err := p.ImageIndex()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read layout %s: %w", path, err)
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read layout %s: %w", path, err)
+	}
+	if len(manifest.Manifests) == 0 {
+		return nil, nil
+	}
+	return &manifest.Manifests[len(manifest.Manifests)-1].Digest, nil
+}
+
+// Tags lists the layout directories.
+func (d *LayoutDestination) Tags(_ context.Context) ([]string, error) {
+	entries, err := os.ReadDir(d.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", d.path, err)
+	}
+	var tags []string
+	for _, e := range entries {
+		if e.IsDir() {
+			tags = append(tags, e.Name())
+		}
+	}
+	return tags, nil
+}
+
+// Delete removes a layout directory.
+func (d *LayoutDestination) Delete(_ context.Context, tag string) error {
+	return os.RemoveAll(d.Name(tag))
+}
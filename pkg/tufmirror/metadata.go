@@ -0,0 +1,268 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package tufmirror
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/attest/mirror"
+	"github.com/docker/go-tuf-mirror/internal/provenance"
+	"github.com/docker/go-tuf-mirror/internal/referrers"
+	"github.com/docker/go-tuf-mirror/internal/reproducible"
+	"github.com/docker/go-tuf-mirror/internal/tags"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// MetadataOptions configures mirroring metadata.
+type MetadataOptions struct {
+	// Full also mirrors delegated metadata.
+	Full bool
+	// Roles only mirrors the delegated roles matching any of these glob patterns, all if empty.
+	Roles []string
+	// VersionTags also tags the metadata manifest with the timestamp and root versions (ts-<version>, root-<version>).
+	VersionTags bool
+	// DateTag also tags the metadata manifest with the UTC date of Created, or the current date (date-<yyyymmdd>).
+	DateTag bool
+	// DelegatedTagTemplate is the Go template for delegated metadata tags with .Name, the role name (default <role>).
+	DelegatedTagTemplate string
+	// Signer signs every saved manifest, if set.
+	Signer *Signer
+	// Provenance attaches an in-toto provenance attestation of the run to the metadata manifest.
+	Provenance bool
+	// Annotations are added to every manifest, taking precedence over the automatic annotations.
+	Annotations map[string]string
+	// Created is annotated on every manifest if non-zero, so that manifests stay reproducible otherwise.
+	Created time.Time
+}
+
+// MirrorMetadata saves the metadata manifest and, with Full, the delegated metadata manifests to every destination.
+// Tags are checked for collisions before anything is saved. A destination failing does not stop the others,
+// its error is part of the result.
+func (m *Mirror) MirrorMetadata(ctx context.Context, destinations []Destination, opts *MetadataOptions) (*Result, error) {
+	if opts == nil {
+		opts = &MetadataOptions{}
+	}
+	err := validatePatterns(opts.Roles)
+	if err != nil {
+		return nil, err
+	}
+	templates, err := tags.NewTemplates("", opts.DelegatedTagTemplate)
+	if err != nil {
+		return nil, err
+	}
+	startedOn := time.Now()
+
+	// create metadata image
+	fetchStart := time.Now()
+	image, err := m.mirror.GetMetadataManifest(m.src.MetadataURL())
+	if err != nil {
+		m.observer.ObserveFetch(FetchMetadata, 0, time.Since(fetchStart), err)
+		return nil, fmt.Errorf("failed to create metadata manifest: %w", err)
+	}
+	m.observer.ObserveFetch(FetchMetadata, imageBytes(image), time.Since(fetchStart), nil)
+	m.log.Debug("Fetched metadata", "source", m.src.Location())
+	image, err = reproducible.Image(image)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metadata manifest: %w", err)
+	}
+
+	// additional tags for the metadata manifest, dated by the creation time if set
+	now := opts.Created
+	if now.IsZero() {
+		now = startedOn
+	}
+	extraTags := m.extraTags(opts, now)
+
+	// create delegated metadata manifests
+	var delegated []*mirror.Image
+	if opts.Full {
+		fetchStart := time.Now()
+		delegated, err = m.mirror.GetDelegatedMetadataMirrors()
+		if err != nil {
+			m.observer.ObserveFetch(FetchDelegatedMetadata, 0, time.Since(fetchStart), err)
+			return nil, fmt.Errorf("failed to create delegated metadata manifests: %w", err)
+		}
+		var size int64
+		for _, d := range delegated {
+			size += imageBytes(d.Image)
+		}
+		m.observer.ObserveFetch(FetchDelegatedMetadata, size, time.Since(fetchStart), nil)
+		for _, d := range delegated {
+			m.log.Debug("Fetched delegated metadata", "role", d.Tag, "source", m.src.Location())
+		}
+	}
+
+	// apply filters
+	delegated = filterByName(delegated, opts.Roles, func(d *mirror.Image) string { return d.Tag })
+
+	// annotate manifests while delegated metadata is still tagged with its role name
+	image, err = annotateMetadata(m.Client(), m.annotations(m.src.Location(), opts.Created, opts.Annotations), image, delegated)
+	if err != nil {
+		return nil, err
+	}
+
+	// apply tag templates and check for collisions before anything is published
+	err = applyMetadataTags(templates, destinations, extraTags, delegated)
+	if err != nil {
+		return nil, err
+	}
+
+	// describe the run for provenance
+	run, err := m.provenanceRun("metadata", destinations, startedOn)
+	if err != nil {
+		return nil, err
+	}
+
+	// save metadata manifests to every destination
+	result := &Result{}
+	subjects := provenance.Subjects{}
+	for _, dst := range destinations {
+		m.log.Info("Mirroring metadata", "source", m.src.Location(), "destination", dst.Location(), "delegated", len(delegated))
+		res := &DestinationResult{Destination: dst}
+		res.Err = m.saveMetadata(ctx, dst, res, opts, image, extraTags, delegated)
+		if res.Err == nil {
+			res.Err = m.saveProvenance(ctx, dst, res, opts, run, subjects, image, extraTags, delegated)
+		}
+		if res.Err != nil {
+			m.log.Error("Failed to mirror metadata", "destination", dst.Location(), "error", res.Err)
+		}
+		result.Destinations = append(result.Destinations, res)
+	}
+	result.Provenance = run.Statement(subjects, time.Now())
+	return result, nil
+}
+
+// saveMetadata saves the metadata manifest, with its extra tags, and the delegated metadata manifests to a destination.
+func (m *Mirror) saveMetadata(ctx context.Context, dst Destination, res *DestinationResult, opts *MetadataOptions, image v1.Image, extraTags []string, delegated []*mirror.Image) error {
+	err := m.saveMetadataImage(ctx, dst, res, opts.Signer, "Metadata manifest", "", image)
+	if err != nil {
+		return err
+	}
+	for _, tag := range extraTags {
+		err = m.saveMetadataImage(ctx, dst, res, nil, "Metadata manifest", tag, image)
+		if err != nil {
+			return err
+		}
+	}
+	for _, d := range delegated {
+		err = m.saveMetadataImage(ctx, dst, res, opts.Signer, "Delegated metadata manifest", d.Tag, d.Image)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveMetadataImage saves a metadata manifest with tag, recording whether the destination held it already.
+func (m *Mirror) saveMetadataImage(ctx context.Context, dst Destination, res *DestinationResult, signer *Signer, kind, tag string, img v1.Image) error {
+	exists, err := dst.ImageExists(ctx, tag, img)
+	if err != nil {
+		return err
+	}
+	return m.saveImage(ctx, dst, res, signer, kind, tag, img, !exists)
+}
+
+// extraTags returns the tags to save the metadata manifest with in addition to the destination itself.
+// Version tags let consumers pin a known metadata snapshot, date tags make the mirror history auditable.
+func (m *Mirror) extraTags(opts *MetadataOptions, now time.Time) []string {
+	var tags []string
+	if opts.VersionTags {
+		md := m.Client().GetMetadata()
+		tags = append(tags,
+			fmt.Sprintf("ts-%d", md.Timestamp.Signed.Version),
+			fmt.Sprintf("root-%d", md.Root.Signed.Version),
+		)
+	}
+	if opts.DateTag {
+		tags = append(tags, "date-"+now.UTC().Format("20060102"))
+	}
+	return tags
+}
+
+// applyMetadataTags renders the tags of delegated metadata manifests.
+// Delegated metadata shares each destination with the metadata manifest, so all names must be unique.
+func applyMetadataTags(templates *tags.Templates, destinations []Destination, extraTags []string, delegated []*mirror.Image) error {
+	roles := make([]string, 0, len(delegated))
+	for _, d := range delegated {
+		tag, err := templates.Delegated(d.Tag)
+		if err != nil {
+			return err
+		}
+		roles = append(roles, d.Tag)
+		d.Tag = tag
+	}
+	for _, dst := range destinations {
+		collisions := tags.NewCollisions()
+		err := collisions.Add(dst.Name(""), "metadata")
+		if err != nil {
+			return err
+		}
+		for _, tag := range extraTags {
+			err := collisions.Add(dst.Name(tag), "metadata")
+			if err != nil {
+				return err
+			}
+		}
+		for i, d := range delegated {
+			err := collisions.Add(dst.Name(d.Tag), "delegated role "+roles[i])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// saveProvenance records the manifests saved to a destination as subjects of the run and, if enabled,
+// attaches a provenance attestation of these manifests to the metadata manifest as an OCI referrer.
+func (m *Mirror) saveProvenance(ctx context.Context, dst Destination, res *DestinationResult, opts *MetadataOptions, run *provenance.Run, subjects provenance.Subjects, image v1.Image, extraTags []string, delegated []*mirror.Image) error {
+	destinationSubjects := provenance.Subjects{}
+	err := destinationSubjects.Add(dst.Name(""), image)
+	if err != nil {
+		return err
+	}
+	for _, tag := range extraTags {
+		err = destinationSubjects.Add(dst.Name(tag), image)
+		if err != nil {
+			return err
+		}
+	}
+	for _, d := range delegated {
+		err = destinationSubjects.Add(dst.Name(d.Tag), d.Image)
+		if err != nil {
+			return err
+		}
+	}
+	for name, digest := range destinationSubjects {
+		subjects[name] = digest
+	}
+	if !opts.Provenance {
+		return nil
+	}
+	desc, err := referrers.Describe(image)
+	if err != nil {
+		return err
+	}
+	att, err := provenance.NewAttestation(desc, run.Statement(destinationSubjects, time.Now()))
+	if err != nil {
+		return err
+	}
+	// the attestation records the time of the run, so every run saves a new one
+	return m.saveReferrer(ctx, dst, res, opts.Signer, "Provenance attestation", "", att, true)
+}
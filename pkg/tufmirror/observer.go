@@ -0,0 +1,88 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package tufmirror
+
+import (
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// Fetch operations reported to an Observer.
+const (
+	FetchMetadataUpdate    = "metadata_update"
+	FetchMetadata          = "metadata"
+	FetchDelegatedMetadata = "delegated_metadata"
+	FetchTargets           = "targets"
+	FetchDelegatedTargets  = "delegated_targets"
+)
+
+// Observer is notified of what a mirror fetches, saves and skips, e.g. to export metrics.
+// Kinds are the kinds of saved manifests, like "Target manifest" or "Metadata manifest".
+type Observer interface {
+	// ObserveFetch reports a fetch from the source, with the bytes fetched if known.
+	ObserveFetch(operation string, bytes int64, duration time.Duration, err error)
+	// ObserveSave reports saving a manifest of kind to a destination, with the bytes of the manifest and its layers.
+	// Changed is false if the destination already held the manifest.
+	ObserveSave(destination, kind string, bytes int64, duration time.Duration, changed bool, err error)
+	// ObserveSkip reports a manifest of kind that is already saved to a destination.
+	ObserveSkip(destination, kind string)
+}
+
+type nopObserver struct{}
+
+func (nopObserver) ObserveFetch(string, int64, time.Duration, error)              {}
+func (nopObserver) ObserveSave(string, string, int64, time.Duration, bool, error) {}
+func (nopObserver) ObserveSkip(string, string)                                    {}
+
+// imageBytes returns the size of the manifest and layers of an image.
+func imageBytes(img v1.Image) int64 {
+	size, err := img.Size()
+	if err != nil {
+		return 0
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		return size
+	}
+	for _, l := range layers {
+		n, err := l.Size()
+		if err == nil {
+			size += n
+		}
+	}
+	return size
+}
+
+// indexBytes returns the size of the manifest of an index and of the images it holds.
+func indexBytes(idx v1.ImageIndex) int64 {
+	size, err := idx.Size()
+	if err != nil {
+		return 0
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return size
+	}
+	for _, desc := range manifest.Manifests {
+		img, err := idx.Image(desc.Digest)
+		if err == nil {
+			size += imageBytes(img)
+		}
+	}
+	return size
+}
@@ -0,0 +1,95 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package tufmirror
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/go-tuf-mirror/internal/prune"
+	"github.com/docker/go-tuf-mirror/internal/sign"
+	mirrortuf "github.com/docker/go-tuf-mirror/internal/tuf"
+)
+
+// PruneResult lists the target tags of a destination that were pruned, or would be pruned by a dry run,
+// the signature tags of their manifests, and the target tags that were kept.
+type PruneResult struct {
+	Pruned     []string
+	Signatures []string
+	Kept       []string
+	DryRun     bool
+}
+
+// Prune deletes the target tags of a destination that are not referenced by the verified targets
+// metadata, keeping keep previous generations of each target. A dry run only reports the tags.
+func (m *Mirror) Prune(ctx context.Context, dst Destination, keep int, dryRun bool) (*PruneResult, error) {
+	if keep < 0 {
+		return nil, fmt.Errorf("invalid number of generations to keep: %d", keep)
+	}
+	tags, err := dst.Tags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	current := mirrortuf.CurrentTargets(m.Client())
+	previous := mirrortuf.PreviousTargets(ctx, m.src, m.Client(), keep)
+	plan := prune.NewPlan(tags, current, previous, keep)
+
+	saved := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		saved[tag] = true
+	}
+
+	m.log.Info("Pruning stale target tags", "destination", dst.Location(), "dry_run", dryRun)
+	res := &PruneResult{Kept: plan.Keep, DryRun: dryRun}
+	for _, tag := range plan.Prune {
+		// resolve the signature tag before its subject is deleted
+		sigTag := ""
+		digest, err := dst.Digest(ctx, tag)
+		if err != nil {
+			return nil, err
+		}
+		if digest != nil && saved[sign.SignatureTag(*digest)] {
+			sigTag = sign.SignatureTag(*digest)
+		}
+		if dryRun {
+			m.log.Info("Would delete target tag", "tag", tag, "destination", dst.Location())
+			res.Pruned = append(res.Pruned, tag)
+			if sigTag != "" {
+				m.log.Info("Would delete signature tag", "tag", sigTag, "destination", dst.Location())
+				res.Signatures = append(res.Signatures, sigTag)
+			}
+			continue
+		}
+		err = dst.Delete(ctx, tag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete target tag %s: %w", tag, err)
+		}
+		m.log.Info("Deleted target tag", "tag", tag, "destination", dst.Location())
+		res.Pruned = append(res.Pruned, tag)
+		if sigTag == "" {
+			continue
+		}
+		err = dst.Delete(ctx, sigTag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete signature tag %s: %w", sigTag, err)
+		}
+		m.log.Info("Deleted signature tag", "tag", sigTag, "destination", dst.Location())
+		res.Signatures = append(res.Signatures, sigTag)
+	}
+	m.log.Info("Pruned stale target tags", "destination", dst.Location(), "pruned", len(res.Pruned), "kept", len(res.Kept), "dry_run", dryRun)
+	return res, nil
+}
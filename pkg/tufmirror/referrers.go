@@ -0,0 +1,99 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package tufmirror
+
+import (
+	"fmt"
+
+	"github.com/docker/attest/mirror"
+	"github.com/docker/attest/tuf"
+	"github.com/docker/go-tuf-mirror/internal/referrers"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/theupdateframework/go-tuf/v2/metadata"
+)
+
+// targetReferrer is a referrer attaching targets metadata to a target manifest or to a target
+// image in a delegated target index.
+type targetReferrer struct {
+	target *mirror.Image
+	index  *mirror.Index
+	image  v1.Image
+}
+
+// tag returns the destination tag of the manifest the referrer is attached to,
+// read when saving so that tag templates are applied.
+func (r *targetReferrer) tag() string {
+	if r.index != nil {
+		return r.index.Tag
+	}
+	return r.target.Tag
+}
+
+// newTargetReferrers builds a referrer for every mirrored target, holding the metadata of the role that lists it.
+// Delegated indexes must still be tagged with their role name.
+func newTargetReferrers(client *tuf.Client, targets []*mirror.Image, delegated []*mirror.Index) ([]*targetReferrer, error) {
+	md := client.GetMetadata()
+	var refs []*targetReferrer
+	if len(targets) > 0 {
+		filename, data, err := roleMetadata(md.Targets, metadata.TARGETS)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range targets {
+			subject, err := referrers.Describe(t.Image)
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe target %s: %w", t.Tag, err)
+			}
+			img, err := referrers.NewTargetsReferrer(subject, filename, data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create referrer for target %s: %w", t.Tag, err)
+			}
+			refs = append(refs, &targetReferrer{target: t, image: img})
+		}
+	}
+	for _, d := range delegated {
+		filename, data, err := roleMetadata(md.Targets, d.Tag)
+		if err != nil {
+			return nil, err
+		}
+		manifest, err := d.Index.IndexManifest()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read delegated target index %s: %w", d.Tag, err)
+		}
+		for _, desc := range manifest.Manifests {
+			img, err := referrers.NewTargetsReferrer(desc, filename, data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create referrer for delegated target %s: %w", desc.Digest, err)
+			}
+			refs = append(refs, &targetReferrer{index: d, image: img})
+		}
+	}
+	return refs, nil
+}
+
+// roleMetadata returns the consistent snapshot file name and signed contents of trusted targets metadata.
+func roleMetadata(targets map[string]*metadata.Metadata[metadata.TargetsType], role string) (string, []byte, error) {
+	md, ok := targets[role]
+	if !ok {
+		return "", nil, fmt.Errorf("missing trusted metadata for role %s", role)
+	}
+	data, err := md.ToBytes(false)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to serialize metadata for role %s: %w", role, err)
+	}
+	return fmt.Sprintf("%d.%s.json", md.Signed.Version, role), data, nil
+}
@@ -0,0 +1,269 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package tufmirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/docker/attest/oci"
+	"github.com/docker/go-tuf-mirror/internal/sign"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+func init() {
+	RegisterDestination(strings.TrimSuffix(RegistryPrefix, "://"), func(location string) (Destination, error) {
+		return NewRegistryDestination(location)
+	})
+}
+
+// RegistryDestination saves manifests to a repository of an OCI registry.
+type RegistryDestination struct {
+	repo name.Repository
+	name string // repository as given, without tag
+	tag  string // tag of the destination itself, if given
+}
+
+// NewRegistryDestination returns a destination for a registry repository, optionally tagged.
+// The tag is where the metadata manifest is saved, latest if omitted.
+func NewRegistryDestination(ref string) (*RegistryDestination, error) {
+	if strings.Contains(ref, "@") {
+		return nil, fmt.Errorf("destination registry reference should not have a digest: %s", ref)
+	}
+	repo, err := name.NewRepository(ref)
+	if err == nil {
+		return &RegistryDestination{repo: repo, name: ref}, nil
+	}
+	tag, err := name.NewTag(ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse destination registry reference: %w", err)
+	}
+	return &RegistryDestination{repo: tag.Context(), name: strings.TrimSuffix(ref, ":"+tag.TagStr()), tag: tag.TagStr()}, nil
+}
+
+func (d *RegistryDestination) Location() string {
+	if d.tag == "" {
+		return RegistryPrefix + d.name
+	}
+	return RegistryPrefix + d.name + ":" + d.tag
+}
+
+func (d *RegistryDestination) Name(tag string) string {
+	return d.name + ":" + d.resolveTag(tag)
+}
+
+// resolveTag returns the tag a manifest saved with tag is pushed to: the tag of the destination, or latest,
+// for an empty tag.
+func (d *RegistryDestination) resolveTag(tag string) string {
+	if tag == "" {
+		tag = d.tag
+	}
+	if tag == "" {
+		tag = "latest"
+	}
+	return tag
+}
+
+func (d *RegistryDestination) SaveImage(ctx context.Context, tag string, img v1.Image) error {
+	return oci.PushImageToRegistry(ctx, img, d.Name(tag))
+}
+
+func (d *RegistryDestination) SaveIndex(ctx context.Context, tag string, idx v1.ImageIndex) error {
+	return oci.PushIndexToRegistry(ctx, idx, d.Name(tag))
+}
+
+// SaveReferrer pushes the referrer by digest. Registries without the referrers API are kept up to date
+// through the referrers tag schema.
+func (d *RegistryDestination) SaveReferrer(ctx context.Context, _ string, img v1.Image) (string, error) {
+	digest, err := img.Digest()
+	if err != nil {
+		return "", fmt.Errorf("failed to get referrer digest: %w", err)
+	}
+	err = remote.Write(d.repo.Digest(digest.String()), img, oci.WithOptions(ctx, nil)...)
+	if err != nil {
+		return "", fmt.Errorf("failed to push referrer: %w", err)
+	}
+	return d.name + "@" + digest.String(), nil
+}
+
+// SaveSignature stores the signature in a signature tag or as a referrer, depending on the signer mode.
+// Signatures are appended to the signature tag, so that signatures of other signers are kept.
+func (d *RegistryDestination) SaveSignature(ctx context.Context, signer *Signer, subject v1.Descriptor) (*Manifest, error) {
+	if signer.Mode() == SignatureReferrerMode {
+		signed, err := d.signedByReferrer(ctx, signer, subject.Digest)
+		if err != nil || signed {
+			return nil, err
+		}
+		sig, err := signer.Sign(ctx, d.repo.Name(), subject, SignatureReferrerMode, nil)
+		if err != nil {
+			return nil, err
+		}
+		digest, err := sig.Digest()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get signature digest: %w", err)
+		}
+		name, err := d.SaveReferrer(ctx, "", sig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to push signature: %w", err)
+		}
+		return &Manifest{Name: name, Digest: digest}, nil
+	}
+	tag := sign.SignatureTag(subject.Digest)
+	base, err := d.image(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+	if base != nil {
+		signed, err := signer.Signed(ctx, base, subject.Digest)
+		if err != nil || signed {
+			return nil, err
+		}
+	}
+	sig, err := signer.Sign(ctx, d.repo.Name(), subject, SignatureTagMode, base)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := sig.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get signature digest: %w", err)
+	}
+	err = d.SaveImage(ctx, tag, sig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to push signature: %w", err)
+	}
+	return &Manifest{Name: d.Name(tag), Digest: digest}, nil
+}
+
+// image returns the image tagged with tag, nil if the tag does not exist.
+func (d *RegistryDestination) image(ctx context.Context, tag string) (v1.Image, error) {
+	ref := d.repo.Tag(d.resolveTag(tag))
+	img, err := remote.Image(ref, oci.WithOptions(ctx, nil)...)
+	var terr *transport.Error
+	if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", ref.Name(), err)
+	}
+	return img, nil
+}
+
+// signedByReferrer returns true if a signature referrer of the manifest with digest holds a valid signature
+// by signer.
+func (d *RegistryDestination) signedByReferrer(ctx context.Context, signer *Signer, digest v1.Hash) (bool, error) {
+	opts := oci.WithOptions(ctx, nil)
+	idx, err := remote.Referrers(d.repo.Digest(digest.String()), opts...)
+	if err != nil {
+		return false, fmt.Errorf("failed to list referrers of %s: %w", digest, err)
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return false, fmt.Errorf("failed to read referrers of %s: %w", digest, err)
+	}
+	for _, desc := range manifest.Manifests {
+		if desc.ArtifactType != sign.SignatureArtifactType {
+			continue
+		}
+		sig, err := remote.Image(d.repo.Digest(desc.Digest.String()), opts...)
+		if err != nil {
+			return false, fmt.Errorf("failed to fetch signature %s: %w", desc.Digest, err)
+		}
+		signed, err := signer.Signed(ctx, sig, digest)
+		if err != nil || signed {
+			return signed, err
+		}
+	}
+	return false, nil
+}
+
+// ImageExists returns true if tag points to the image.
+func (d *RegistryDestination) ImageExists(ctx context.Context, tag string, img v1.Image) (bool, error) {
+	digest, err := img.Digest()
+	if err != nil {
+		return false, fmt.Errorf("failed to get image digest: %w", err)
+	}
+	return d.tagged(ctx, tag, digest)
+}
+
+// IndexExists returns true if tag points to the index.
+func (d *RegistryDestination) IndexExists(ctx context.Context, tag string, idx v1.ImageIndex) (bool, error) {
+	digest, err := idx.Digest()
+	if err != nil {
+		return false, fmt.Errorf("failed to get index digest: %w", err)
+	}
+	return d.tagged(ctx, tag, digest)
+}
+
+func (d *RegistryDestination) tagged(ctx context.Context, tag string, digest v1.Hash) (bool, error) {
+	ref := d.repo.Tag(d.resolveTag(tag))
+	desc, err := remote.Head(ref, oci.WithOptions(ctx, nil)...)
+	var terr *transport.Error
+	if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve tag %s: %w", ref.Name(), err)
+	}
+	return desc.Digest == digest, nil
+}
+
+// Digest returns the digest of the manifest tag points to, or nil if the tag does not exist.
+func (d *RegistryDestination) Digest(ctx context.Context, tag string) (*v1.Hash, error) {
+	ref := d.repo.Tag(d.resolveTag(tag))
+	desc, err := remote.Head(ref, oci.WithOptions(ctx, nil)...)
+	var terr *transport.Error
+	if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve tag %s: %w", ref.Name(), err)
+	}
+	return &desc.Digest, nil
+}
+
+// Tags lists the tags of the repository.
+func (d *RegistryDestination) Tags(ctx context.Context) ([]string, error) {
+	tags, err := remote.List(d.repo, oci.WithOptions(ctx, nil)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags of %s: %w", d.repo.Name(), err)
+	}
+	return tags, nil
+}
+
+// Delete deletes a tag from the repository.
+// Registries that do not support deleting tags have the tagged manifest deleted by digest instead.
+// Target manifests are unique to their tag, as the layer annotation contains the tag.
+func (d *RegistryDestination) Delete(ctx context.Context, tag string) error {
+	ref := d.repo.Tag(d.resolveTag(tag))
+	opts := oci.WithOptions(ctx, nil)
+	err := remote.Delete(ref, opts...)
+	var terr *transport.Error
+	if err == nil || !errors.As(err, &terr) || (terr.StatusCode != http.StatusMethodNotAllowed && terr.StatusCode != http.StatusBadRequest) {
+		return err
+	}
+	desc, err := remote.Head(ref, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to resolve tag %s: %w", ref.Name(), err)
+	}
+	return remote.Delete(d.repo.Digest(desc.Digest.String()), opts...)
+}
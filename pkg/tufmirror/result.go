@@ -0,0 +1,79 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package tufmirror
+
+import (
+	"fmt"
+
+	"github.com/docker/go-tuf-mirror/internal/referrers"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+)
+
+// Result is the outcome of mirroring to every destination.
+type Result struct {
+	// Destinations holds the outcome of each destination, in the order given.
+	Destinations []*DestinationResult
+	// Provenance describes the run, set when mirroring metadata.
+	Provenance *intoto.Statement
+}
+
+// DestinationResult is the outcome of mirroring to one destination.
+type DestinationResult struct {
+	Destination Destination
+	// Manifests are the manifests saved to the destination, including signatures and referrers.
+	Manifests []*Manifest
+	// Err is the error that stopped mirroring to the destination.
+	Err error
+}
+
+// Manifest is a manifest saved to a destination.
+type Manifest struct {
+	Name   string
+	Digest v1.Hash
+	// Changed is false if the destination already held the manifest under its name, so that saving it
+	// again did not change the destination.
+	Changed bool
+}
+
+// Err returns the error of a single destination as is. For multiple destinations it returns an error
+// if any of them failed.
+func (r *Result) Err() error {
+	if len(r.Destinations) == 1 {
+		return r.Destinations[0].Err
+	}
+	failed := 0
+	for _, d := range r.Destinations {
+		if d.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to mirror to %d of %d destinations", failed, len(r.Destinations))
+	}
+	return nil
+}
+
+// add records a manifest saved under name.
+func (r *DestinationResult) add(name string, m referrers.Manifest, changed bool) error {
+	digest, err := m.Digest()
+	if err != nil {
+		return fmt.Errorf("failed to get digest of %s: %w", name, err)
+	}
+	r.Manifests = append(r.Manifests, &Manifest{Name: name, Digest: digest, Changed: changed})
+	return nil
+}
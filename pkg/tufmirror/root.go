@@ -0,0 +1,155 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package tufmirror
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/theupdateframework/go-tuf/v2/metadata"
+)
+
+// PreviousRoot is root metadata that was mirrored or trusted before the current run.
+type PreviousRoot struct {
+	// Location is the destination the root was read from, or the TUF cache directory.
+	Location string
+	Version  int64
+	Data     []byte
+}
+
+// TrustedRoot returns the verified root metadata of the mirror as published by the source, so that its digest
+// matches the digest of the N.root.json file of the source.
+// The TUF client persists the root files it verified unchanged in its cache.
+func (m *Mirror) TrustedRoot() ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(rootCacheDir(m.cacheDir, m.root), "root.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trusted root: %w", err)
+	}
+	root, err := metadata.Root().FromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse trusted root: %w", err)
+	}
+	if version := m.Client().GetMetadata().Root.Signed.Version; root.Signed.Version != version {
+		return nil, fmt.Errorf("trusted root of the cache is version %d, expected version %d", root.Signed.Version, version)
+	}
+	return data, nil
+}
+
+// PreviousRoot returns the root metadata previously mirrored to the destinations, falling back to the root
+// accepted by the TUF cache, see AcceptRoot. If the destinations hold different roots, the oldest is returned,
+// so that every change since any destination was last mirrored is reported. Destinations that can not be read
+// as a source, such as custom drivers, are skipped. It returns nil if no previous root is known, and an error
+// if a destination could not be read, as opposed to not holding any root.
+// The previous root is not verified, so it must only be used to report changes.
+func (m *Mirror) PreviousRoot(ctx context.Context, destinations []Destination) (*PreviousRoot, error) {
+	version := m.Client().GetMetadata().Root.Signed.Version
+	var previous *PreviousRoot
+	for _, dst := range destinations {
+		root, err := m.mirroredRoot(ctx, dst, version)
+		if err != nil {
+			return nil, err
+		}
+		if root != nil && (previous == nil || root.Version < previous.Version) {
+			previous = root
+		}
+	}
+	if previous != nil {
+		return previous, nil
+	}
+	return m.cachedRoot, nil
+}
+
+// mirroredRoot returns the newest root metadata up to version mirrored to a destination, or nil if there is none.
+func (m *Mirror) mirroredRoot(ctx context.Context, dst Destination, version int64) (*PreviousRoot, error) {
+	src, err := ParseSource(dst.Location(), "")
+	if err != nil {
+		m.log.Debug("Skipped reading previous root", "destination", dst.Location(), "error", err)
+		return nil, nil
+	}
+	defer src.Close()
+	for v := version; v > 0; v-- {
+		data, err := src.FetchMetadata(ctx, fmt.Sprintf("%d.root.json", v))
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read previous root from %s: %w", dst.Location(), err)
+		}
+		return &PreviousRoot{Location: dst.Location(), Version: v, Data: data}, nil
+	}
+	return nil, nil
+}
+
+// AcceptRoot records the trusted root as accepted by the TUF cache, so that it is the previous root of later
+// runs using the cache. The TUF client trusts a new root as soon as it is verified, so until it is accepted, the
+// previous root of the cache stays the one accepted before, e.g. while a root change awaits approval.
+func (m *Mirror) AcceptRoot() error {
+	data, err := m.TrustedRoot()
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(filepath.Join(rootCacheDir(m.cacheDir, m.root), acceptedRootFile), data, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to record accepted root: %w", err)
+	}
+	m.cachedRoot = &PreviousRoot{Location: m.cacheDir, Version: m.Client().GetMetadata().Root.Signed.Version, Data: data}
+	return nil
+}
+
+// acceptedRootFile holds the accepted root next to the trusted root of the TUF client.
+const acceptedRootFile = "accepted.root.json"
+
+// rootCacheDir returns the directory the TUF client keeps the trusted metadata of an initial root in,
+// named after its digest.
+func rootCacheDir(dir string, initialRoot []byte) string {
+	sum := sha256.Sum256(initialRoot)
+	return filepath.Join(dir, hex.EncodeToString(sum[:]))
+}
+
+// readCachedRoot returns the accepted root of the TUF cache dir of an initial root, nil if there is none.
+// A cache without an accepted root accepts the root it trusts before the update.
+func readCachedRoot(dir string, initialRoot []byte) (*PreviousRoot, error) {
+	accepted := filepath.Join(rootCacheDir(dir, initialRoot), acceptedRootFile)
+	data, err := os.ReadFile(accepted)
+	trusted := errors.Is(err, fs.ErrNotExist)
+	if trusted {
+		data, err = os.ReadFile(filepath.Join(rootCacheDir(dir, initialRoot), "root.json"))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cached root: %w", err)
+	}
+	root, err := metadata.Root().FromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse cached root: %w", err)
+	}
+	if trusted {
+		err = os.WriteFile(accepted, data, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record accepted root: %w", err)
+		}
+	}
+	return &PreviousRoot{Location: dir, Version: root.Signed.Version, Data: data}, nil
+}
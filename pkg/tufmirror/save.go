@@ -0,0 +1,94 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package tufmirror
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/go-tuf-mirror/internal/referrers"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// saveImage saves an image manifest of the given kind with tag, then signs it.
+// Changed tells whether the destination did not hold the manifest with tag before.
+func (m *Mirror) saveImage(ctx context.Context, dst Destination, res *DestinationResult, signer *Signer, kind, tag string, img v1.Image, changed bool) error {
+	start := time.Now()
+	err := dst.SaveImage(ctx, tag, img)
+	m.observer.ObserveSave(dst.Location(), kind, imageBytes(img), time.Since(start), changed, err)
+	if err != nil {
+		return fmt.Errorf("failed to save %s: %w", strings.ToLower(kind), err)
+	}
+	return m.saved(ctx, dst, res, signer, kind, dst.Name(tag), img, changed)
+}
+
+// saveIndex saves an index manifest of the given kind with tag, then signs it.
+// Changed tells whether the destination did not hold the manifest with tag before.
+func (m *Mirror) saveIndex(ctx context.Context, dst Destination, res *DestinationResult, signer *Signer, kind, tag string, idx v1.ImageIndex, changed bool) error {
+	start := time.Now()
+	err := dst.SaveIndex(ctx, tag, idx)
+	m.observer.ObserveSave(dst.Location(), kind, indexBytes(idx), time.Since(start), changed, err)
+	if err != nil {
+		return fmt.Errorf("failed to save %s: %w", strings.ToLower(kind), err)
+	}
+	return m.saved(ctx, dst, res, signer, kind, dst.Name(tag), idx, changed)
+}
+
+// saveReferrer saves a referrer of the given kind to the manifest saved with tag, then signs it.
+// Changed tells whether the destination did not hold the referrer before.
+func (m *Mirror) saveReferrer(ctx context.Context, dst Destination, res *DestinationResult, signer *Signer, kind, tag string, img v1.Image, changed bool) error {
+	start := time.Now()
+	name, err := dst.SaveReferrer(ctx, tag, img)
+	m.observer.ObserveSave(dst.Location(), kind, imageBytes(img), time.Since(start), changed, err)
+	if err != nil {
+		return fmt.Errorf("failed to save %s: %w", strings.ToLower(kind), err)
+	}
+	return m.saved(ctx, dst, res, signer, kind, name, img, changed)
+}
+
+// saved reports and records a manifest saved under name, then signs it like any other mirrored manifest.
+func (m *Mirror) saved(ctx context.Context, dst Destination, res *DestinationResult, signer *Signer, kind, name string, manifest referrers.Manifest, changed bool) error {
+	err := res.add(name, manifest, changed)
+	if err != nil {
+		return err
+	}
+	m.log.Info("Saved manifest", "kind", kind, "name", name, "digest", res.Manifests[len(res.Manifests)-1].Digest.String(), "changed", changed, "destination", dst.Location())
+	if signer == nil {
+		return nil
+	}
+	desc, err := referrers.Describe(manifest)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	sig, err := dst.SaveSignature(ctx, signer, desc)
+	m.observer.ObserveSave(dst.Location(), "Signature", 0, time.Since(start), sig != nil, err)
+	if err != nil {
+		return err
+	}
+	if sig == nil {
+		m.log.Info("Skipped up to date signature", "subject", desc.Digest.String(), "destination", dst.Location())
+		return nil
+	}
+	m.log.Info("Saved signature", "name", sig.Name, "digest", sig.Digest.String(), "subject", desc.Digest.String(), "destination", dst.Location())
+	// a signature is only saved if the subject was not signed yet
+	sig.Changed = true
+	res.Manifests = append(res.Manifests, sig)
+	return nil
+}
@@ -0,0 +1,79 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package tufmirror
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/go-tuf-mirror/internal/sign"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sigstore/sigstore/pkg/signature"
+)
+
+const (
+	// SignatureTagMode stores signatures in cosign compatible sha256-<digest>.sig tags.
+	SignatureTagMode = sign.TagMode
+	// SignatureReferrerMode stores signatures as OCI referrers of the signed manifest.
+	SignatureReferrerMode = sign.ReferrerMode
+)
+
+// Signer signs every manifest saved to a destination. A nil signer signs nothing.
+type Signer struct {
+	signer signature.Signer
+	mode   string
+}
+
+// NewSigner returns a signer storing signatures in registries according to mode.
+func NewSigner(signer signature.Signer, mode string) (*Signer, error) {
+	if mode != SignatureTagMode && mode != SignatureReferrerMode {
+		return nil, fmt.Errorf("unsupported signature mode: %s", mode)
+	}
+	return &Signer{signer: signer, mode: mode}, nil
+}
+
+// LoadSigner loads a PEM encoded ECDSA or ED25519 private key, returning nil if no key is given.
+// Encrypted keys are decrypted with the password in COSIGN_PASSWORD.
+func LoadSigner(key, mode string) (*Signer, error) {
+	if mode != SignatureTagMode && mode != SignatureReferrerMode {
+		return nil, fmt.Errorf("unsupported signature mode: %s", mode)
+	}
+	if key == "" {
+		return nil, nil
+	}
+	signer, err := sign.LoadSigner(key)
+	if err != nil {
+		return nil, err
+	}
+	return NewSigner(signer, mode)
+}
+
+// Mode returns where registries store signatures.
+func (s *Signer) Mode() string {
+	return s.mode
+}
+
+// Sign returns a signature of subject for the repository identity, stored according to mode. In tag mode the
+// signature is appended to base, the signature image already stored in the signature tag if not nil.
+func (s *Signer) Sign(ctx context.Context, identity string, subject v1.Descriptor, mode string, base v1.Image) (v1.Image, error) {
+	return sign.NewSignature(ctx, s.signer, identity, subject, mode, base)
+}
+
+// Signed returns true if the signature image holds a valid signature of the manifest with digest by the signer.
+func (s *Signer) Signed(ctx context.Context, sig v1.Image, digest v1.Hash) (bool, error) {
+	return sign.Signed(ctx, s.signer, sig, digest)
+}
@@ -0,0 +1,85 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package tufmirror
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/docker/go-tuf-mirror/internal/referrers"
+	"github.com/docker/go-tuf-mirror/internal/sign"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSignerInvalidMode(t *testing.T) {
+	_, err := LoadSigner("", "bogus")
+	assert.Error(t, err)
+	signer, err := LoadSigner("", SignatureTagMode)
+	require.NoError(t, err)
+	assert.Nil(t, signer)
+}
+
+func newTestSigner(t *testing.T) *Signer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	s, err := signature.LoadSigner(key, crypto.SHA256)
+	require.NoError(t, err)
+	signer, err := NewSigner(s, SignatureTagMode)
+	require.NoError(t, err)
+	return signer
+}
+
+func TestLayoutSaveSignature(t *testing.T) {
+	ctx := context.Background()
+	dst := NewLayoutDestination(t.TempDir())
+	subject, err := referrers.Describe(empty.Image)
+	require.NoError(t, err)
+	signer := newTestSigner(t)
+	other := newTestSigner(t)
+
+	sig, err := dst.SaveSignature(ctx, signer, subject)
+	require.NoError(t, err)
+	require.NotNil(t, sig)
+	assert.Equal(t, dst.Name(sign.SignatureTag(subject.Digest)), sig.Name)
+
+	// an existing signature of the same signer is kept as is
+	sig, err = dst.SaveSignature(ctx, signer, subject)
+	require.NoError(t, err)
+	assert.Nil(t, sig)
+
+	// signatures of other signers are appended
+	sig, err = dst.SaveSignature(ctx, other, subject)
+	require.NoError(t, err)
+	require.NotNil(t, sig)
+	img, err := dst.image(ctx, sign.SignatureTag(subject.Digest))
+	require.NoError(t, err)
+	manifest, err := img.Manifest()
+	require.NoError(t, err)
+	assert.Len(t, manifest.Layers, 2)
+	for _, s := range []*Signer{signer, other} {
+		signed, err := s.Signed(ctx, img, subject.Digest)
+		require.NoError(t, err)
+		assert.True(t, signed)
+	}
+}
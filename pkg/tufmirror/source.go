@@ -0,0 +1,166 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package tufmirror
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	mirrortuf "github.com/docker/go-tuf-mirror/internal/tuf"
+	"github.com/docker/go-tuf-mirror/internal/util"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// Source is a TUF repository that metadata and targets are mirrored from.
+type Source interface {
+	// Location returns the user facing metadata location.
+	Location() string
+	// MetadataURL returns the metadata location passed to the TUF client.
+	MetadataURL() string
+	// TargetsURL returns the targets location passed to the TUF client.
+	TargetsURL() string
+	// TargetsLocation returns the user facing targets location, empty if targets can not be fetched.
+	TargetsLocation() string
+	// RootLocation returns the user facing location of the initial root metadata.
+	RootLocation() string
+	// FetchMetadata fetches a metadata file by name without verifying it.
+	// The error wraps ErrNotFound if the source does not have the file.
+	FetchMetadata(ctx context.Context, name string) ([]byte, error)
+	// Close releases any resources held by the source.
+	Close() error
+}
+
+// ErrNotFound is wrapped by the error of Source.FetchMetadata if the source does not have a metadata file.
+var ErrNotFound = mirrortuf.ErrNotFound
+
+// source adapts the TUF sources of the mirror.
+type source struct {
+	src     *mirrortuf.Source
+	targets string
+}
+
+func (s *source) Location() string        { return s.src.Location }
+func (s *source) MetadataURL() string     { return s.src.MetadataURL }
+func (s *source) TargetsURL() string      { return s.src.TargetsURL }
+func (s *source) TargetsLocation() string { return s.targets }
+func (s *source) RootLocation() string    { return s.src.RootLocation() }
+func (s *source) Close() error            { return s.src.Close() }
+
+func (s *source) FetchMetadata(ctx context.Context, name string) ([]byte, error) {
+	return s.src.FetchMetadata(ctx, name)
+}
+
+// InitialRoot fetches the first version of the root metadata from a source.
+// The root is trusted on first use, as there is no other way to bootstrap trust.
+func InitialRoot(ctx context.Context, src Source) ([]byte, error) {
+	return src.FetchMetadata(ctx, "1.root.json")
+}
+
+// NewWebSource returns a source for a TUF repository served over http(s).
+// If targets is empty, targets are fetched from the metadata location.
+func NewWebSource(metadata, targets string) (Source, error) {
+	if !util.IsValidUrl(metadata) {
+		return nil, fmt.Errorf("invalid metadata url: %s", metadata)
+	}
+	if targets == "" {
+		targets = metadata
+	}
+	if !util.IsValidUrl(targets) {
+		return nil, fmt.Errorf("invalid targets url: %s", targets)
+	}
+	return &source{src: mirrortuf.NewWebSource(metadata, targets), targets: targets}, nil
+}
+
+// NewRegistrySource returns a source for a TUF repository mirrored to an OCI registry, with the metadata
+// manifest at a tagged reference and targets in a repository. If targets is empty, targets can not be fetched.
+func NewRegistrySource(metadata, targets string) (Source, error) {
+	if strings.Contains(metadata, "@") {
+		return nil, fmt.Errorf("metadata registry reference should not have a digest: %s", metadata)
+	}
+	ref, err := name.ParseReference(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse metadata registry reference: %w", err)
+	}
+	// the registry fetcher matches targets by repository prefix, so the placeholder
+	// must not be a prefix of the metadata reference
+	repo := ref.Context().Name() + "-targets"
+	location := ""
+	if targets != "" {
+		targetsRepo, err := name.NewRepository(targets)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse targets registry reference: %w", err)
+		}
+		repo = targetsRepo.Name()
+		location = RegistryPrefix + targets
+	}
+	return &source{src: mirrortuf.NewRegistrySource(RegistryPrefix+metadata, ref.Name(), repo), targets: location}, nil
+}
+
+// NewLayoutSource returns a source for a TUF repository mirrored to OCI layouts on the filesystem.
+// If targets is empty, targets are read from the metadata layout. The source must be closed.
+func NewLayoutSource(metadata, targets string) (Source, error) {
+	if targets == "" {
+		targets = metadata
+	}
+	src, err := mirrortuf.NewLayoutSource(OCIPrefix+metadata, metadata, targets)
+	if err != nil {
+		return nil, err
+	}
+	return &source{src: src, targets: OCIPrefix + targets}, nil
+}
+
+// NewFilesystemSource returns a source for a TUF repository stored on the filesystem using the same
+// directory structure as a web repository. If targets is empty, targets are read from the metadata directory.
+// The source must be closed.
+func NewFilesystemSource(metadata, targets string) (Source, error) {
+	if targets == "" {
+		targets = metadata
+	}
+	src, err := mirrortuf.NewFilesystemSource(LocalPrefix+metadata, metadata, targets)
+	if err != nil {
+		return nil, err
+	}
+	return &source{src: src, targets: LocalPrefix + targets}, nil
+}
+
+// ParseSource returns the source for a metadata and targets location, each prefixed with the kind of storage.
+// Both locations must use the same kind of storage. If targets is empty the source can only be used to
+// mirror metadata.
+func ParseSource(metadata, targets string) (Source, error) {
+	switch {
+	case strings.HasPrefix(metadata, WebPrefix) || strings.HasPrefix(metadata, InsecureWebPrefix):
+		return NewWebSource(metadata, targets)
+	case strings.HasPrefix(metadata, RegistryPrefix):
+		if targets != "" && !strings.HasPrefix(targets, RegistryPrefix) {
+			return nil, fmt.Errorf("targets location must be a registry for registry metadata: %s", targets)
+		}
+		return NewRegistrySource(strings.TrimPrefix(metadata, RegistryPrefix), strings.TrimPrefix(targets, RegistryPrefix))
+	case strings.HasPrefix(metadata, OCIPrefix):
+		if targets != "" && !strings.HasPrefix(targets, OCIPrefix) {
+			return nil, fmt.Errorf("targets location must be an OCI layout for OCI layout metadata: %s", targets)
+		}
+		return NewLayoutSource(strings.TrimPrefix(metadata, OCIPrefix), strings.TrimPrefix(targets, OCIPrefix))
+	case strings.HasPrefix(metadata, LocalPrefix):
+		if targets != "" && !strings.HasPrefix(targets, LocalPrefix) {
+			return nil, fmt.Errorf("targets location must be a filesystem path for filesystem metadata: %s", targets)
+		}
+		return NewFilesystemSource(strings.TrimPrefix(metadata, LocalPrefix), strings.TrimPrefix(targets, LocalPrefix))
+	default:
+		return nil, fmt.Errorf("metadata source not implemented: %s", metadata)
+	}
+}
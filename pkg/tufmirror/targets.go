@@ -0,0 +1,385 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package tufmirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/docker/attest/mirror"
+	"github.com/docker/go-tuf-mirror/internal/logging"
+	"github.com/docker/go-tuf-mirror/internal/policy"
+	"github.com/docker/go-tuf-mirror/internal/reproducible"
+	"github.com/docker/go-tuf-mirror/internal/tags"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// TargetsOptions configures mirroring targets.
+type TargetsOptions struct {
+	// Full also mirrors delegated target indexes.
+	Full bool
+	// Roles only mirrors the delegated roles matching any of these glob patterns, all if empty.
+	Roles []string
+	// Targets only mirrors the top-level targets whose name matches any of these glob patterns, all if empty.
+	Targets []string
+	// ValidatePolicy validates policy mappings and compiles Rego policies before anything is saved.
+	ValidatePolicy bool
+	// TargetTagTemplate is the Go template for target tags with .Hash and .Name (default <hash>.<name>).
+	TargetTagTemplate string
+	// DelegatedTagTemplate is the Go template for delegated target index tags with .Name, the role name (default <role>).
+	DelegatedTagTemplate string
+	// Referrers attaches the signed targets metadata to each target manifest as an OCI referrer.
+	Referrers bool
+	// Signer signs every saved manifest, if set.
+	Signer *Signer
+	// Annotations are added to every manifest and index, taking precedence over the automatic annotations.
+	Annotations map[string]string
+	// Created is annotated on every manifest if non-zero, so that manifests stay reproducible otherwise.
+	Created time.Time
+	// Resume only saves the manifests missing from a destination or differing there, to repair a partial mirror.
+	Resume bool
+	// Verify checks that every manifest is mirrored to a destination once saved.
+	Verify bool
+	// Prune deletes target tags no longer referenced by the targets metadata once a destination is mirrored.
+	Prune bool
+	// PruneKeep is the number of previous generations of each target to keep when pruning.
+	PruneKeep int
+	// PruneDryRun only reports the target tags that would be pruned.
+	PruneDryRun bool
+}
+
+// MirrorTargets saves the target manifests and, with Full, the delegated target indexes to every destination.
+// Tags are checked for collisions before anything is saved. A destination failing does not stop the others,
+// its error is part of the result.
+func (m *Mirror) MirrorTargets(ctx context.Context, destinations []Destination, opts *TargetsOptions) (*Result, error) {
+	if opts == nil {
+		opts = &TargetsOptions{}
+	}
+	err := validatePatterns(append(append([]string{}, opts.Roles...), opts.Targets...))
+	if err != nil {
+		return nil, err
+	}
+	templates, err := tags.NewTemplates(opts.TargetTagTemplate, opts.DelegatedTagTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Prune && templates.HasTargetTemplate() {
+		return nil, fmt.Errorf("pruning is not supported with a target tag template")
+	}
+
+	// validate policy targets before anything is published
+	if opts.ValidatePolicy {
+		results, err := policy.Validate(ctx, m.Client(), opts.Full)
+		if err != nil {
+			return nil, fmt.Errorf("failed to validate policy targets: %w", err)
+		}
+		for _, r := range results {
+			m.log.Info("Validated policy", "role", r.Role, "mappings", len(r.Mappings), "policies", len(r.Policies))
+		}
+	}
+
+	// create target manifests
+	fetchStart := time.Now()
+	targets, err := m.mirror.GetTUFTargetMirrors()
+	if err != nil {
+		m.observer.ObserveFetch(FetchTargets, 0, time.Since(fetchStart), err)
+		return nil, fmt.Errorf("failed to create target mirrors: %w", err)
+	}
+	var size int64
+	for _, t := range targets {
+		size += imageBytes(t.Image)
+	}
+	m.observer.ObserveFetch(FetchTargets, size, time.Since(fetchStart), nil)
+	for _, t := range targets {
+		m.log.Debug("Fetched target", "tag", t.Tag, "source", m.src.TargetsLocation())
+	}
+
+	// create delegated target manifests
+	var delegated []*mirror.Index
+	if opts.Full {
+		fetchStart := time.Now()
+		delegated, err = m.mirror.GetDelegatedTargetMirrors()
+		if err != nil {
+			m.observer.ObserveFetch(FetchDelegatedTargets, 0, time.Since(fetchStart), err)
+			return nil, fmt.Errorf("failed to create delegated target index manifests: %w", err)
+		}
+		var size int64
+		for _, d := range delegated {
+			size += indexBytes(d.Index)
+		}
+		m.observer.ObserveFetch(FetchDelegatedTargets, size, time.Since(fetchStart), nil)
+		for _, d := range delegated {
+			m.log.Debug("Fetched delegated targets", "role", d.Tag, "source", m.src.TargetsLocation())
+		}
+	}
+
+	// order targets and the manifests of delegated indexes deterministically
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Tag < targets[j].Tag })
+	for _, d := range delegated {
+		d.Index, err = reproducible.Index(d.Index)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create delegated target index manifests: %w", err)
+		}
+	}
+
+	// apply filters
+	targets = filterByName(targets, opts.Targets, func(t *mirror.Image) string { return targetName(t.Tag) })
+	delegated = filterByName(delegated, opts.Roles, func(d *mirror.Index) string { return d.Tag })
+
+	// annotate manifests while delegated indexes are still tagged with their role name
+	err = annotateTargets(m.Client(), m.annotations(m.src.TargetsLocation(), opts.Created, opts.Annotations), targets, delegated)
+	if err != nil {
+		return nil, err
+	}
+
+	// create referrers while delegated indexes are still tagged with their role name
+	var refs []*targetReferrer
+	if opts.Referrers {
+		refs, err = newTargetReferrers(m.Client(), targets, delegated)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create target referrers: %w", err)
+		}
+	}
+
+	// apply tag templates and check for collisions before anything is published
+	err = applyTargetTags(templates, targets, delegated)
+	if err != nil {
+		return nil, err
+	}
+
+	// save target manifests to every destination
+	result := &Result{}
+	for _, dst := range destinations {
+		m.log.Info("Mirroring targets", "source", m.src.TargetsLocation(), "destination", dst.Location(), "targets", len(targets), "delegated", len(delegated))
+		res := &DestinationResult{Destination: dst}
+		res.Err = m.saveTargets(ctx, dst, res, opts, targets, delegated, refs)
+		// prune stale target tags once the current targets are mirrored
+		if res.Err == nil && opts.Prune {
+			_, res.Err = m.Prune(ctx, dst, opts.PruneKeep, opts.PruneDryRun)
+			if res.Err != nil {
+				res.Err = fmt.Errorf("failed to prune targets: %w", res.Err)
+			}
+		}
+		if res.Err != nil {
+			m.log.Error("Failed to mirror targets", "destination", dst.Location(), "error", res.Err)
+		}
+		result.Destinations = append(result.Destinations, res)
+	}
+	return result, nil
+}
+
+// saveTargets saves the target manifests, delegated target indexes and their referrers to a destination.
+// When resuming, only manifests missing from the destination, or differing there, are saved.
+// When verifying, every manifest must be mirrored once saved.
+func (m *Mirror) saveTargets(ctx context.Context, dst Destination, res *DestinationResult, opts *TargetsOptions, targets []*mirror.Image, delegated []*mirror.Index, refs []*targetReferrer) error {
+	// only missing manifests change the destination, the others are skipped when resuming or saved again
+	pendingTargets, pendingDelegated := targets, delegated
+	changed := map[any]bool{}
+	if opts.Resume {
+		missingImages, missingIndexes, err := missingTargets(ctx, m.log, m.observer, dst, targets, delegated)
+		if err != nil {
+			return err
+		}
+		pendingTargets, pendingDelegated = missingImages, missingIndexes
+		refs = pendingReferrers(refs, pendingTargets, pendingDelegated)
+		for _, t := range missingImages {
+			changed[t] = true
+		}
+		for _, d := range missingIndexes {
+			changed[d] = true
+		}
+	} else {
+		var err error
+		changed, err = newTargets(ctx, dst, opts, targets, delegated)
+		if err != nil {
+			return err
+		}
+	}
+	for _, t := range pendingTargets {
+		err := m.saveImage(ctx, dst, res, opts.Signer, "Target manifest", t.Tag, t.Image, changed[t])
+		if err != nil {
+			return err
+		}
+	}
+	for _, d := range pendingDelegated {
+		err := m.saveIndex(ctx, dst, res, opts.Signer, "Delegated target index manifest", d.Tag, d.Index, changed[d])
+		if err != nil {
+			return err
+		}
+	}
+	for _, r := range refs {
+		// referrers are derived from their subject, so they only change with it
+		err := m.saveReferrer(ctx, dst, res, opts.Signer, "Target metadata referrer", r.tag(), r.image, changed[r.target] || changed[r.index])
+		if err != nil {
+			return err
+		}
+	}
+	if opts.Verify {
+		return m.verifyTargets(ctx, dst, targets, delegated)
+	}
+	return nil
+}
+
+// applyTargetTags renders the tags of target and delegated target index manifests.
+// Targets and delegated indexes share the destination, so all tags must be unique.
+func applyTargetTags(templates *tags.Templates, targets []*mirror.Image, delegated []*mirror.Index) error {
+	collisions := tags.NewCollisions()
+	for _, t := range targets {
+		tag, err := templates.Target(t.Tag)
+		if err != nil {
+			return err
+		}
+		err = collisions.Add(tag, "target "+t.Tag)
+		if err != nil {
+			return err
+		}
+		t.Tag = tag
+	}
+	for _, d := range delegated {
+		tag, err := templates.Delegated(d.Tag)
+		if err != nil {
+			return err
+		}
+		err = collisions.Add(tag, "delegated role "+d.Tag)
+		if err != nil {
+			return err
+		}
+		d.Tag = tag
+	}
+	return nil
+}
+
+// missingTargets returns the target manifests and delegated target indexes that are missing from a
+// destination or are tagged with a different digest there, so that only these need to be saved.
+// Skipped manifests are logged to log and reported to observer.
+func missingTargets(ctx context.Context, log *slog.Logger, observer Observer, dst Destination, targets []*mirror.Image, delegated []*mirror.Index) ([]*mirror.Image, []*mirror.Index, error) {
+	var missingImages []*mirror.Image
+	for _, t := range targets {
+		ok, err := dst.ImageExists(ctx, t.Tag, t.Image)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			log.Info("Skipped up to date manifest", "kind", "Target manifest", "tag", t.Tag, "destination", dst.Location())
+			observer.ObserveSkip(dst.Location(), "Target manifest")
+			continue
+		}
+		missingImages = append(missingImages, t)
+	}
+	var missingIndexes []*mirror.Index
+	for _, d := range delegated {
+		ok, err := dst.IndexExists(ctx, d.Tag, d.Index)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			log.Info("Skipped up to date manifest", "kind", "Delegated target index manifest", "tag", d.Tag, "destination", dst.Location())
+			observer.ObserveSkip(dst.Location(), "Delegated target index manifest")
+			continue
+		}
+		missingIndexes = append(missingIndexes, d)
+	}
+	log.Info("Compared manifests", "destination", dst.Location(), "missing", len(missingImages)+len(missingIndexes), "total", len(targets)+len(delegated))
+	return missingImages, missingIndexes, nil
+}
+
+// newTargets returns the target manifests and delegated target indexes a destination does not hold yet, without
+// resolving every target tag: the tags of the destination are listed once, and target tags name the hash of
+// their target, so a listed tag holds the same manifest. Only delegated indexes, which are tagged with their
+// role, and targets whose tag or manifest varies between runs are compared with the destination one by one.
+func newTargets(ctx context.Context, dst Destination, opts *TargetsOptions, targets []*mirror.Image, delegated []*mirror.Index) (map[any]bool, error) {
+	tags, err := dst.Tags(ctx)
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+	listed := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		listed[tag] = true
+	}
+	stable := opts.TargetTagTemplate == "" && opts.Created.IsZero()
+	changed := map[any]bool{}
+	for _, t := range targets {
+		ok := listed[t.Tag]
+		if ok && !stable {
+			ok, err = dst.ImageExists(ctx, t.Tag, t.Image)
+			if err != nil {
+				return nil, err
+			}
+		}
+		changed[t] = !ok
+	}
+	for _, d := range delegated {
+		ok := listed[d.Tag]
+		if ok {
+			ok, err = dst.IndexExists(ctx, d.Tag, d.Index)
+			if err != nil {
+				return nil, err
+			}
+		}
+		changed[d] = !ok
+	}
+	return changed, nil
+}
+
+// isNotFound reports whether err is caused by a destination that does not exist yet.
+func isNotFound(err error) bool {
+	var terr *transport.Error
+	if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+		return true
+	}
+	return errors.Is(err, fs.ErrNotExist)
+}
+
+// verifyTargets checks that every target manifest and delegated target index is mirrored to a destination,
+// so that metadata referencing them can be published.
+func (m *Mirror) verifyTargets(ctx context.Context, dst Destination, targets []*mirror.Image, delegated []*mirror.Index) error {
+	missingImages, missingIndexes, err := missingTargets(ctx, logging.Discard(), nopObserver{}, dst, targets, delegated)
+	if err != nil {
+		return fmt.Errorf("failed to verify targets: %w", err)
+	}
+	total := len(targets) + len(delegated)
+	missing := len(missingImages) + len(missingIndexes)
+	if missing > 0 {
+		return fmt.Errorf("failed to verify targets: %d of %d manifest(s) missing or stale in %s", missing, total, dst.Location())
+	}
+	m.log.Info("Verified targets", "destination", dst.Location(), "manifests", total)
+	return nil
+}
+
+// pendingReferrers returns the referrers of the target manifests and delegated target indexes being saved.
+func pendingReferrers(refs []*targetReferrer, targets []*mirror.Image, delegated []*mirror.Index) []*targetReferrer {
+	pending := map[any]bool{}
+	for _, t := range targets {
+		pending[t] = true
+	}
+	for _, d := range delegated {
+		pending[d] = true
+	}
+	var result []*targetReferrer
+	for _, r := range refs {
+		if (r.target != nil && pending[r.target]) || (r.index != nil && pending[r.index]) {
+			result = append(result, r)
+		}
+	}
+	return result
+}
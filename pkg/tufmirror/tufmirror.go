@@ -0,0 +1,213 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package tufmirror mirrors TUF metadata and targets from a TUF repository to OCI registries and OCI layouts.
+// It is the library behind the go-tuf-mirror commands, which are thin wrappers around it.
+//
+// A Mirror performs a verified update of the TUF metadata of a Source, then saves the metadata or targets as
+// OCI manifests to one or more Destinations:
+//
+//	src, err := tufmirror.NewWebSource(metadataURL, targetsURL)
+//	...
+//	m, err := tufmirror.New(ctx, src, &tufmirror.Options{CacheDir: dir})
+//	...
+//	defer m.Close()
+//	res, err := m.MirrorTargets(ctx, []tufmirror.Destination{tufmirror.NewLayoutDestination(path)}, &tufmirror.TargetsOptions{})
+package tufmirror
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/docker/attest/mirror"
+	"github.com/docker/attest/tuf"
+	"github.com/docker/go-tuf-mirror/internal/annotations"
+	"github.com/docker/go-tuf-mirror/internal/logging"
+	"github.com/docker/go-tuf-mirror/internal/provenance"
+	mirrortuf "github.com/docker/go-tuf-mirror/internal/tuf"
+	"github.com/theupdateframework/go-tuf/v2/metadata"
+)
+
+const (
+	OCIPrefix         = "oci://"    // filesystem oci layout
+	RegistryPrefix    = "docker://" // remote registry
+	LocalPrefix       = "file://"   // local filesystem
+	WebPrefix         = "https://"  // web
+	InsecureWebPrefix = "http://"   // insecure web
+)
+
+// Options configures a Mirror.
+type Options struct {
+	// CacheDir holds the trusted metadata of the source between runs. If empty, a temporary directory
+	// removed on Close is used, so trust always starts from the initial root.
+	CacheDir string
+	// Root is the trusted initial root metadata. If nil, the initial root of the source is fetched and
+	// trusted on first use.
+	Root []byte
+	// RootLocation is where Root was read from, recorded in provenance.
+	RootLocation string
+	// Version is the mirror version recorded in annotations and provenance, unknown if empty.
+	Version string
+	// Logger receives structured progress records, which are discarded if nil.
+	Logger *slog.Logger
+	// Observer is notified of fetches, saves and skips, e.g. to export metrics.
+	Observer Observer
+}
+
+// Mirror mirrors the verified TUF metadata and targets of a source.
+type Mirror struct {
+	src          Source
+	mirror       *mirror.TUFMirror
+	root         []byte
+	rootLocation string
+	version      string
+	log          *slog.Logger
+	observer     Observer
+	tempDir      string
+	cacheDir     string
+	cachedRoot   *PreviousRoot // accepted root of the cache, nil if the cache was empty
+}
+
+// New performs a verified update of the TUF metadata of src and returns a mirror of it.
+// The source is not closed by the mirror, but must stay open until the mirror is closed.
+func New(ctx context.Context, src Source, opts *Options) (*Mirror, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	m := &Mirror{
+		src:          src,
+		root:         opts.Root,
+		rootLocation: opts.RootLocation,
+		version:      opts.Version,
+		log:          opts.Logger,
+		observer:     opts.Observer,
+	}
+	if m.version == "" {
+		m.version = "unknown"
+	}
+	if m.log == nil {
+		m.log = logging.Discard()
+	}
+	if m.observer == nil {
+		m.observer = nopObserver{}
+	}
+	if m.root == nil {
+		root, err := InitialRoot(ctx, src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch root from source: %w", err)
+		}
+		m.root = root
+	}
+	if m.rootLocation == "" {
+		m.rootLocation = src.RootLocation()
+	}
+
+	dir := opts.CacheDir
+	if dir == "" {
+		var err error
+		m.tempDir, err = os.MkdirTemp("", "go-tuf-mirror-cache")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temporary TUF cache: %w", err)
+		}
+		dir = m.tempDir
+	}
+	m.cacheDir = dir
+	cachedRoot, err := readCachedRoot(dir, m.root)
+	if err != nil {
+		_ = m.Close()
+		return nil, err
+	}
+	m.cachedRoot = cachedRoot
+	m.log.Info("Updating TUF metadata", "source", src.Location(), "metadata_url", src.MetadataURL(), "cache", dir)
+	start := time.Now()
+	tm, err := mirror.NewTUFMirror(ctx, m.root, dir, src.MetadataURL(), src.TargetsURL(), &mirrortuf.NullVersionChecker{})
+	m.observer.ObserveFetch(FetchMetadataUpdate, 0, time.Since(start), err)
+	if err != nil {
+		_ = m.Close()
+		return nil, fmt.Errorf("failed to create TUF mirror: %w", err)
+	}
+	m.mirror = tm
+	md := tm.TUFClient.GetMetadata()
+	m.log.Info("Verified TUF metadata", "source", src.Location(),
+		"root_version", md.Root.Signed.Version,
+		"timestamp_version", md.Timestamp.Signed.Version,
+		"snapshot_version", md.Snapshot.Signed.Version,
+		"targets_version", md.Targets[metadata.TARGETS].Signed.Version)
+	return m, nil
+}
+
+// Source returns the source of the mirror.
+func (m *Mirror) Source() Source {
+	return m.src
+}
+
+// Client returns the TUF client holding the verified metadata of the source.
+func (m *Mirror) Client() *tuf.Client {
+	return m.mirror.TUFClient
+}
+
+// Close removes the temporary TUF cache of the mirror, if any.
+func (m *Mirror) Close() error {
+	if m.tempDir == "" {
+		return nil
+	}
+	err := os.RemoveAll(m.tempDir)
+	if err != nil {
+		return fmt.Errorf("failed to remove temporary TUF cache: %w", err)
+	}
+	m.tempDir = ""
+	return nil
+}
+
+// annotations returns the annotations of every manifest mirrored from source.
+// The created annotation is only added for a non-zero created time, so that manifests stay reproducible.
+// User given annotations take precedence over the automatic ones.
+func (m *Mirror) annotations(source string, created time.Time, custom map[string]string) map[string]string {
+	ann := map[string]string{
+		annotations.Source:  source,
+		annotations.Version: m.version,
+	}
+	if !created.IsZero() {
+		ann[annotations.Created] = created.UTC().Format(time.RFC3339)
+	}
+	return annotations.Merge(ann, custom)
+}
+
+// provenanceRun describes a mirror run from the verified state of the mirror.
+func (m *Mirror) provenanceRun(command string, destinations []Destination, startedOn time.Time) (*provenance.Run, error) {
+	repo, err := mirrortuf.Inspect(m.Client())
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect TUF metadata: %w", err)
+	}
+	locations := make([]string, 0, len(destinations))
+	for _, dst := range destinations {
+		locations = append(locations, dst.Location())
+	}
+	return &provenance.Run{
+		Command:      command,
+		Metadata:     m.src.Location(),
+		Targets:      m.src.TargetsLocation(),
+		Destinations: locations,
+		RootLocation: m.rootLocation,
+		Root:         m.root,
+		Roles:        repo.Roles,
+		Version:      m.version,
+		StartedOn:    startedOn,
+	}, nil
+}
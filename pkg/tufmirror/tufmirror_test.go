@@ -0,0 +1,258 @@
+/*
+   Copyright Docker go-tuf-mirror authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package tufmirror
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirror(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "..", "internal", "test", "testdata", "test-repo"))))
+	defer server.Close()
+
+	var heads atomic.Int32
+	handler := registry.New(registry.WithReferrersSupport(false))
+	reg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead && strings.Contains(r.URL.Path, "/targets/manifests/") {
+			heads.Add(1)
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer reg.Close()
+	u, err := url.Parse(reg.URL)
+	require.NoError(t, err)
+	repo := "localhost:" + u.Port() + "/test"
+	dir := t.TempDir()
+
+	src, err := NewWebSource(server.URL+"/metadata", server.URL+"/targets")
+	require.NoError(t, err)
+	defer src.Close()
+	m, err := New(ctx, src, &Options{Version: "v1.2.3"})
+	require.NoError(t, err)
+	cache := m.tempDir
+	assert.DirExists(t, cache)
+
+	metadataRepo, err := NewRegistryDestination(repo + "/metadata:latest")
+	require.NoError(t, err)
+	targetsRepo, err := NewRegistryDestination(repo + "/targets")
+	require.NoError(t, err)
+
+	// targets are verified after saving
+	res, err := m.MirrorTargets(ctx, []Destination{NewLayoutDestination(filepath.Join(dir, "targets")), targetsRepo}, &TargetsOptions{Full: true, Verify: true})
+	require.NoError(t, err)
+	require.NoError(t, res.Err())
+	require.Len(t, res.Destinations, 2)
+	for _, d := range res.Destinations {
+		// 5 top-level targets and the index of the delegated role
+		assert.Len(t, d.Manifests, 6)
+	}
+	assert.Nil(t, res.Provenance)
+
+	// targets saved again do not change the destinations, telling so only resolves the delegated index in
+	// addition to the tags resolved by pushing
+	heads.Store(0)
+	res, err = m.MirrorTargets(ctx, []Destination{NewLayoutDestination(filepath.Join(dir, "targets")), targetsRepo}, &TargetsOptions{Full: true})
+	require.NoError(t, err)
+	require.NoError(t, res.Err())
+	for _, d := range res.Destinations {
+		require.Len(t, d.Manifests, 6)
+		for _, manifest := range d.Manifests {
+			assert.False(t, manifest.Changed, manifest.Name)
+		}
+	}
+	assert.Equal(t, int32(6+1), heads.Load())
+
+	res, err = m.MirrorMetadata(ctx, []Destination{NewLayoutDestination(filepath.Join(dir, "metadata")), metadataRepo}, &MetadataOptions{Full: true, Provenance: true})
+	require.NoError(t, err)
+	require.NoError(t, res.Err())
+	require.Len(t, res.Destinations, 2)
+	assert.Equal(t, filepath.Join(dir, "metadata"), res.Destinations[0].Manifests[0].Name)
+	assert.Equal(t, repo+"/metadata:latest", res.Destinations[1].Manifests[0].Name)
+	for _, d := range res.Destinations {
+		// metadata, delegated metadata and provenance attestation
+		assert.Len(t, d.Manifests, 3)
+	}
+	require.NotNil(t, res.Provenance)
+	assert.Len(t, res.Provenance.Subject, 4)
+	for _, d := range res.Destinations {
+		assert.True(t, d.Manifests[0].Changed)
+	}
+
+	// metadata saved again does not change the destinations
+	res, err = m.MirrorMetadata(ctx, []Destination{NewLayoutDestination(filepath.Join(dir, "metadata")), metadataRepo}, &MetadataOptions{Full: true})
+	require.NoError(t, err)
+	require.NoError(t, res.Err())
+	for _, d := range res.Destinations {
+		require.Len(t, d.Manifests, 2)
+		for _, manifest := range d.Manifests {
+			assert.False(t, manifest.Changed, manifest.Name)
+		}
+	}
+	digest, err := metadataRepo.Digest(ctx, "")
+	require.NoError(t, err)
+	require.NotNil(t, digest)
+	assert.Equal(t, res.Destinations[1].Manifests[0].Digest, *digest)
+
+	require.NoError(t, m.Close())
+	assert.NoDirExists(t, cache)
+}
+
+func TestParseSource(t *testing.T) {
+	testCases := []struct {
+		name     string
+		metadata string
+		targets  string
+		location string
+		err      string
+	}{
+		{"web", "https://example.com/metadata", "", "https://example.com/metadata", ""},
+		{"registry", "docker://example.com/tuf/metadata:latest", "docker://example.com/tuf/targets", "docker://example.com/tuf/metadata:latest", ""},
+		{"registry digest", "docker://example.com/tuf/metadata@sha256:abc", "", "", "should not have a digest"},
+		{"mixed", "docker://example.com/tuf/metadata:latest", "oci:///tmp/targets", "", "targets location must be a registry"},
+		{"unknown", "ftp://example.com/metadata", "", "", "metadata source not implemented"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			src, err := ParseSource(tc.metadata, tc.targets)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			defer src.Close()
+			assert.Equal(t, tc.location, src.Location())
+		})
+	}
+}
+
+func TestParseDestination(t *testing.T) {
+	testCases := []struct {
+		name     string
+		location string
+		main     string
+		tagged   string
+		err      string
+	}{
+		{"layout", "oci:///tmp/mirror", "/tmp/mirror", filepath.Join("/tmp/mirror", "tag"), ""},
+		{"registry", "docker://example.com/tuf/targets", "example.com/tuf/targets:latest", "example.com/tuf/targets:tag", ""},
+		{"registry tag", "docker://example.com/tuf/metadata:v1", "example.com/tuf/metadata:v1", "example.com/tuf/metadata:tag", ""},
+		{"registry digest", "docker://example.com/tuf/metadata@sha256:abc", "", "", "should not have a digest"},
+		{"filesystem", "file:///tmp/repo", "/tmp/repo", filepath.Join("/tmp/repo", "tag"), ""},
+		{"unknown", "s3://bucket/mirror", "", "", "destination not implemented"},
+		{"no scheme", "/tmp/mirror", "", "", "destination not implemented"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dst, err := ParseDestination(tc.location)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.location, dst.Location())
+			assert.Equal(t, tc.main, dst.Name(""))
+			assert.Equal(t, tc.tagged, dst.Name("tag"))
+		})
+	}
+}
+
+func TestFileDestination(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "..", "internal", "test", "testdata", "test-repo"))))
+	defer server.Close()
+	dir := t.TempDir()
+	metadata := LocalPrefix + filepath.Join(dir, "metadata")
+	targets := LocalPrefix + filepath.Join(dir, "targets")
+
+	src, err := NewWebSource(server.URL+"/metadata", server.URL+"/targets")
+	require.NoError(t, err)
+	defer src.Close()
+	m, err := New(ctx, src, &Options{})
+	require.NoError(t, err)
+	defer m.Close()
+
+	metadataDst, err := ParseDestination(metadata)
+	require.NoError(t, err)
+	targetsDst, err := ParseDestination(targets)
+	require.NoError(t, err)
+	res, err := m.MirrorTargets(ctx, []Destination{targetsDst}, &TargetsOptions{Full: true, Verify: true})
+	require.NoError(t, err)
+	require.NoError(t, res.Err())
+	res, err = m.MirrorMetadata(ctx, []Destination{metadataDst}, &MetadataOptions{Full: true})
+	require.NoError(t, err)
+	require.NoError(t, res.Err())
+
+	// referrers can't be stored as files
+	res, err = m.MirrorMetadata(ctx, []Destination{metadataDst}, &MetadataOptions{Provenance: true})
+	require.NoError(t, err)
+	require.ErrorContains(t, res.Err(), "not supported by filesystem destinations")
+
+	// the mirrored files are a TUF repository
+	fileSrc, err := ParseSource(metadata, targets)
+	require.NoError(t, err)
+	defer fileSrc.Close()
+	fm, err := New(ctx, fileSrc, &Options{})
+	require.NoError(t, err)
+	defer fm.Close()
+	res, err = fm.MirrorTargets(ctx, []Destination{NewLayoutDestination(filepath.Join(dir, "layout"))}, &TargetsOptions{Full: true})
+	require.NoError(t, err)
+	require.NoError(t, res.Err())
+	assert.Len(t, res.Destinations[0].Manifests, 6)
+}
+
+type memoryDestination struct {
+	LayoutDestination
+	path string
+}
+
+func (d *memoryDestination) Location() string {
+	return "memory://" + d.path
+}
+
+func TestRegisterDestination(t *testing.T) {
+	// drivers get the location without the scheme
+	RegisterDestination("memory", func(path string) (Destination, error) {
+		return &memoryDestination{path: path}, nil
+	})
+	assert.Contains(t, DestinationSchemes(), "memory")
+	assert.Subset(t, DestinationSchemes(), []string{"docker", "file", "oci"})
+
+	dst, err := ParseDestination("memory://mirror")
+	require.NoError(t, err)
+	assert.Equal(t, "memory://mirror", dst.Location())
+}
+
+func TestResultErr(t *testing.T) {
+	failed := errors.New("failed")
+	ok := &DestinationResult{}
+	assert.Equal(t, failed, (&Result{Destinations: []*DestinationResult{{Err: failed}}}).Err())
+	assert.NoError(t, (&Result{Destinations: []*DestinationResult{ok, ok}}).Err())
+	assert.EqualError(t, (&Result{Destinations: []*DestinationResult{ok, {Err: failed}}}).Err(), "failed to mirror to 1 of 2 destinations")
+}